@@ -0,0 +1,247 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/healthimation/go-dexcom/dexcom"
+	"github.com/healthimation/go-dexcom/dexcom/metrics"
+)
+
+// sync outcomes counted in dexcom_syncd_syncs_total
+const (
+	resultSuccess = "success"
+	resultError   = "error"
+	resultSkipped = "skipped"
+)
+
+// daemon runs the scheduler every interval and reports on it over http
+type daemon struct {
+	scheduler dexcom.Scheduler
+	interval  time.Duration
+	logger    *log.Logger
+	now       func() time.Time
+	// client holds the metrics of the requests made by syncs
+	client *metrics.Prometheus
+	// draining is closed on shutdown so that no new syncs start, while those already running finish
+	draining  chan struct{}
+	drainOnce sync.Once
+
+	mu          sync.Mutex
+	started     time.Time
+	lastRun     time.Time
+	runDuration time.Duration
+	runs        int64
+	running     bool
+	syncs       map[string]int64
+	records     map[string]int64
+}
+
+func newDaemon(scheduler dexcom.Scheduler, interval time.Duration, logger *log.Logger) *daemon {
+	return &daemon{
+		client:    metrics.NewPrometheus("dexcom"),
+		draining:  make(chan struct{}),
+		scheduler: scheduler,
+		interval:  interval,
+		logger:    logger,
+		now:       time.Now,
+		started:   time.Now(),
+		syncs:     map[string]int64{resultSuccess: 0, resultError: 0, resultSkipped: 0},
+		records:   map[string]int64{"egvs": 0, "events": 0, "devices": 0, "calibrations": 0},
+	}
+}
+
+// loop runs the scheduler until stop is done.  ctx is only canceled to abort syncs that outlive the shutdown grace
+// period.
+func (d *daemon) loop(ctx context.Context, stop context.Context) {
+	for {
+		d.runOnce(ctx)
+		select {
+		case <-stop.Done():
+			return
+		case <-time.After(d.interval):
+		}
+	}
+}
+
+func (d *daemon) runOnce(ctx context.Context) {
+	ctx = dexcom.WithDrain(dexcom.WithMetrics(ctx, d.client), d.draining)
+	d.mu.Lock()
+	d.running = true
+	d.mu.Unlock()
+
+	start := d.now()
+	statuses, err := d.scheduler.Run(ctx, d.progress)
+	failed := 0
+	for _, s := range statuses {
+		if s.Error != "" {
+			failed++
+		}
+	}
+
+	d.mu.Lock()
+	d.running = false
+	d.runs++
+	d.lastRun = d.now()
+	d.runDuration = d.lastRun.Sub(start)
+	d.mu.Unlock()
+
+	if err != nil {
+		d.logger.Printf("sync run stopped after %d users: %v", len(statuses), err)
+		return
+	}
+	d.logger.Printf("synced %d users, %d failed, in %s", len(statuses), failed, d.now().Sub(start).Round(time.Millisecond))
+}
+
+// progress counts each finished user sync
+func (d *daemon) progress(s dexcom.UserStatus) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	switch {
+	case s.Skipped, s.ErrorCode == dexcom.ErrorCanceled:
+		d.syncs[resultSkipped]++
+	case s.Error != "":
+		d.syncs[resultError]++
+	default:
+		d.syncs[resultSuccess]++
+		if s.Result != nil {
+			d.records["egvs"] += int64(s.Result.EGVs)
+			d.records["events"] += int64(s.Result.Events)
+			d.records["devices"] += int64(s.Result.Devices)
+			d.records["calibrations"] += int64(s.Result.Calibrations)
+		}
+	}
+}
+
+func (d *daemon) handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/healthz", d.healthz)
+	mux.HandleFunc("/metrics", d.metrics)
+	mux.HandleFunc("/status", d.status)
+	mux.HandleFunc("/status/", d.userStatus)
+	return mux
+}
+
+// healthz fails while shutting down and when no run has finished for a few intervals, e.g. because a run is stuck
+func (d *daemon) healthz(w http.ResponseWriter, r *http.Request) {
+	d.mu.Lock()
+	last := d.lastRun
+	if last.IsZero() {
+		last = d.started
+	}
+	stale := d.now().Sub(last) > 3*d.interval
+	d.mu.Unlock()
+
+	switch {
+	case d.isDraining():
+		http.Error(w, "shutting down", http.StatusServiceUnavailable)
+	case stale:
+		http.Error(w, fmt.Sprintf("no sync run has finished since %s", last.UTC().Format(time.RFC3339)), http.StatusServiceUnavailable)
+	default:
+		fmt.Fprintln(w, "ok")
+	}
+}
+
+// metrics writes the prometheus text exposition format
+func (d *daemon) metrics(w http.ResponseWriter, r *http.Request) {
+	statuses := d.scheduler.Status()
+	failing := 0
+	for _, s := range statuses {
+		if s.Error != "" {
+			failing++
+		}
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+	metric(w, "dexcom_syncd_runs_total", "counter", "Scheduler runs finished.", float64(d.runs))
+	metric(w, "dexcom_syncd_running", "gauge", "1 while a scheduler run is in progress.", boolFloat(d.running))
+	metric(w, "dexcom_syncd_last_run_timestamp_seconds", "gauge", "When the last scheduler run finished.", unixSeconds(d.lastRun))
+	metric(w, "dexcom_syncd_last_run_duration_seconds", "gauge", "How long the last scheduler run took.", d.runDuration.Seconds())
+	metric(w, "dexcom_syncd_users", "gauge", "Users seen in the token store.", float64(len(statuses)))
+	metric(w, "dexcom_syncd_users_failing", "gauge", "Users whose last sync failed.", float64(failing))
+	labeled(w, "dexcom_syncd_syncs_total", "counter", "User syncs by result.", "result", d.syncs)
+	labeled(w, "dexcom_syncd_records_total", "counter", "Records synced by type.", "type", d.records)
+	d.client.WriteTo(w)
+}
+
+// status lists the sync status of every user
+func (d *daemon) status(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, d.scheduler.Status())
+}
+
+func (d *daemon) userStatus(w http.ResponseWriter, r *http.Request) {
+	userID, err := url.PathUnescape(strings.TrimPrefix(r.URL.EscapedPath(), "/status/"))
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "bad user id"})
+		return
+	}
+	for _, s := range d.scheduler.Status() {
+		if s.UserID == userID {
+			writeJSON(w, http.StatusOK, s)
+			return
+		}
+	}
+	writeJSON(w, http.StatusNotFound, map[string]string{"error": "unknown user"})
+}
+
+func writeJSON(w http.ResponseWriter, code int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	enc.Encode(v)
+}
+
+func metric(w http.ResponseWriter, name, metricType, help string, value float64) {
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n%s %g\n", name, help, name, metricType, name, value)
+}
+
+func labeled(w http.ResponseWriter, name, metricType, help, label string, values map[string]int64) {
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, metricType)
+	keys := make([]string, 0, len(values))
+	for k := range values {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		fmt.Fprintf(w, "%s{%s=%q} %d\n", name, label, k, values[k])
+	}
+}
+
+func boolFloat(b bool) float64 {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+func unixSeconds(t time.Time) float64 {
+	if t.IsZero() {
+		return 0
+	}
+	return float64(t.UnixMilli()) / 1000
+}
+
+// drain stops new syncs from starting
+func (d *daemon) drain() {
+	d.drainOnce.Do(func() { close(d.draining) })
+}
+
+func (d *daemon) isDraining() bool {
+	select {
+	case <-d.draining:
+		return true
+	default:
+		return false
+	}
+}
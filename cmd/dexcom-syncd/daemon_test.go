@@ -0,0 +1,148 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/healthimation/go-dexcom/dexcom"
+	"github.com/healthimation/go-dexcom/dexcom/dexcomtest"
+)
+
+func TestUnit_Daemon(t *testing.T) {
+	ctx := context.Background()
+	s := dexcomtest.NewServer("id", "secret")
+	defer s.Close()
+	s.Seed("patient", dexcomtest.Generate(dexcomtest.DefaultGeneratorConfig(1, time.Now().Add(-48*time.Hour), 48*time.Hour)))
+	c := s.Client(5 * time.Second)
+	token, err := c.GetUser(ctx, s.AuthorizationCode("patient"), "uri")
+	if err != nil {
+		t.Fatalf("Unexpected error occurred (%#v)", err)
+	}
+
+	dir := t.TempDir()
+	tokens := dexcom.NewFileTokenStore(filepath.Join(dir, "tokens.json"))
+	if err := tokens.SaveToken(ctx, "patient", token); err != nil {
+		t.Fatalf("Unexpected error occurred (%#v)", err)
+	}
+	checkpoints := dexcom.NewFileCheckpointStore(filepath.Join(dir, "checkpoints.json"))
+	syncer := dexcom.NewSyncer(c, dexcom.NewJSONLSink(filepath.Join(dir, "data")), checkpoints, time.Hour, 72*time.Hour)
+	d := newDaemon(dexcom.NewScheduler(c, syncer, tokens, checkpoints, "uri", 2), time.Minute, log.New(io.Discard, "", 0))
+	d.runOnce(ctx)
+
+	type testcase struct {
+		name         string
+		path         string
+		expectedCode int
+		expectedBody string
+	}
+
+	testcases := []testcase{
+		{name: "healthz", path: "/healthz", expectedCode: http.StatusOK, expectedBody: "ok"},
+		{name: "metrics", path: "/metrics", expectedCode: http.StatusOK, expectedBody: `dexcom_syncd_syncs_total{result="success"} 1`},
+		{name: "client metrics", path: "/metrics", expectedCode: http.StatusOK, expectedBody: `dexcom_requests_total{endpoint="GetEGVs",code="200"} 1`},
+		{name: "status", path: "/status", expectedCode: http.StatusOK, expectedBody: `"userId": "patient"`},
+		{name: "user status", path: "/status/patient", expectedCode: http.StatusOK, expectedBody: `"lastSuccess"`},
+		{name: "unknown user", path: "/status/nobody", expectedCode: http.StatusNotFound, expectedBody: "unknown user"},
+	}
+
+	h := d.handler()
+	for _, test := range testcases {
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, test.path, nil))
+		if w.Code != test.expectedCode {
+			t.Fatalf("[%s] Actual code (%d) did not match expected (%d)", test.name, w.Code, test.expectedCode)
+		}
+		if !strings.Contains(w.Body.String(), test.expectedBody) {
+			t.Fatalf("[%s] Actual body did not contain (%s) | %s", test.name, test.expectedBody, w.Body)
+		}
+	}
+
+	checkpoint, err := checkpoints.GetCheckpoint(ctx, "patient")
+	if err != nil || checkpoint.IsZero() {
+		t.Fatalf("Checkpoint was not saved (%v)", err)
+	}
+
+	// once draining no new syncs start and health checks fail so traffic moves away
+	d.drain()
+	d.runOnce(ctx)
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/healthz", nil))
+	if w.Code != http.StatusServiceUnavailable {
+		t.Fatalf("Actual code (%d) did not match expected (%d)", w.Code, http.StatusServiceUnavailable)
+	}
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	if !strings.Contains(w.Body.String(), `dexcom_syncd_syncs_total{result="success"} 1`) || !strings.Contains(w.Body.String(), `dexcom_syncd_runs_total 2`) {
+		t.Fatalf("Actual metrics did not show a second run that started no syncs | %s", w.Body)
+	}
+}
+
+func TestUnit_Run(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "tokens.json"), []byte("{}"), 0600); err != nil {
+		t.Fatalf("Unexpected error occurred (%v)", err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "many.json"), []byte(`{"a": {"access_token": "a"}, "b": {"access_token": "b"}}`), 0600); err != nil {
+		t.Fatalf("Unexpected error occurred (%v)", err)
+	}
+
+	type testcase struct {
+		name         string
+		args         []string
+		expectedCode int
+	}
+
+	testcases := []testcase{
+		{name: "shuts down", args: []string{"--tokens", filepath.Join(dir, "tokens.json"), "--sink", "jsonl:" + dir, "--listen", "127.0.0.1:0"}},
+		{name: "missing flags", args: []string{"--sink", "jsonl:" + dir}, expectedCode: 2},
+		{name: "bad sink", args: []string{"--tokens", filepath.Join(dir, "tokens.json"), "--sink", "s3:bucket"}, expectedCode: 1},
+		{name: "nightscout without a user", args: []string{"--tokens", filepath.Join(dir, "tokens.json"), "--sink", "nightscout:https://ns.example.com"}, expectedCode: 1},
+		{name: "nightscout with many users", args: []string{"--tokens", filepath.Join(dir, "many.json"), "--sink", "nightscout:https://ns.example.com"}, expectedCode: 1},
+	}
+
+	for _, test := range testcases {
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		stderr := &bytes.Buffer{}
+		if code := run(ctx, test.args, stderr); code != test.expectedCode {
+			t.Fatalf("[%s] Actual code (%d) did not match expected (%d) | %s", test.name, code, test.expectedCode, stderr)
+		}
+	}
+}
+
+func TestUnit_NightscoutSinkSingleUser(t *testing.T) {
+	var uploads int
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		uploads++
+		w.Write([]byte(`{}`))
+	}))
+	defer ts.Close()
+	ctx := context.Background()
+	tokens := dexcom.NewMemoryTokenStore(map[string]*dexcom.UserToken{"patient": &dexcom.UserToken{AccessToken: "a"}})
+	sink, err := newSink(ctx, "nightscout:"+ts.URL, 5*time.Second, tokens)
+	if err != nil {
+		t.Fatalf("Unexpected error occurred (%v)", err)
+	}
+
+	egvs := []dexcom.EGV{dexcom.EGV{SystemTime: "2017-06-16T15:40:00", Value: 119}}
+	if err := sink.UpsertEGVs(ctx, "patient", egvs); err != nil {
+		t.Fatalf("Unexpected error occurred (%#v)", err)
+	}
+	// a user added to the token file after start up is refused rather than uploaded to the first patient's site
+	tokens.SaveToken(ctx, "other", &dexcom.UserToken{AccessToken: "b"})
+	if err := sink.UpsertEGVs(ctx, "other", egvs); err == nil || err.Code() != dexcom.ErrorStorage {
+		t.Fatalf("Actual error (%v) did not match expected (%s)", err, dexcom.ErrorStorage)
+	}
+	if uploads != 1 {
+		t.Fatalf("Actual uploads (%d) did not match expected (1)", uploads)
+	}
+}
@@ -0,0 +1,210 @@
+// Command dexcom-syncd keeps a local copy of many users' dexcom data current.  Every interval it syncs each user in a
+// token file into a sink, picking up from the checkpoints saved by the previous run, and serves /healthz, /metrics and
+// /status for monitoring.
+//
+//	dexcom-syncd --tokens /var/lib/dexcom/tokens.json --sink jsonl:/var/lib/dexcom/data --interval 5m
+//
+// On SIGTERM it stops starting new syncs and waits up to --grace for those in flight to finish.
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/healthimation/go-dexcom/dexcom"
+	"github.com/healthimation/go-dexcom/dexcom/nightscout"
+	"github.com/healthimation/go-glitch/glitch"
+)
+
+// environment variables holding secrets, so they stay out of the process list
+const (
+	envClientID        = "DEXCOM_CLIENT_ID"
+	envClientSecret    = "DEXCOM_CLIENT_SECRET"
+	envNightscoutToken = "NIGHTSCOUT_API_SECRET"
+)
+
+type options struct {
+	tokens      string
+	checkpoints string
+	sink        string
+	baseURL     string
+	redirectURI string
+	listen      string
+	interval    time.Duration
+	grace       time.Duration
+	timeout     time.Duration
+	overlap     time.Duration
+	lookback    time.Duration
+	concurrency int
+}
+
+func main() {
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGTERM, os.Interrupt)
+	defer stop()
+	os.Exit(run(ctx, os.Args[1:], os.Stderr))
+}
+
+// run runs the daemon until ctx is done and returns the exit code
+func run(ctx context.Context, args []string, stderr io.Writer) int {
+	logger := log.New(stderr, "dexcom-syncd ", log.LstdFlags)
+	opts := options{}
+	fs := flag.NewFlagSet("dexcom-syncd", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	fs.StringVar(&opts.tokens, "tokens", "", "json file of user id to token, refreshed tokens are written back")
+	fs.StringVar(&opts.checkpoints, "checkpoints", "", "json file of sync checkpoints, defaults to checkpoints.json next to --tokens")
+	fs.StringVar(&opts.sink, "sink", "", "where to sync to, jsonl:<dir> or nightscout:<site url> with $"+envNightscoutToken)
+	fs.StringVar(&opts.baseURL, "base-url", dexcom.BaseURL, "dexcom api base url")
+	fs.StringVar(&opts.redirectURI, "redirect-uri", "", "redirect uri the tokens were issued for, used to refresh them")
+	fs.StringVar(&opts.listen, "listen", ":8080", "address to serve /healthz, /metrics and /status on")
+	fs.DurationVar(&opts.interval, "interval", 5*time.Minute, "time between sync runs")
+	fs.DurationVar(&opts.grace, "grace", time.Minute, "how long to wait for in flight syncs on shutdown")
+	fs.DurationVar(&opts.timeout, "timeout", 30*time.Second, "timeout of each api request")
+	fs.DurationVar(&opts.overlap, "overlap", time.Hour, "how far before the checkpoint to re-sync, to pick up late uploads")
+	fs.DurationVar(&opts.lookback, "lookback", 30*24*time.Hour, "how far back to sync users that have never been synced")
+	fs.IntVar(&opts.concurrency, "concurrency", 4, "users to sync at once")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if opts.tokens == "" || opts.sink == "" {
+		fmt.Fprintln(stderr, "dexcom-syncd: --tokens and --sink are required")
+		fs.Usage()
+		return 2
+	}
+	if opts.checkpoints == "" {
+		opts.checkpoints = filepath.Join(filepath.Dir(opts.tokens), "checkpoints.json")
+	}
+
+	tokens := dexcom.NewFileTokenStore(opts.tokens)
+	sink, err := newSink(ctx, opts.sink, opts.timeout, tokens)
+	if err != nil {
+		logger.Printf("%v", err)
+		return 1
+	}
+	c := dexcom.NewClientWithBaseURL(opts.baseURL, os.Getenv(envClientID), os.Getenv(envClientSecret), opts.timeout)
+	checkpoints := dexcom.NewFileCheckpointStore(opts.checkpoints)
+	syncer := dexcom.NewSyncer(c, sink, checkpoints, opts.overlap, opts.lookback)
+	d := newDaemon(dexcom.NewScheduler(c, syncer, tokens, checkpoints, opts.redirectURI, opts.concurrency), opts.interval, logger)
+
+	ln, err := net.Listen("tcp", opts.listen)
+	if err != nil {
+		logger.Printf("could not listen on %s: %v", opts.listen, err)
+		return 1
+	}
+	srv := &http.Server{Handler: d.handler(), ReadHeaderTimeout: 10 * time.Second}
+	go func() {
+		if err := srv.Serve(ln); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			logger.Printf("http server failed: %v", err)
+		}
+	}()
+	logger.Printf("serving on %s, syncing every %s", ln.Addr(), opts.interval)
+
+	// syncs run on their own context so a signal lets them finish, it is only canceled once the grace period is up
+	syncCtx, cancelSyncs := context.WithCancel(context.Background())
+	defer cancelSyncs()
+	done := make(chan struct{})
+	go func() {
+		d.loop(syncCtx, ctx)
+		close(done)
+	}()
+
+	<-ctx.Done()
+	logger.Printf("shutting down, waiting up to %s for in flight syncs", opts.grace)
+	d.drain()
+	select {
+	case <-done:
+	case <-time.After(opts.grace):
+		logger.Printf("grace period is up, canceling in flight syncs")
+		cancelSyncs()
+		<-done
+	}
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	srv.Shutdown(shutdownCtx)
+	logger.Printf("stopped")
+	return 0
+}
+
+// newSink parses a --sink spec.  A nightscout site belongs to one patient, so the nightscout sink needs tokens to hold
+// exactly one user and refuses any other user added later.
+func newSink(ctx context.Context, spec string, timeout time.Duration, tokens dexcom.TokenStore) (dexcom.Sink, error) {
+	kind, target, _ := strings.Cut(spec, ":")
+	switch {
+	case kind == "jsonl" && target != "":
+		return dexcom.NewJSONLSink(target), nil
+	case kind == "nightscout" && target != "":
+		users, err := tokens.ListUsers(ctx)
+		if err != nil {
+			return nil, err
+		}
+		if len(users) != 1 {
+			return nil, fmt.Errorf("the nightscout sink uploads to a single patient's site, --tokens must hold exactly one user but holds %d", len(users))
+		}
+		u, err := nightscout.NewUploader(target, os.Getenv(envNightscoutToken), timeout)
+		if err != nil {
+			return nil, err
+		}
+		return &singleUserSink{Sink: nightscout.NewSink(u, ""), userID: users[0]}, nil
+	}
+	return nil, fmt.Errorf("unknown --sink %q, use jsonl:<dir> or nightscout:<site url>", spec)
+}
+
+// singleUserSink passes one user's records to a sink and refuses everyone else's
+type singleUserSink struct {
+	dexcom.Sink
+	userID string
+}
+
+func (s *singleUserSink) check(userID string) glitch.DataError {
+	if userID != s.userID {
+		return glitch.NewDataError(fmt.Errorf("user %q is not %q", userID, s.userID), dexcom.ErrorStorage, "The sink only accepts a single user")
+	}
+	return nil
+}
+
+func (s *singleUserSink) UpsertEGVs(ctx context.Context, userID string, egvs []dexcom.EGV) glitch.DataError {
+	if err := s.check(userID); err != nil {
+		return err
+	}
+	return s.Sink.UpsertEGVs(ctx, userID, egvs)
+}
+
+func (s *singleUserSink) UpsertEvents(ctx context.Context, userID string, events []dexcom.Event) glitch.DataError {
+	if err := s.check(userID); err != nil {
+		return err
+	}
+	return s.Sink.UpsertEvents(ctx, userID, events)
+}
+
+func (s *singleUserSink) UpsertDevices(ctx context.Context, userID string, devices []dexcom.Device) glitch.DataError {
+	if err := s.check(userID); err != nil {
+		return err
+	}
+	return s.Sink.UpsertDevices(ctx, userID, devices)
+}
+
+func (s *singleUserSink) UpsertCalibrations(ctx context.Context, userID string, calibrations []dexcom.Calibration) glitch.DataError {
+	if err := s.check(userID); err != nil {
+		return err
+	}
+	return s.Sink.UpsertCalibrations(ctx, userID, calibrations)
+}
+
+func (s *singleUserSink) UpsertStatistics(ctx context.Context, userID string, startDate, endDate time.Time, stats *dexcom.Statistics) glitch.DataError {
+	if err := s.check(userID); err != nil {
+		return err
+	}
+	return s.Sink.UpsertStatistics(ctx, userID, startDate, endDate, stats)
+}
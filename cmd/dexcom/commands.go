@@ -0,0 +1,299 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"github.com/healthimation/go-dexcom/dexcom"
+	"github.com/healthimation/go-dexcom/dexcom/fhir"
+	"github.com/healthimation/go-glitch/glitch"
+)
+
+// layouts accepted by --start and --end, times without an offset are local
+var timeLayouts = []string{
+	time.RFC3339,
+	"2006-01-02T15:04:05",
+	"2006-01-02T15:04",
+	"2006-01-02",
+}
+
+// dateRange holds the --start and --end flags
+type dateRange struct {
+	start string
+	end   string
+}
+
+func (r *dateRange) register(fs *flag.FlagSet) {
+	fs.StringVar(&r.start, "start", "24h", "start of the range, a date, a time or a duration before --end, e.g. 72h")
+	fs.StringVar(&r.end, "end", "", "end of the range, a date or a time, defaults to now")
+}
+
+// times resolves the range against now
+func (r *dateRange) times(now time.Time) (time.Time, time.Time, error) {
+	end := now
+	if r.end != "" {
+		t, err := parseTime(r.end)
+		if err != nil {
+			return time.Time{}, time.Time{}, fmt.Errorf("bad --end: %w", err)
+		}
+		end = t
+	}
+	var start time.Time
+	if d, err := time.ParseDuration(r.start); err == nil {
+		start = end.Add(-d)
+	} else if start, err = parseTime(r.start); err != nil {
+		return time.Time{}, time.Time{}, fmt.Errorf("bad --start: %w", err)
+	}
+	if !start.Before(end) {
+		return time.Time{}, time.Time{}, fmt.Errorf("--start must be before --end")
+	}
+	if end.Sub(start) > dexcom.MaxRange {
+		return time.Time{}, time.Time{}, fmt.Errorf("the api returns at most %d days at a time", int(dexcom.MaxRange.Hours()/24))
+	}
+	return start, end, nil
+}
+
+func parseTime(value string) (time.Time, error) {
+	for _, layout := range timeLayouts {
+		if t, err := time.ParseInLocation(layout, value, time.Local); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("unrecognized time %q, use e.g. 2017-06-16 or 2017-06-16T08:00", value)
+}
+
+// parse parses command flags, the flag set has already reported any error
+func parse(fs *flag.FlagSet, args []string) error {
+	if err := fs.Parse(args); err != nil {
+		return flag.ErrHelp
+	}
+	if fs.NArg() > 0 {
+		fmt.Fprintf(fs.Output(), "unexpected argument %q\n", fs.Arg(0))
+		fs.Usage()
+		return flag.ErrHelp
+	}
+	return nil
+}
+
+// fetchCommand runs a command that fetches one thing for a range and prints it as json
+func fetchCommand(ctx context.Context, a *app, name string, args []string, extra func(*flag.FlagSet), fetch func(ctx context.Context, c dexcom.Client, token string, start, end time.Time) (interface{}, error)) error {
+	fs := a.flagSet(name)
+	r := &dateRange{}
+	r.register(fs)
+	if extra != nil {
+		extra(fs)
+	}
+	if err := parse(fs, args); err != nil {
+		return err
+	}
+	start, end, err := r.times(a.now())
+	if err != nil {
+		return err
+	}
+	token, err := a.accessToken(ctx)
+	if err != nil {
+		return err
+	}
+	ret, err := fetch(ctx, a.client(), token, start, end)
+	if err != nil {
+		return err
+	}
+	return writeJSON(a.stdout, ret)
+}
+
+func runEGVs(ctx context.Context, a *app, args []string) error {
+	return fetchCommand(ctx, a, "egvs", args, nil, func(ctx context.Context, c dexcom.Client, token string, start, end time.Time) (interface{}, error) {
+		return asError(c.GetEGVs(ctx, token, start, end))
+	})
+}
+
+func runEvents(ctx context.Context, a *app, args []string) error {
+	return fetchCommand(ctx, a, "events", args, nil, func(ctx context.Context, c dexcom.Client, token string, start, end time.Time) (interface{}, error) {
+		return asError(c.GetEvents(ctx, token, start, end))
+	})
+}
+
+func runDevices(ctx context.Context, a *app, args []string) error {
+	return fetchCommand(ctx, a, "devices", args, nil, func(ctx context.Context, c dexcom.Client, token string, start, end time.Time) (interface{}, error) {
+		return asError(c.GetDevices(ctx, token, start, end))
+	})
+}
+
+func runStats(ctx context.Context, a *app, args []string) error {
+	var low, high float64
+	extra := func(fs *flag.FlagSet) {
+		fs.Float64Var(&low, "low", 70, "bottom of the target range")
+		fs.Float64Var(&high, "high", 180, "top of the target range")
+	}
+	return fetchCommand(ctx, a, "stats", args, extra, func(ctx context.Context, c dexcom.Client, token string, start, end time.Time) (interface{}, error) {
+		return asError(c.GetStatistics(ctx, token, start, end, statRequest(start, end, low, high)))
+	})
+}
+
+func statRequest(start, end time.Time, low, high float64) map[string][]dexcom.StatRequest {
+	return map[string][]dexcom.StatRequest{
+		"targetRanges": []dexcom.StatRequest{
+			dexcom.StatRequest{Name: "day", StartTime: start, EndTime: end, EGVRange: dexcom.MinMax{Min: low, Max: high}},
+		},
+	}
+}
+
+// export is everything fetched for an export
+type export struct {
+	Devices      *dexcom.DeviceResponse      `json:"devices"`
+	EGVs         *dexcom.EGVResponse         `json:"egvs"`
+	Events       *dexcom.EventResponse       `json:"events"`
+	Calibrations *dexcom.CalibrationResponse `json:"calibrations"`
+	Statistics   *dexcom.Statistics          `json:"statistics,omitempty"`
+}
+
+func runExport(ctx context.Context, a *app, args []string) error {
+	fs := a.flagSet("export")
+	r := &dateRange{}
+	r.register(fs)
+	format := fs.String("format", "json", "csv, json or fhir")
+	output := fs.String("output", "", "file to write, defaults to stdout")
+	unit := fs.String("unit", dexcom.UnitMgDL, "glucose unit of csv exports, mg/dL or mmol/L")
+	tz := fs.String("tz", "", "time zone of csv timestamps, e.g. America/Denver, defaults to the device's clock")
+	patient := fs.String("patient", "", "fhir reference of the patient, e.g. Patient/123")
+	if err := parse(fs, args); err != nil {
+		return err
+	}
+	if *format != "csv" && *format != "json" && *format != "fhir" {
+		return fmt.Errorf("unknown --format %q, use csv, json or fhir", *format)
+	}
+	var loc *time.Location
+	if *tz != "" {
+		l, err := time.LoadLocation(*tz)
+		if err != nil {
+			return fmt.Errorf("bad --tz: %w", err)
+		}
+		loc = l
+	}
+	start, end, err := r.times(a.now())
+	if err != nil {
+		return err
+	}
+	token, err := a.accessToken(ctx)
+	if err != nil {
+		return err
+	}
+
+	e, err := a.fetchExport(ctx, token, start, end, *format == "fhir")
+	if err != nil {
+		return err
+	}
+
+	if *output == "" {
+		return writeExport(a.stdout, e, *format, *unit, loc, *patient, start, end)
+	}
+	// exports are health data, keep them private
+	f, err := os.OpenFile(*output, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+	if err != nil {
+		return fmt.Errorf("could not create %s: %w", *output, err)
+	}
+	if err := writeExport(f, e, *format, *unit, loc, *patient, start, end); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+func writeExport(w io.Writer, e *export, format, unit string, loc *time.Location, patient string, start, end time.Time) error {
+	switch format {
+	case "csv":
+		cw := dexcom.NewCSVWriter(w, dexcom.CSVOptions{Unit: unit, Location: loc})
+		if err := cw.WriteDevices(e.Devices); err != nil {
+			return err
+		}
+		if err := cw.WriteEGVs(e.EGVs); err != nil {
+			return err
+		}
+		if err := cw.WriteEvents(e.Events); err != nil {
+			return err
+		}
+		if err := cw.WriteCalibrations(e.Calibrations); err != nil {
+			return err
+		}
+		if err := cw.Flush(); err != nil {
+			return err
+		}
+		return nil
+	case "fhir":
+		bundle, err := fhirBundle(e, patient, start, end)
+		if err != nil {
+			return err
+		}
+		return writeJSON(w, bundle)
+	}
+	return writeJSON(w, e)
+}
+
+func (a *app) fetchExport(ctx context.Context, token string, start, end time.Time, stats bool) (*export, error) {
+	c := a.client()
+	e := &export{}
+	var err error
+	if e.Devices, err = asError(c.GetDevices(ctx, token, start, end)); err != nil {
+		return nil, err
+	}
+	if e.EGVs, err = asError(c.GetEGVs(ctx, token, start, end)); err != nil {
+		return nil, err
+	}
+	if e.Events, err = asError(c.GetEvents(ctx, token, start, end)); err != nil {
+		return nil, err
+	}
+	if e.Calibrations, err = asError(dexcom.GetCalibrations(ctx, c, token, start, end)); err != nil {
+		return nil, err
+	}
+	if stats {
+		if e.Statistics, err = asError(c.GetStatistics(ctx, token, start, end, statRequest(start, end, 70, 180))); err != nil {
+			return nil, err
+		}
+	}
+	return e, nil
+}
+
+func fhirBundle(e *export, patient string, start, end time.Time) (*fhir.Bundle, error) {
+	var subject *fhir.Reference
+	if patient != "" {
+		subject = &fhir.Reference{Reference: patient}
+	}
+	bundle := fhir.NewBundle()
+	var device *fhir.Reference
+	if e.Devices != nil && len(e.Devices.Devices) > 0 {
+		d := fhir.DeviceResource(e.Devices.Devices[0], subject)
+		fhir.Add(bundle, d)
+		device = fhir.ReferenceTo(d)
+	}
+	observations, err := fhir.EGVObservations(e.EGVs, subject, device)
+	if err != nil {
+		return nil, err
+	}
+	fhir.Add(bundle, observations...)
+	if observations, err = fhir.CalibrationObservations(e.Calibrations, subject, device); err != nil {
+		return nil, err
+	}
+	fhir.Add(bundle, observations...)
+	unit := dexcom.UnitMgDL
+	if e.EGVs != nil && e.EGVs.Unit != "" {
+		unit = e.EGVs.Unit
+	}
+	fhir.Add(bundle, fhir.SummaryObservations(e.Statistics, unit, start, end, subject)...)
+	return bundle, nil
+}
+
+// asError adapts a client result to a plain error
+func asError[T any](v T, err glitch.DataError) (T, error) {
+	return v, err
+}
+
+func writeJSON(w io.Writer, v interface{}) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(v)
+}
@@ -0,0 +1,124 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/healthimation/go-dexcom/dexcom"
+)
+
+// environment variables that override the config file
+const (
+	envConfig       = "DEXCOM_CONFIG"
+	envClientID     = "DEXCOM_CLIENT_ID"
+	envClientSecret = "DEXCOM_CLIENT_SECRET"
+)
+
+// config is what the cli remembers between runs.  It holds a client secret and a refresh token so it is written with
+// owner only permissions.
+type config struct {
+	ClientID     string            `json:"clientId"`
+	ClientSecret string            `json:"clientSecret"`
+	BaseURL      string            `json:"baseUrl"`
+	RedirectURI  string            `json:"redirectUri"`
+	Token        *dexcom.UserToken `json:"token,omitempty"`
+}
+
+func defaultConfigPath() string {
+	if path := os.Getenv(envConfig); path != "" {
+		return path
+	}
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		dir = "."
+	}
+	return filepath.Join(dir, "dexcom", "config.json")
+}
+
+// loadConfig reads the config at path, a missing file is an empty config
+func loadConfig(path string) (*config, error) {
+	cfg := &config{}
+	by, err := os.ReadFile(path)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("could not read config: %w", err)
+	}
+	if err == nil {
+		if err := json.Unmarshal(by, cfg); err != nil {
+			return nil, fmt.Errorf("could not parse config %s: %w", path, err)
+		}
+	}
+	if id := os.Getenv(envClientID); id != "" {
+		cfg.ClientID = id
+	}
+	if secret := os.Getenv(envClientSecret); secret != "" {
+		cfg.ClientSecret = secret
+	}
+	if cfg.BaseURL == "" {
+		cfg.BaseURL = dexcom.BaseURL
+	}
+	return cfg, nil
+}
+
+// save writes the config through a temp file so a failed write never loses the refresh token
+func (c *config) save(path string) error {
+	by, err := json.MarshalIndent(c, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return fmt.Errorf("could not create config dir: %w", err)
+	}
+	f, err := os.CreateTemp(filepath.Dir(path), ".config-*")
+	if err != nil {
+		return fmt.Errorf("could not write config: %w", err)
+	}
+	defer os.Remove(f.Name())
+	_, err = f.Write(append(by, '\n'))
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Rename(f.Name(), path)
+	}
+	if err != nil {
+		return fmt.Errorf("could not write config: %w", err)
+	}
+	return nil
+}
+
+func (a *app) client() dexcom.Client {
+	return dexcom.NewClientWithBaseURL(a.cfg.BaseURL, a.cfg.ClientID, a.cfg.ClientSecret, a.timeout)
+}
+
+// accessToken returns the saved access token, refreshing and saving it first when it has expired
+func (a *app) accessToken(ctx context.Context) (string, error) {
+	if a.cfg.Token == nil {
+		return "", errors.New("not logged in, run dexcom login first")
+	}
+	if a.cfg.Token.ExpireTime != nil && a.now().Before(*a.cfg.Token.ExpireTime) {
+		return a.cfg.Token.AccessToken, nil
+	}
+	if err := a.refresh(ctx); err != nil {
+		return "", err
+	}
+	return a.cfg.Token.AccessToken, nil
+}
+
+func (a *app) refresh(ctx context.Context) error {
+	if a.cfg.Token == nil || a.cfg.Token.RefreshToken == "" {
+		return errors.New("not logged in, run dexcom login first")
+	}
+	token, err := a.client().RefreshUser(ctx, a.cfg.Token.RefreshToken, a.cfg.RedirectURI)
+	if err != nil {
+		if err.Code() == dexcom.ErrorInvalidGrant {
+			return fmt.Errorf("the saved token was revoked or has expired, run dexcom login again: %w", err)
+		}
+		return err
+	}
+	a.cfg.Token = token
+	return a.cfg.save(a.configPath)
+}
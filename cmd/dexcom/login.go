@@ -0,0 +1,157 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"os/exec"
+	"runtime"
+	"time"
+
+	"github.com/healthimation/go-dexcom/dexcom"
+)
+
+const defaultRedirectURI = "http://localhost:8765/callback"
+
+// openBrowser opens u in the user's browser, tests replace it to play the part of the user
+var openBrowser = func(u string) error {
+	switch runtime.GOOS {
+	case "darwin":
+		return exec.Command("open", u).Start()
+	case "windows":
+		return exec.Command("rundll32", "url.dll,FileProtocolHandler", u).Start()
+	}
+	return exec.Command("xdg-open", u).Start()
+}
+
+// callback is what the redirect server received
+type callback struct {
+	code string
+	err  error
+}
+
+func runLogin(ctx context.Context, a *app, args []string) error {
+	fs := a.flagSet("login")
+	clientID := fs.String("client-id", a.cfg.ClientID, "oauth client id, or $"+envClientID)
+	clientSecret := fs.String("client-secret", a.cfg.ClientSecret, "oauth client secret, or $"+envClientSecret)
+	sandbox := fs.Bool("sandbox", false, "use the dexcom sandbox api")
+	baseURL := fs.String("base-url", "", "api base url, overrides --sandbox")
+	redirectURI := fs.String("redirect-uri", defaultRedirectURI, "loopback redirect uri registered for the client")
+	wait := fs.Duration("wait", 5*time.Minute, "how long to wait for the browser sign in")
+	if err := parse(fs, args); err != nil {
+		return err
+	}
+
+	a.cfg.ClientID = *clientID
+	a.cfg.ClientSecret = *clientSecret
+	switch {
+	case *baseURL != "":
+		a.cfg.BaseURL = *baseURL
+	case *sandbox:
+		a.cfg.BaseURL = dexcom.SandboxBaseURL
+	}
+	if a.cfg.ClientID == "" || a.cfg.ClientSecret == "" {
+		return errors.New("--client-id and --client-secret are required")
+	}
+
+	redirect, err := url.Parse(*redirectURI)
+	if err != nil || redirect.Scheme != "http" || !isLoopback(redirect.Hostname()) {
+		return fmt.Errorf("--redirect-uri must be an http url on localhost, got %q", *redirectURI)
+	}
+	ln, err := net.Listen("tcp", redirect.Host)
+	if err != nil {
+		return fmt.Errorf("could not listen for the redirect: %w", err)
+	}
+	if redirect.Port() == "0" {
+		redirect.Host = ln.Addr().String()
+	}
+
+	state, err := randomState()
+	if err != nil {
+		ln.Close()
+		return err
+	}
+	callbacks := make(chan callback, 1)
+	mux := http.NewServeMux()
+	mux.HandleFunc(redirect.Path, func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+		if q.Get("state") != state {
+			http.Error(w, "Unexpected state, start the login again.", http.StatusBadRequest)
+			return
+		}
+		cb := callback{code: q.Get("code")}
+		if e := q.Get("error"); e != "" {
+			cb.err = fmt.Errorf("sign in failed: %s %s", e, q.Get("error_description"))
+			http.Error(w, "Sign in failed, you can close this window.", http.StatusBadRequest)
+		} else {
+			fmt.Fprintln(w, "Signed in to dexcom, you can close this window.")
+		}
+		select {
+		case callbacks <- cb:
+		default:
+		}
+	})
+	srv := &http.Server{Handler: mux, ReadHeaderTimeout: 10 * time.Second}
+	go srv.Serve(ln)
+	defer srv.Close()
+
+	loginURL := dexcom.LoginURL(a.cfg.BaseURL, a.cfg.ClientID, redirect.String(), state)
+	fmt.Fprintf(a.stderr, "Open this url in a browser to sign in:\n\n  %s\n\n", loginURL)
+	openBrowser(loginURL)
+
+	ctx, cancel := context.WithTimeout(ctx, *wait)
+	defer cancel()
+	var cb callback
+	select {
+	case cb = <-callbacks:
+	case <-ctx.Done():
+		return errors.New("gave up waiting for the browser sign in")
+	}
+	if cb.err != nil {
+		return cb.err
+	}
+
+	token, derr := a.client().GetUser(ctx, cb.code, redirect.String())
+	if derr != nil {
+		return derr
+	}
+	a.cfg.RedirectURI = redirect.String()
+	a.cfg.Token = token
+	if err := a.cfg.save(a.configPath); err != nil {
+		return err
+	}
+	fmt.Fprintf(a.stdout, "Logged in, token saved to %s\n", a.configPath)
+	return nil
+}
+
+func runRefresh(ctx context.Context, a *app, args []string) error {
+	if err := parse(a.flagSet("refresh"), args); err != nil {
+		return err
+	}
+	if err := a.refresh(ctx); err != nil {
+		return err
+	}
+	fmt.Fprintf(a.stdout, "Token refreshed, expires %s\n", a.cfg.Token.ExpireTime.Format(time.RFC3339))
+	return nil
+}
+
+func isLoopback(host string) bool {
+	if host == "localhost" {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
+
+func randomState() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("could not generate state: %w", err)
+	}
+	return hex.EncodeToString(b), nil
+}
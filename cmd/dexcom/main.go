@@ -0,0 +1,121 @@
+// Command dexcom inspects a patient's dexcom data from the command line.
+//
+//	dexcom login --client-id <id> --client-secret <secret> [--sandbox]
+//	dexcom egvs --start 2017-06-16 --end 2017-06-17
+//	dexcom export --format csv --start 72h --output readings.csv
+//
+// Credentials and the user's token are kept in a config file, $DEXCOM_CONFIG or dexcom/config.json under the user
+// config dir.  Expired tokens are refreshed automatically.
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"os/signal"
+	"sort"
+	"time"
+
+	"github.com/healthimation/go-dexcom/dexcom"
+)
+
+// command is a subcommand, run gets the arguments after its name
+type command struct {
+	usage string
+	run   func(ctx context.Context, a *app, args []string) error
+}
+
+var commands = map[string]command{
+	"login":   {usage: "sign in through a browser and save the token", run: runLogin},
+	"refresh": {usage: "refresh the saved token", run: runRefresh},
+	"egvs":    {usage: "print estimated glucose values", run: runEGVs},
+	"events":  {usage: "print events, e.g. carbs, insulin and exercise", run: runEvents},
+	"devices": {usage: "print devices and their alert settings", run: runDevices},
+	"stats":   {usage: "print glucose statistics", run: runStats},
+	"export":  {usage: "export everything as csv, json or a fhir bundle", run: runExport},
+}
+
+// app is the state shared by every command
+type app struct {
+	stdout     io.Writer
+	stderr     io.Writer
+	configPath string
+	timeout    time.Duration
+	cfg        *config
+	now        func() time.Time
+}
+
+func main() {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	os.Exit(run(ctx, os.Args[1:], os.Stdout, os.Stderr))
+}
+
+// run runs the command in args and returns the exit code
+func run(ctx context.Context, args []string, stdout, stderr io.Writer) int {
+	a := &app{stdout: stdout, stderr: stderr, now: time.Now}
+	fs := flag.NewFlagSet("dexcom", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	fs.StringVar(&a.configPath, "config", defaultConfigPath(), "config file holding credentials and the token")
+	fs.DurationVar(&a.timeout, "timeout", 30*time.Second, "timeout of each api request")
+	verbose := fs.Bool("verbose", false, "log each api request to stderr, with secrets and glucose values redacted")
+	fs.Usage = func() { usage(fs) }
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if fs.NArg() == 0 {
+		usage(fs)
+		return 2
+	}
+	cmd, ok := commands[fs.Arg(0)]
+	if !ok {
+		fmt.Fprintf(stderr, "dexcom: unknown command %q\n", fs.Arg(0))
+		usage(fs)
+		return 2
+	}
+
+	cfg, err := loadConfig(a.configPath)
+	if err != nil {
+		fmt.Fprintf(stderr, "dexcom: %v\n", err)
+		return 1
+	}
+	a.cfg = cfg
+	if *verbose {
+		logger := slog.New(slog.NewTextHandler(stderr, &slog.HandlerOptions{Level: slog.LevelDebug}))
+		ctx = dexcom.WithLogger(ctx, logger, dexcom.LogOptions{Bodies: true})
+	}
+	if err := cmd.run(ctx, a, fs.Args()[1:]); err != nil {
+		if err == flag.ErrHelp {
+			return 2
+		}
+		fmt.Fprintf(stderr, "dexcom %s: %v\n", fs.Arg(0), err)
+		return 1
+	}
+	return 0
+}
+
+func usage(fs *flag.FlagSet) {
+	out := fs.Output()
+	fmt.Fprintln(out, "usage: dexcom [flags] <command> [command flags]")
+	fmt.Fprintln(out, "\ncommands:")
+	names := make([]string, 0, len(commands))
+	for name := range commands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		fmt.Fprintf(out, "  %-8s %s\n", name, commands[name].usage)
+	}
+	fmt.Fprintln(out, "\nflags:")
+	fs.PrintDefaults()
+}
+
+// flagSet returns a flag set for a command that reports errors to stderr
+func (a *app) flagSet(name string) *flag.FlagSet {
+	fs := flag.NewFlagSet("dexcom "+name, flag.ContinueOnError)
+	fs.SetOutput(a.stderr)
+	return fs
+}
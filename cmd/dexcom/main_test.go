@@ -0,0 +1,103 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/url"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/healthimation/go-dexcom/dexcom/dexcomtest"
+)
+
+// login logs in to s as userID through the cli, with the test playing the part of the browser
+func login(t *testing.T, s *dexcomtest.Server, userID, configPath string) {
+	openBrowser = func(u string) error {
+		login, _ := url.Parse(u)
+		redirect, _ := url.Parse(login.Query().Get("redirect_uri"))
+		q := url.Values{}
+		q.Set("code", s.AuthorizationCode(userID))
+		q.Set("state", login.Query().Get("state"))
+		redirect.RawQuery = q.Encode()
+		go func() {
+			resp, err := http.Get(redirect.String())
+			if err == nil {
+				resp.Body.Close()
+			}
+		}()
+		return nil
+	}
+	stdout, stderr := &bytes.Buffer{}, &bytes.Buffer{}
+	code := run(context.Background(), []string{"--config", configPath, "login", "--client-id", "id", "--client-secret", "secret",
+		"--base-url", s.URL, "--redirect-uri", "http://127.0.0.1:0/callback", "--wait", "5s"}, stdout, stderr)
+	if code != 0 {
+		t.Fatalf("Login failed with %d (%s)", code, stderr)
+	}
+}
+
+func TestUnit_Run(t *testing.T) {
+	s := dexcomtest.NewServer("id", "secret")
+	defer s.Close()
+	start := time.Date(2017, 6, 16, 0, 0, 0, 0, time.UTC)
+	s.Seed("patient", dexcomtest.Generate(dexcomtest.DefaultGeneratorConfig(1, start, 48*time.Hour)))
+
+	dir := t.TempDir()
+	configPath := filepath.Join(dir, "config.json")
+	login(t, s, "patient", configPath)
+	cfg, err := loadConfig(configPath)
+	if err != nil || cfg.Token == nil || cfg.BaseURL != s.URL {
+		t.Fatalf("Token was not saved (%v)", err)
+	}
+
+	expired := filepath.Join(dir, "expired.json")
+	past := time.Now().Add(-time.Minute)
+	cfg.Token.ExpireTime = &past
+	if err := cfg.save(expired); err != nil {
+		t.Fatalf("Unexpected error occurred (%v)", err)
+	}
+
+	type testcase struct {
+		name           string
+		args           []string
+		expectedCode   int
+		expectedOutput string
+	}
+
+	rng := []string{"--start", "2017-06-16T00:00:00Z", "--end", "2017-06-17T00:00:00Z"}
+	testcases := []testcase{
+		{name: "egvs", args: append([]string{"--config", configPath, "egvs"}, rng...), expectedOutput: `"egvs": [`},
+		{name: "events", args: append([]string{"--config", configPath, "events"}, rng...), expectedOutput: `"eventType": "carbs"`},
+		{name: "devices", args: append([]string{"--config", configPath, "devices"}, rng...), expectedOutput: `"alertSettings"`},
+		{name: "stats", args: append([]string{"--config", configPath, "stats", "--low", "80"}, rng...), expectedOutput: `"percentWithinRange"`},
+		{name: "export json", args: append([]string{"--config", configPath, "export"}, rng...), expectedOutput: `"calibrations": {`},
+		{name: "export csv", args: append([]string{"--config", configPath, "export", "--format", "csv"}, rng...), expectedOutput: "Index,Timestamp (YYYY-MM-DDThh:mm:ss)"},
+		{name: "export fhir", args: append([]string{"--config", configPath, "export", "--format", "fhir", "--patient", "Patient/1"}, rng...), expectedOutput: `"resourceType": "Bundle"`},
+		{name: "expired token is refreshed", args: append([]string{"--config", expired, "egvs"}, rng...), expectedOutput: `"egvs": [`},
+		{name: "refresh", args: []string{"--config", expired, "refresh"}, expectedOutput: "Token refreshed"},
+		{name: "not logged in", args: []string{"--config", filepath.Join(dir, "missing.json"), "egvs"}, expectedCode: 1},
+		{name: "range too long", args: []string{"--config", configPath, "egvs", "--start", "2017-01-01", "--end", "2017-06-01"}, expectedCode: 1},
+		{name: "bad format", args: []string{"--config", configPath, "export", "--format", "xml"}, expectedCode: 1},
+		{name: "bad flag", args: []string{"--config", configPath, "egvs", "--nope"}, expectedCode: 2},
+		{name: "unknown command", args: []string{"--config", configPath, "nope"}, expectedCode: 2},
+		{name: "no command", args: []string{}, expectedCode: 2},
+	}
+
+	for _, test := range testcases {
+		stdout, stderr := &bytes.Buffer{}, &bytes.Buffer{}
+		code := run(context.Background(), test.args, stdout, stderr)
+		if code != test.expectedCode {
+			t.Fatalf("[%s] Actual code (%d) did not match expected (%d) | %s", test.name, code, test.expectedCode, stderr)
+		}
+		if !strings.Contains(stdout.String(), test.expectedOutput) {
+			t.Fatalf("[%s] Actual output did not contain (%s) | %s", test.name, test.expectedOutput, stdout)
+		}
+	}
+
+	refreshed, err := loadConfig(expired)
+	if err != nil || !refreshed.Token.ExpireTime.After(time.Now()) {
+		t.Fatalf("Refreshed token was not saved (%v)", err)
+	}
+}
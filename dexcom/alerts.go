@@ -0,0 +1,232 @@
+package dexcom
+
+import (
+	"sync"
+	"time"
+
+	"github.com/healthimation/go-glitch/glitch"
+)
+
+// AlertSetting.AlertName values the AlertEngine evaluates
+const (
+	AlertHigh          = "high"
+	AlertLow           = "low"
+	AlertUrgentLow     = "urgentLow"
+	AlertUrgentLowSoon = "urgentLowSoon"
+	AlertRise          = "rise"
+	AlertFall          = "fall"
+	// AlertFixedLow is what the v1 api calls the urgent low alert, the engine reports it as AlertUrgentLow
+	AlertFixedLow = "fixedLow"
+)
+
+// UrgentLowSoonHorizon is how far ahead the urgent low soon alert looks
+const UrgentLowSoonHorizon = 20 * time.Minute
+
+// readings further apart than this are not used to work out a missing trend rate
+const maxRateGap = 15 * time.Minute
+
+// AlertState is the state of one alert rule
+type AlertState string
+
+// Alert states
+const (
+	// AlertStateInactive means the rule's condition is not met
+	AlertStateInactive AlertState = "inactive"
+	// AlertStatePending means the condition is met but has not yet lasted the rule's Delay
+	AlertStatePending AlertState = "pending"
+	// AlertStateActive means the alert is sounding
+	AlertStateActive AlertState = "active"
+)
+
+// AlertEvent is a change in an alert's state, or an active alert sounding again once its Snooze is over
+type AlertEvent struct {
+	AlertName string     `json:"alertName"`
+	Previous  AlertState `json:"previous"`
+	State     AlertState `json:"state"`
+	// Repeat is set when an active alert sounds again after its snooze
+	Repeat bool      `json:"repeat"`
+	Time   time.Time `json:"time"`
+	EGV    EGV       `json:"egv"`
+}
+
+// AlertEngine evaluates alert rules against a stream of readings
+type AlertEngine interface {
+	// Evaluate takes the next reading, in time order, and returns the alert events it causes
+	Evaluate(egv EGV) ([]AlertEvent, glitch.DataError)
+	// States returns the current state of each rule by alert name
+	States() map[string]AlertState
+}
+
+type alertRule struct {
+	setting   AlertSetting
+	threshold float64
+	delay     time.Duration
+	snooze    time.Duration
+	state     AlertState
+	since     time.Time
+	lastAlert time.Time
+}
+
+type alertEngine struct {
+	mu    sync.Mutex
+	rules []*alertRule
+	last  *EGV
+	lastT time.Time
+}
+
+// NewAlertEngine returns an AlertEngine for rules, e.g. a device's AlertSettings, evaluated against readings in unit
+// (mg/dL when empty).  Rule values are converted from their own unit.  fixedLow rules are evaluated and reported as
+// urgentLow.  Disabled rules and alerts other than high, low, urgentLow, urgentLowSoon, rise and fall are ignored.
+//
+// A rule's Delay is how many minutes its condition must last before it first sounds, and its Snooze how many minutes
+// an active alert waits before sounding again.  A Snooze of zero never repeats.
+func NewAlertEngine(rules []AlertSetting, unit string) AlertEngine {
+	if unit == "" {
+		unit = UnitMgDL
+	}
+	e := &alertEngine{}
+	for _, setting := range rules {
+		if !setting.Enabled {
+			continue
+		}
+		switch setting.AlertName {
+		case AlertFixedLow:
+			setting.AlertName = AlertUrgentLow
+		case AlertHigh, AlertLow, AlertUrgentLow, AlertUrgentLowSoon, AlertRise, AlertFall:
+		default:
+			continue
+		}
+		e.rules = append(e.rules, &alertRule{
+			setting:   setting,
+			threshold: ConvertGlucose(setting.Value, setting.Unit, unit),
+			delay:     time.Duration(setting.Delay) * time.Minute,
+			snooze:    time.Duration(setting.Snooze) * time.Minute,
+			state:     AlertStateInactive,
+		})
+	}
+	return e
+}
+
+// CurrentAlertSettings returns the alert settings of the device that uploaded most recently
+func CurrentAlertSettings(devices []Device) []AlertSetting {
+	var ret []AlertSetting
+	var latest time.Time
+	for _, device := range devices {
+		t, err := ParseTime(device.LastUploadDate)
+		if err != nil {
+			continue
+		}
+		if latest.IsZero() || t.After(latest) {
+			ret = device.AlertSettings
+			latest = t
+		}
+	}
+	return ret
+}
+
+func (e *alertEngine) Evaluate(egv EGV) ([]AlertEvent, glitch.DataError) {
+	t, err := ParseTime(egv.SystemTime)
+	if err != nil {
+		return nil, err
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	rate, hasRate := e.rate(egv, t)
+	var events []AlertEvent
+	for _, r := range e.rules {
+		met := r.met(egv, rate, hasRate)
+		event := AlertEvent{AlertName: r.setting.AlertName, Previous: r.state, Time: t, EGV: egv}
+		switch {
+		case !met:
+			if r.state == AlertStateInactive {
+				continue
+			}
+			r.state = AlertStateInactive
+		case r.state == AlertStateInactive:
+			r.since = t
+			r.state = AlertStatePending
+			if r.delay <= 0 {
+				r.state = AlertStateActive
+				r.lastAlert = t
+			}
+		case r.state == AlertStatePending:
+			if t.Sub(r.since) < r.delay {
+				continue
+			}
+			r.state = AlertStateActive
+			r.lastAlert = t
+		default:
+			if r.snooze <= 0 || t.Sub(r.lastAlert) < r.snooze {
+				continue
+			}
+			r.lastAlert = t
+			event.Repeat = true
+		}
+		event.State = r.state
+		events = append(events, event)
+	}
+	e.last = &egv
+	e.lastT = t
+	return events, nil
+}
+
+func (e *alertEngine) States() map[string]AlertState {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	ret := make(map[string]AlertState, len(e.rules))
+	for _, r := range e.rules {
+		ret[r.setting.AlertName] = r.state
+	}
+	return ret
+}
+
+// rate returns the reading's trend rate, or works one out from the previous reading when it has none
+func (e *alertEngine) rate(egv EGV, t time.Time) (float64, bool) {
+	if egv.TrendRate != nil {
+		return *egv.TrendRate, true
+	}
+	if e.last == nil || outOfRange(egv) || outOfRange(*e.last) {
+		return 0, false
+	}
+	gap := t.Sub(e.lastT)
+	if gap <= 0 || gap > maxRateGap {
+		return 0, false
+	}
+	return (egv.Value - e.last.Value) / gap.Minutes(), true
+}
+
+// met reports whether the rule's condition holds for the reading.  Readings beyond the sensor's range count as below
+// every low threshold or above every high one.
+func (r *alertRule) met(egv EGV, rate float64, hasRate bool) bool {
+	status := ""
+	if egv.Status != nil {
+		status = *egv.Status
+	}
+	switch r.setting.AlertName {
+	case AlertHigh:
+		return status == StatusHigh || (status != StatusLow && egv.Value >= r.threshold)
+	case AlertLow, AlertUrgentLow:
+		return status == StatusLow || (status != StatusHigh && egv.Value <= r.threshold)
+	case AlertUrgentLowSoon:
+		if outOfRange(egv) || !hasRate {
+			return false
+		}
+		return egv.Value+rate*UrgentLowSoonHorizon.Minutes() <= r.threshold
+	case AlertRise:
+		return hasRate && rate >= r.threshold
+	case AlertFall:
+		// fall rates may be set as positive or negative values
+		threshold := r.threshold
+		if threshold > 0 {
+			threshold = -threshold
+		}
+		return hasRate && rate <= threshold
+	}
+	return false
+}
+
+// outOfRange reports whether the reading is beyond what the sensor can measure, so its value is not a real reading
+func outOfRange(egv EGV) bool {
+	return egv.Status != nil && (*egv.Status == StatusLow || *egv.Status == StatusHigh)
+}
@@ -0,0 +1,175 @@
+package dexcom
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestUnit_AlertEngine(t *testing.T) {
+	start := time.Date(2017, 6, 16, 12, 0, 0, 0, time.UTC)
+
+	// readings makes one reading every 5 minutes from values, with rates when given
+	readings := func(values []float64, rates ...float64) []EGV {
+		var ret []EGV
+		for i, v := range values {
+			egv := EGV{SystemTime: FormatTime(start.Add(time.Duration(i) * SensorInterval)), Value: v}
+			if i < len(rates) {
+				egv.TrendRate = makeFloat64Ptr(rates[i])
+			}
+			ret = append(ret, egv)
+		}
+		return ret
+	}
+
+	type testcase struct {
+		name     string
+		rules    []AlertSetting
+		unit     string
+		egvs     []EGV
+		expected []string
+	}
+
+	testcases := []testcase{
+		{
+			name:     "high with delay and snooze",
+			rules:    []AlertSetting{{AlertName: AlertHigh, Value: 200, Unit: "mg/dL", Delay: 10, Snooze: 15, Enabled: true}},
+			egvs:     readings([]float64{190, 210, 215, 220, 225, 230, 235, 180}),
+			expected: []string{"5m high inactive>pending", "15m high pending>active", "30m high active>active repeat", "35m high active>inactive"},
+		},
+		{
+			name:     "high without delay or snooze",
+			rules:    []AlertSetting{{AlertName: AlertHigh, Value: 200, Unit: "mg/dL", Enabled: true}},
+			egvs:     readings([]float64{210, 250, 250, 250, 250}),
+			expected: []string{"0m high inactive>active"},
+		},
+		{
+			name: "low and urgent low",
+			rules: []AlertSetting{
+				{AlertName: AlertLow, Value: 70, Unit: "mg/dL", Snooze: 30, Enabled: true},
+				{AlertName: AlertUrgentLow, Value: 55, Unit: "mg/dL", Snooze: 30, Enabled: true},
+			},
+			egvs:     readings([]float64{80, 65, 50, 60, 75}),
+			expected: []string{"5m low inactive>active", "10m urgentLow inactive>active", "15m urgentLow active>inactive", "20m low active>inactive"},
+		},
+		{
+			name:     "below sensor range",
+			rules:    []AlertSetting{{AlertName: AlertUrgentLow, Value: 55, Unit: "mg/dL", Enabled: true}},
+			egvs:     []EGV{{SystemTime: FormatTime(start), Value: 0, Status: makeStrPtr(StatusLow)}},
+			expected: []string{"0m urgentLow inactive>active"},
+		},
+		{
+			name:     "urgent low soon",
+			rules:    []AlertSetting{{AlertName: AlertUrgentLowSoon, Value: 55, Unit: "mg/dL", Enabled: true}},
+			egvs:     readings([]float64{110, 100, 90, 90}, -1, -1.5, -2, 0),
+			expected: []string{"10m urgentLowSoon inactive>active", "15m urgentLowSoon active>inactive"},
+		},
+		{
+			name: "rise and fall rates",
+			rules: []AlertSetting{
+				{AlertName: AlertRise, Value: 2, Unit: "mg/dL/min", Enabled: true},
+				{AlertName: AlertFall, Value: 3, Unit: "mg/dL/min", Enabled: true},
+			},
+			egvs:     readings([]float64{100, 110, 120, 90}, 0, 2.5, 1, -3.2),
+			expected: []string{"5m rise inactive>active", "10m rise active>inactive", "15m fall inactive>active"},
+		},
+		{
+			name:     "rate from previous reading",
+			rules:    []AlertSetting{{AlertName: AlertFall, Value: -2, Unit: "mg/dL/min", Enabled: true}},
+			egvs:     readings([]float64{150, 145, 130}),
+			expected: []string{"10m fall inactive>active"},
+		},
+		{
+			name:     "mmol readings",
+			rules:    []AlertSetting{{AlertName: AlertLow, Value: 70, Unit: "mg/dL", Enabled: true}},
+			unit:     UnitMmolL,
+			egvs:     readings([]float64{4.5, 3.8}),
+			expected: []string{"5m low inactive>active"},
+		},
+		{
+			name: "disabled and unsupported rules",
+			rules: []AlertSetting{
+				{AlertName: AlertHigh, Value: 200, Unit: "mg/dL", Enabled: false},
+				{AlertName: "outOfRange", Value: 20, Unit: "minutes", Enabled: true},
+			},
+			egvs: readings([]float64{250, 250}),
+		},
+	}
+
+	for _, test := range testcases {
+		e := NewAlertEngine(test.rules, test.unit)
+		var actual []string
+		for _, egv := range test.egvs {
+			events, err := e.Evaluate(egv)
+			if err != nil {
+				t.Fatalf("[%s] Unexpected error occurred (%#v)", test.name, err)
+			}
+			for _, ev := range events {
+				s := fmt.Sprintf("%dm %s %s>%s", int(ev.Time.Sub(start)/time.Minute), ev.AlertName, ev.Previous, ev.State)
+				if ev.Repeat {
+					s += " repeat"
+				}
+				actual = append(actual, s)
+			}
+		}
+		if !reflect.DeepEqual(actual, test.expected) {
+			t.Fatalf("[%s] Actual events (%v) did not match expected (%v)", test.name, actual, test.expected)
+		}
+	}
+
+	if _, err := NewAlertEngine(nil, "").Evaluate(EGV{SystemTime: "yesterday"}); err == nil || err.Code() != ErrorTime {
+		t.Fatalf("Actual error (%v) did not match expected (%s)", err, ErrorTime)
+	}
+}
+
+func TestUnit_AlertEngineV1Settings(t *testing.T) {
+	// alertSettings as the v1 devices endpoint sends them, where urgent low is called fixedLow
+	body := `{"devices": [{"model": "G6 Mobile App", "lastUploadDate": "2019-03-01T14:05:00", "alertSettings": [
+		{"systemTime": "2019-02-20T18:10:52", "displayTime": "2019-02-20T10:10:52", "alertName": "fixedLow", "value": 55, "unit": "mg/dL", "snooze": 30, "enabled": true},
+		{"systemTime": "2019-02-20T18:10:52", "displayTime": "2019-02-20T10:10:52", "alertName": "low", "value": 70, "unit": "mg/dL", "snooze": 15, "enabled": true},
+		{"systemTime": "2019-02-20T18:10:52", "displayTime": "2019-02-20T10:10:52", "alertName": "high", "value": 250, "unit": "mg/dL", "snooze": 120, "enabled": true},
+		{"systemTime": "2019-02-20T18:10:52", "displayTime": "2019-02-20T10:10:52", "alertName": "rise", "value": 3, "unit": "mg/dL/min", "snooze": 0, "enabled": false},
+		{"systemTime": "2019-02-20T18:10:52", "displayTime": "2019-02-20T10:10:52", "alertName": "fall", "value": 3, "unit": "mg/dL/min", "snooze": 0, "enabled": false},
+		{"systemTime": "2019-02-20T18:10:52", "displayTime": "2019-02-20T10:10:52", "alertName": "outOfRange", "value": 20, "unit": "minutes", "snooze": 20, "enabled": true}
+	]}]}`
+	var resp DeviceResponse
+	if err := json.Unmarshal([]byte(body), &resp); err != nil {
+		t.Fatalf("Unexpected error occurred (%#v)", err)
+	}
+
+	start := time.Date(2019, 3, 1, 14, 0, 0, 0, time.UTC)
+	e := NewAlertEngine(CurrentAlertSettings(resp.Devices), UnitMgDL)
+	var actual []string
+	for i, v := range []float64{80, 65, 50, 60} {
+		events, err := e.Evaluate(EGV{SystemTime: FormatTime(start.Add(time.Duration(i) * SensorInterval)), Value: v})
+		if err != nil {
+			t.Fatalf("Unexpected error occurred (%#v)", err)
+		}
+		for _, ev := range events {
+			actual = append(actual, fmt.Sprintf("%dm %s %s>%s", int(ev.Time.Sub(start)/time.Minute), ev.AlertName, ev.Previous, ev.State))
+		}
+	}
+	expected := []string{"5m low inactive>active", "10m urgentLow inactive>active", "15m urgentLow active>inactive"}
+	if !reflect.DeepEqual(actual, expected) {
+		t.Fatalf("Actual events (%v) did not match expected (%v)", actual, expected)
+	}
+	expectedStates := map[string]AlertState{AlertUrgentLow: AlertStateInactive, AlertLow: AlertStateActive, AlertHigh: AlertStateInactive}
+	if states := e.States(); !reflect.DeepEqual(states, expectedStates) {
+		t.Fatalf("Actual states (%v) did not match expected (%v)", states, expectedStates)
+	}
+}
+
+func TestUnit_CurrentAlertSettings(t *testing.T) {
+	old := []AlertSetting{{AlertName: AlertHigh, Value: 250}}
+	current := []AlertSetting{{AlertName: AlertHigh, Value: 180}}
+	devices := []Device{
+		{LastUploadDate: "2017-06-10T00:00:00", AlertSettings: old},
+		{LastUploadDate: "2017-06-16T00:00:00", AlertSettings: current},
+		{LastUploadDate: "not a time"},
+	}
+	if actual := CurrentAlertSettings(devices); !reflect.DeepEqual(actual, current) {
+		t.Fatalf("Actual settings (%v) did not match expected (%v)", actual, current)
+	}
+}
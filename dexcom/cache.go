@@ -0,0 +1,326 @@
+package dexcom
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/healthimation/go-glitch/glitch"
+)
+
+const cacheDay = 24 * time.Hour
+
+// CacheTTLs controls how long each endpoint's responses are cached.  Data for days that ended more than Settle ago is
+// unlikely to change, so it is cached for Past instead of the endpoint ttl.
+type CacheTTLs struct {
+	EGVs         time.Duration
+	Events       time.Duration
+	Calibrations time.Duration
+	Devices      time.Duration
+	Statistics   time.Duration
+	Past         time.Duration
+	Settle       time.Duration
+}
+
+// DefaultCacheTTLs returns ttls suited to dashboards that refresh every few minutes
+func DefaultCacheTTLs() CacheTTLs {
+	return CacheTTLs{
+		EGVs:         time.Minute,
+		Events:       time.Minute,
+		Calibrations: time.Minute,
+		Devices:      5 * time.Minute,
+		Statistics:   5 * time.Minute,
+		Past:         24 * time.Hour,
+		Settle:       6 * time.Hour,
+	}
+}
+
+// cachedDay is what is stored for one user, endpoint and UTC day
+type cachedDay[T any] struct {
+	Unit     string `json:"unit,omitempty"`
+	RateUnit string `json:"rateUnit,omitempty"`
+	Records  []T    `json:"records"`
+}
+
+type cachingClient struct {
+	Client
+	backend CacheBackend
+	ttls    CacheTTLs
+	now     func() time.Time
+}
+
+// NewCachingClient wraps c so that egvs, events, calibrations, devices and statistics are served from backend when
+// possible.  EGVs, events and calibrations are cached per UTC day, so a request that is partly cached only fetches the
+// missing days, and records come back sorted by systemTime.  Entries are keyed by the user id set with WithUserID, or
+// by a hash of the access token without one.
+func NewCachingClient(c Client, backend CacheBackend, ttls CacheTTLs) Client {
+	return &cachingClient{Client: c, backend: backend, ttls: ttls, now: time.Now}
+}
+
+func (cc *cachingClient) GetEGVs(ctx context.Context, accessToken string, startDate, endDate time.Time) (*EGVResponse, glitch.DataError) {
+	fetch := func(start, end time.Time) (*cachedDay[EGV], glitch.DataError) {
+		resp, err := cc.Client.GetEGVs(ctx, accessToken, start, end)
+		if err != nil {
+			return nil, err
+		}
+		return &cachedDay[EGV]{Unit: resp.Unit, RateUnit: resp.RateUnit, Records: resp.EGVs}, nil
+	}
+	ret, err := cachedRange(ctx, cc, EndpointGetEGVs, userKey(ctx, accessToken)+"|egvs", startDate, endDate, cc.ttls.EGVs, fetch, func(e EGV) string { return e.SystemTime })
+	if err != nil {
+		return nil, err
+	}
+	return &EGVResponse{Unit: ret.Unit, RateUnit: ret.RateUnit, EGVs: ret.Records}, nil
+}
+
+// StreamEGVs serves the days cached by GetEGVs from the backend and streams the rest from the wrapped client.  Streamed
+// days aren't cached since a stream doesn't carry the unit, and come in the order the api sends them.
+func (cc *cachingClient) StreamEGVs(ctx context.Context, accessToken string, startDate, endDate time.Time, fn func(EGV) error) glitch.DataError {
+	start := startDate.UTC()
+	end := endDate.UTC()
+	prefix := userKey(ctx, accessToken) + "|egvs|"
+
+	// cached holds the records of the current run of cached days, missing holds the first day of the current run of
+	// missing days
+	var cached []EGV
+	flush := func() glitch.DataError {
+		sort.SliceStable(cached, func(i, j int) bool { return compareTimes(cached[i].SystemTime, cached[j].SystemTime) < 0 })
+		for _, egv := range cached {
+			if t, err := ParseTime(egv.SystemTime); err == nil && (t.Before(start) || !t.Before(end)) {
+				continue
+			}
+			if err := fn(egv); err != nil {
+				return callbackError(err)
+			}
+		}
+		cached = nil
+		return nil
+	}
+
+	var missing time.Time
+	for day := start.Truncate(cacheDay); day.Before(end); day = day.Add(cacheDay) {
+		d := new(cachedDay[EGV])
+		if !cc.get(ctx, EndpointGetEGVs, prefix+day.Format("2006-01-02"), d) {
+			if missing.IsZero() {
+				if err := flush(); err != nil {
+					return err
+				}
+				missing = day
+				if missing.Before(start) {
+					missing = start
+				}
+			}
+			continue
+		}
+		if !missing.IsZero() {
+			if err := cc.streamRange(ctx, accessToken, missing, day, fn); err != nil {
+				return err
+			}
+			missing = time.Time{}
+		}
+		cached = append(cached, d.Records...)
+	}
+	if err := flush(); err != nil {
+		return err
+	}
+	if !missing.IsZero() {
+		return cc.streamRange(ctx, accessToken, missing, end, fn)
+	}
+	return nil
+}
+
+// streamRange streams [start, end) from the wrapped client one MaxRange window at a time
+func (cc *cachingClient) streamRange(ctx context.Context, accessToken string, start, end time.Time, fn func(EGV) error) glitch.DataError {
+	for _, w := range splitRange(start, end, MaxRange) {
+		if err := StreamEGVs(ctx, cc.Client, accessToken, w.start, w.end, fn); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (cc *cachingClient) GetEvents(ctx context.Context, accessToken string, startDate, endDate time.Time) (*EventResponse, glitch.DataError) {
+	fetch := func(start, end time.Time) (*cachedDay[Event], glitch.DataError) {
+		resp, err := cc.Client.GetEvents(ctx, accessToken, start, end)
+		if err != nil {
+			return nil, err
+		}
+		return &cachedDay[Event]{Records: resp.Events}, nil
+	}
+	ret, err := cachedRange(ctx, cc, EndpointGetEvents, userKey(ctx, accessToken)+"|events", startDate, endDate, cc.ttls.Events, fetch, func(e Event) string { return e.SystemTime })
+	if err != nil {
+		return nil, err
+	}
+	return &EventResponse{Events: ret.Records}, nil
+}
+
+func (cc *cachingClient) GetCalibrations(ctx context.Context, accessToken string, startDate, endDate time.Time) (*CalibrationResponse, glitch.DataError) {
+	fetch := func(start, end time.Time) (*cachedDay[Calibration], glitch.DataError) {
+		resp, err := GetCalibrations(ctx, cc.Client, accessToken, start, end)
+		if err != nil {
+			return nil, err
+		}
+		return &cachedDay[Calibration]{Records: resp.Calibrations}, nil
+	}
+	ret, err := cachedRange(ctx, cc, EndpointGetCalibrations, userKey(ctx, accessToken)+"|calibrations", startDate, endDate, cc.ttls.Calibrations, fetch, func(c Calibration) string { return c.SystemTime })
+	if err != nil {
+		return nil, err
+	}
+	return &CalibrationResponse{Calibrations: ret.Records}, nil
+}
+
+func (cc *cachingClient) GetDevices(ctx context.Context, accessToken string, startDate, endDate time.Time) (*DeviceResponse, glitch.DataError) {
+	key := fmt.Sprintf("%s|devices|%s|%s", userKey(ctx, accessToken), FormatTime(startDate), FormatTime(endDate))
+	result := new(DeviceResponse)
+	if cc.get(ctx, EndpointGetDevices, key, result) {
+		return result, nil
+	}
+	result, err := cc.Client.GetDevices(ctx, accessToken, startDate, endDate)
+	if err != nil {
+		return nil, err
+	}
+	cc.set(key, result, cc.ttlFor(endDate, cc.ttls.Devices))
+	return result, nil
+}
+
+func (cc *cachingClient) GetStatistics(ctx context.Context, accessToken string, startDate, endDate time.Time, stats map[string][]StatRequest) (*Statistics, glitch.DataError) {
+	// map keys are marshalled in sorted order so equal requests hash the same
+	by, jerr := json.Marshal(stats)
+	if jerr != nil {
+		return cc.Client.GetStatistics(ctx, accessToken, startDate, endDate, stats)
+	}
+	sum := sha256.Sum256(by)
+	key := fmt.Sprintf("%s|statistics|%s|%s|%s", userKey(ctx, accessToken), FormatTime(startDate), FormatTime(endDate), hex.EncodeToString(sum[:]))
+	result := new(Statistics)
+	if cc.get(ctx, EndpointGetStatistics, key, result) {
+		return result, nil
+	}
+	result, err := cc.Client.GetStatistics(ctx, accessToken, startDate, endDate, stats)
+	if err != nil {
+		return nil, err
+	}
+	cc.set(key, result, cc.ttlFor(endDate, cc.ttls.Statistics))
+	return result, nil
+}
+
+// ttlFor returns the past ttl for data ending before the settle period, and ttl otherwise
+func (cc *cachingClient) ttlFor(end time.Time, ttl time.Duration) time.Duration {
+	if end.Before(cc.now().Add(-cc.ttls.Settle)) && cc.ttls.Past > ttl {
+		return cc.ttls.Past
+	}
+	return ttl
+}
+
+func (cc *cachingClient) get(ctx context.Context, endpoint, key string, v interface{}) bool {
+	by, ok := cc.backend.Get(key)
+	hit := ok && json.Unmarshal(by, v) == nil
+	MetricsFromContext(ctx).ObserveCacheLookup(endpoint, hit)
+	return hit
+}
+
+func (cc *cachingClient) set(key string, v interface{}, ttl time.Duration) {
+	if ttl <= 0 {
+		return
+	}
+	by, err := json.Marshal(v)
+	if err != nil {
+		return
+	}
+	cc.backend.Set(key, by, ttl)
+}
+
+// cachedRange serves [start, end) from per day cache entries, fetching each contiguous run of missing days with as
+// few requests as the api range limit allows.
+func cachedRange[T any](ctx context.Context, cc *cachingClient, endpoint, prefix string, start, end time.Time, ttl time.Duration, fetch func(start, end time.Time) (*cachedDay[T], glitch.DataError), systemTime func(T) string) (*cachedDay[T], glitch.DataError) {
+	start = start.UTC()
+	end = end.UTC()
+	first := start.Truncate(cacheDay)
+
+	var days []time.Time
+	for day := first; day.Before(end); day = day.Add(cacheDay) {
+		days = append(days, day)
+	}
+	key := func(day time.Time) string {
+		return prefix + "|" + day.Format("2006-01-02")
+	}
+
+	found := make(map[time.Time]*cachedDay[T], len(days))
+	for _, day := range days {
+		cached := new(cachedDay[T])
+		if cc.get(ctx, endpoint, key(day), cached) {
+			found[day] = cached
+		}
+	}
+
+	for i := 0; i < len(days); {
+		if _, ok := found[days[i]]; ok {
+			i++
+			continue
+		}
+		j := i
+		for j < len(days) {
+			if _, ok := found[days[j]]; ok {
+				break
+			}
+			j++
+		}
+		runStart, runEnd := days[i], days[j-1].Add(cacheDay)
+		for _, w := range splitRange(runStart, runEnd, MaxRange) {
+			// the api rejects ranges reaching into the future, today is cached with the short ttl anyway
+			fetchEnd := w.end
+			if now := cc.now().UTC().Truncate(time.Second); fetchEnd.After(now) {
+				fetchEnd = now
+			}
+			resp := new(cachedDay[T])
+			if fetchEnd.After(w.start) {
+				var err glitch.DataError
+				resp, err = fetch(w.start, fetchEnd)
+				if err != nil {
+					return nil, err
+				}
+			}
+			for day := w.start; day.Before(w.end); day = day.Add(cacheDay) {
+				found[day] = &cachedDay[T]{Unit: resp.Unit, RateUnit: resp.RateUnit}
+			}
+			for _, r := range resp.Records {
+				day := w.start
+				if t, err := ParseTime(systemTime(r)); err == nil {
+					if t.Before(w.start) || !t.Before(w.end) {
+						continue
+					}
+					day = t.UTC().Truncate(cacheDay)
+				}
+				found[day].Records = append(found[day].Records, r)
+			}
+			for day := w.start; day.Before(w.end); day = day.Add(cacheDay) {
+				cc.set(key(day), found[day], cc.ttlFor(day.Add(cacheDay), ttl))
+			}
+		}
+		i = j
+	}
+
+	ret := new(cachedDay[T])
+	for _, day := range days {
+		d := found[day]
+		if ret.Unit == "" {
+			ret.Unit = d.Unit
+		}
+		if ret.RateUnit == "" {
+			ret.RateUnit = d.RateUnit
+		}
+		for _, r := range d.Records {
+			t, err := ParseTime(systemTime(r))
+			if err == nil && (t.Before(start) || !t.Before(end)) {
+				continue
+			}
+			ret.Records = append(ret.Records, r)
+		}
+	}
+	sort.SliceStable(ret.Records, func(i, j int) bool {
+		return compareTimes(systemTime(ret.Records[i]), systemTime(ret.Records[j])) < 0
+	})
+	return ret, nil
+}
@@ -0,0 +1,144 @@
+package dexcom
+
+import (
+	"container/list"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// CacheBackend stores cached responses.  Caching is best effort so backends report failures as misses.
+type CacheBackend interface {
+	Get(key string) ([]byte, bool)
+	Set(key string, value []byte, ttl time.Duration)
+}
+
+type lruEntry struct {
+	key     string
+	value   []byte
+	expires time.Time
+}
+
+type lruCache struct {
+	mu      sync.Mutex
+	size    int
+	entries map[string]*list.Element
+	order   *list.List
+	now     func() time.Time
+}
+
+// NewLRUCache returns an in-memory CacheBackend holding at most size entries
+func NewLRUCache(size int) CacheBackend {
+	if size < 1 {
+		size = 1
+	}
+	return &lruCache{
+		size:    size,
+		entries: make(map[string]*list.Element),
+		order:   list.New(),
+		now:     time.Now,
+	}
+}
+
+func (l *lruCache) Get(key string) ([]byte, bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	el, ok := l.entries[key]
+	if !ok {
+		return nil, false
+	}
+	entry := el.Value.(*lruEntry)
+	if l.now().After(entry.expires) {
+		l.order.Remove(el)
+		delete(l.entries, key)
+		return nil, false
+	}
+	l.order.MoveToFront(el)
+	return entry.value, true
+}
+
+func (l *lruCache) Set(key string, value []byte, ttl time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	expires := l.now().Add(ttl)
+	if el, ok := l.entries[key]; ok {
+		entry := el.Value.(*lruEntry)
+		entry.value = value
+		entry.expires = expires
+		l.order.MoveToFront(el)
+		return
+	}
+	l.entries[key] = l.order.PushFront(&lruEntry{key: key, value: value, expires: expires})
+	for l.order.Len() > l.size {
+		oldest := l.order.Back()
+		l.order.Remove(oldest)
+		delete(l.entries, oldest.Value.(*lruEntry).key)
+	}
+}
+
+type diskEntry struct {
+	Expires time.Time `json:"expires"`
+	Value   []byte    `json:"value"`
+}
+
+type diskCache struct {
+	dir string
+	now func() time.Time
+}
+
+// NewDiskCache returns a CacheBackend that keeps one file per entry under dir.  File names are hashes of the key.
+func NewDiskCache(dir string) CacheBackend {
+	return &diskCache{dir: dir, now: time.Now}
+}
+
+func (d *diskCache) path(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	name := hex.EncodeToString(sum[:])
+	return filepath.Join(d.dir, name[:2], name)
+}
+
+func (d *diskCache) Get(key string) ([]byte, bool) {
+	path := d.path(key)
+	by, err := os.ReadFile(path)
+	if err != nil {
+		return nil, false
+	}
+	entry := diskEntry{}
+	if err := json.Unmarshal(by, &entry); err != nil {
+		os.Remove(path)
+		return nil, false
+	}
+	if d.now().After(entry.Expires) {
+		os.Remove(path)
+		return nil, false
+	}
+	return entry.Value, true
+}
+
+func (d *diskCache) Set(key string, value []byte, ttl time.Duration) {
+	path := d.path(key)
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return
+	}
+	by, err := json.Marshal(diskEntry{Expires: d.now().Add(ttl), Value: value})
+	if err != nil {
+		return
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".tmp-*")
+	if err != nil {
+		return
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(by); err != nil {
+		tmp.Close()
+		return
+	}
+	if err := tmp.Close(); err != nil {
+		return
+	}
+	os.Rename(tmp.Name(), path)
+}
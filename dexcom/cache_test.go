@@ -0,0 +1,132 @@
+package dexcom
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestUnit_CachingClientGetEGVs(t *testing.T) {
+	now := time.Date(2017, 6, 20, 12, 0, 0, 0, time.UTC)
+	var requests []string
+	c, ts := testClient(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests = append(requests, r.URL.Query().Get(paramStartDate)+"/"+r.URL.Query().Get(paramEndDate))
+		fmt.Fprint(w, `{"unit": "mg/dL","rateUnit": "mg/dL/min","egvs": [{"systemTime": "2017-06-16T15:40:00","value": 119},{"systemTime": "2017-06-17T15:40:00","value": 120},{"systemTime": "2017-06-18T15:40:00","value": 121}]}`)
+	}), 5*time.Second)
+	defer ts.Close()
+
+	cc := NewCachingClient(c, NewLRUCache(100), DefaultCacheTTLs()).(*cachingClient)
+	cc.now = func() time.Time { return now }
+	ctx := WithUserID(context.Background(), "user")
+
+	type testcase struct {
+		name             string
+		start            time.Time
+		end              time.Time
+		expectedRequests []string
+		expectedEGVs     int
+	}
+
+	testcases := []testcase{
+		{
+			name:             "miss",
+			start:            time.Date(2017, 6, 16, 12, 0, 0, 0, time.UTC),
+			end:              time.Date(2017, 6, 18, 0, 0, 0, 0, time.UTC),
+			expectedRequests: []string{"2017-06-16T00:00:00/2017-06-18T00:00:00"},
+			expectedEGVs:     2,
+		},
+		{
+			name:         "hit",
+			start:        time.Date(2017, 6, 17, 0, 0, 0, 0, time.UTC),
+			end:          time.Date(2017, 6, 18, 0, 0, 0, 0, time.UTC),
+			expectedEGVs: 1,
+		},
+		{
+			name:             "partial",
+			start:            time.Date(2017, 6, 16, 0, 0, 0, 0, time.UTC),
+			end:              time.Date(2017, 6, 19, 0, 0, 0, 0, time.UTC),
+			expectedRequests: []string{"2017-06-18T00:00:00/2017-06-19T00:00:00"},
+			expectedEGVs:     3,
+		},
+	}
+
+	for _, tc := range testcases {
+		t.Run(tc.name, func(t *testing.T) {
+			requests = nil
+			ret, err := cc.GetEGVs(ctx, "token", tc.start, tc.end)
+			if err != nil {
+				t.Fatalf("Unexpected error occurred (%#v)", err)
+			}
+			if fmt.Sprint(requests) != fmt.Sprint(tc.expectedRequests) {
+				t.Fatalf("Actual requests (%v) did not match expected (%v)", requests, tc.expectedRequests)
+			}
+			if len(ret.EGVs) != tc.expectedEGVs || ret.Unit != "mg/dL" {
+				t.Fatalf("Actual response (%#v) did not have %d egvs", ret, tc.expectedEGVs)
+			}
+		})
+	}
+}
+
+func TestUnit_CachingClientStreamEGVs(t *testing.T) {
+	now := time.Date(2017, 6, 20, 12, 0, 0, 0, time.UTC)
+	var requests []string
+	c, ts := testClient(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := r.URL.Query().Get(paramStartDate)
+		requests = append(requests, start+"/"+r.URL.Query().Get(paramEndDate))
+		fmt.Fprintf(w, `{"unit": "mg/dL", "egvs": [{"systemTime": "%s", "value": 119}]}`, strings.Replace(start, "T00:00:00", "T15:40:00", 1))
+	}), 5*time.Second)
+	defer ts.Close()
+
+	cc := NewCachingClient(c, NewLRUCache(100), DefaultCacheTTLs()).(*cachingClient)
+	cc.now = func() time.Time { return now }
+	ctx := WithUserID(context.Background(), "user")
+	day := func(d int) time.Time { return time.Date(2017, 6, d, 0, 0, 0, 0, time.UTC) }
+
+	// the 17th is cached, the days around it are streamed in order without being cached
+	if _, err := cc.GetEGVs(ctx, "token", day(17), day(18)); err != nil {
+		t.Fatalf("Unexpected error occurred (%#v)", err)
+	}
+	for i := 0; i < 2; i++ {
+		requests = nil
+		var times []string
+		err := StreamEGVs(ctx, cc, "token", day(16), day(19), func(egv EGV) error {
+			times = append(times, egv.SystemTime)
+			return nil
+		})
+		if err != nil {
+			t.Fatalf("Unexpected error occurred (%#v)", err)
+		}
+		expectedRequests := []string{"2017-06-16T00:00:00/2017-06-17T00:00:00", "2017-06-18T00:00:00/2017-06-19T00:00:00"}
+		if fmt.Sprint(requests) != fmt.Sprint(expectedRequests) {
+			t.Fatalf("Actual requests (%v) did not match expected (%v)", requests, expectedRequests)
+		}
+		expectedTimes := []string{"2017-06-16T15:40:00", "2017-06-17T15:40:00", "2017-06-18T15:40:00"}
+		if fmt.Sprint(times) != fmt.Sprint(expectedTimes) {
+			t.Fatalf("Actual times (%v) did not match expected (%v)", times, expectedTimes)
+		}
+	}
+}
+
+func TestUnit_LRUCache(t *testing.T) {
+	now := time.Now()
+	l := NewLRUCache(2).(*lruCache)
+	l.now = func() time.Time { return now }
+
+	l.Set("a", []byte("a"), time.Minute)
+	l.Set("b", []byte("b"), time.Minute)
+	l.Get("a")
+	l.Set("c", []byte("c"), time.Minute)
+	if _, ok := l.Get("b"); ok {
+		t.Fatalf("Expected least recently used entry to be evicted")
+	}
+	if _, ok := l.Get("a"); !ok {
+		t.Fatalf("Expected recently used entry to remain")
+	}
+	now = now.Add(2 * time.Minute)
+	if _, ok := l.Get("c"); ok {
+		t.Fatalf("Expected expired entry to be a miss")
+	}
+}
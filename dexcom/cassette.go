@@ -0,0 +1,221 @@
+package dexcom
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/healthimation/go-client/client"
+	"github.com/healthimation/go-glitch/glitch"
+)
+
+const redacted = "REDACTED"
+
+// secretParams are never written to a cassette
+var secretParams = []string{paramClientSecret, paramAuthorizationCode, paramRefreshToken, "access_token"}
+
+// Interaction is one recorded request and its response
+type Interaction struct {
+	Method       string     `json:"method"`
+	Slug         string     `json:"slug"`
+	Query        url.Values `json:"query,omitempty"`
+	RequestBody  string     `json:"requestBody,omitempty"`
+	Status       int        `json:"status"`
+	ResponseBody string     `json:"responseBody"`
+}
+
+// Cassette holds the interactions recorded by a recorder client and replayed by a replay client
+type Cassette struct {
+	Interactions []Interaction `json:"interactions"`
+
+	mu   sync.Mutex
+	used map[int]bool
+}
+
+// NewCassette returns an empty cassette to record into
+func NewCassette() *Cassette {
+	return &Cassette{}
+}
+
+// LoadCassette reads a cassette saved with Save
+func LoadCassette(path string) (*Cassette, glitch.DataError) {
+	by, err := os.ReadFile(path)
+	if err != nil {
+		return nil, glitch.NewDataError(err, ErrorCassette, "Could not read cassette")
+	}
+	ret := new(Cassette)
+	if err := json.Unmarshal(by, ret); err != nil {
+		return nil, glitch.NewDataError(err, ErrorJSON, "Could not unmarshal cassette")
+	}
+	return ret, nil
+}
+
+// Save writes the cassette to path as indented JSON
+func (c *Cassette) Save(path string) glitch.DataError {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	by, err := json.MarshalIndent(c, "", "  ")
+	if err != nil {
+		return glitch.NewDataError(err, ErrorJSON, "Could not marshal cassette")
+	}
+	if err := os.WriteFile(path, by, 0600); err != nil {
+		return glitch.NewDataError(err, ErrorCassette, "Could not write cassette")
+	}
+	return nil
+}
+
+func (c *Cassette) record(i Interaction) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.Interactions = append(c.Interactions, i)
+}
+
+// find returns the first unplayed interaction matching the request, or the last match once all have been played
+func (c *Cassette) find(method, slug string, query url.Values) (Interaction, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.used == nil {
+		c.used = make(map[int]bool)
+	}
+	last := -1
+	for i, in := range c.Interactions {
+		if in.Method != method || in.Slug != slug ||
+			in.Query.Get(paramStartDate) != query.Get(paramStartDate) || in.Query.Get(paramEndDate) != query.Get(paramEndDate) {
+			continue
+		}
+		if !c.used[i] {
+			c.used[i] = true
+			return in, true
+		}
+		last = i
+	}
+	if last < 0 {
+		return Interaction{}, false
+	}
+	return c.Interactions[last], true
+}
+
+// cassetteBaseClient records the exchanges of next into cassette, or replays them when next is nil
+type cassetteBaseClient struct {
+	next     client.BaseClient
+	cassette *Cassette
+}
+
+// NewRecorderClient returns a client that talks to the api at baseURL and records every exchange into cassette, with
+// bearer tokens, client secrets, codes and issued tokens removed.
+func NewRecorderClient(baseURL string, clientID string, clientSecret string, timeout time.Duration, cassette *Cassette) Client {
+	return &dexcomClient{
+		c:            &cassetteBaseClient{next: client.NewBaseClient(staticFinder(baseURL), "dexcom", true, timeout), cassette: cassette},
+		clientID:     clientID,
+		clientSecret: clientSecret,
+	}
+}
+
+// NewReplayClient returns a client that answers every request from cassette without touching the network.  Requests
+// are matched on method, slug and the startDate and endDate parameters.
+func NewReplayClient(cassette *Cassette) Client {
+	return &dexcomClient{
+		c:        &cassetteBaseClient{cassette: cassette},
+		clientID: redacted,
+	}
+}
+
+func (cb *cassetteBaseClient) Do(ctx context.Context, method string, slug string, query url.Values, headers http.Header, body io.Reader, response interface{}) glitch.DataError {
+	status, ret, err := cb.MakeRequest(ctx, method, slug, query, headers, body)
+	if err != nil {
+		return err
+	}
+	if status < 200 || status >= 300 {
+		return apiError(status, ret)
+	}
+	if response != nil {
+		if err := json.Unmarshal(ret, response); err != nil {
+			return glitch.NewDataError(err, ErrorJSON, "Could not unmarshal response")
+		}
+	}
+	return nil
+}
+
+func (cb *cassetteBaseClient) MakeRequest(ctx context.Context, method string, slug string, query url.Values, headers http.Header, body io.Reader) (int, []byte, glitch.DataError) {
+	var reqBody []byte
+	if body != nil {
+		by, err := io.ReadAll(body)
+		if err != nil {
+			return 0, nil, glitch.NewDataError(err, ErrorCassette, "Could not read request body")
+		}
+		reqBody = by
+	}
+
+	if cb.next == nil {
+		in, ok := cb.cassette.find(method, slug, query)
+		if !ok {
+			return 0, nil, glitch.NewDataError(fmt.Errorf("%s %s %s", method, slug, query.Encode()), ErrorCassette, "No recorded interaction matches the request")
+		}
+		return in.Status, []byte(in.ResponseBody), nil
+	}
+
+	var next io.Reader
+	if reqBody != nil {
+		next = bytes.NewReader(reqBody)
+	}
+	status, ret, err := cb.next.MakeRequest(ctx, method, slug, query, headers, next)
+	if err != nil {
+		return status, ret, err
+	}
+	cb.cassette.record(Interaction{
+		Method:       method,
+		Slug:         slug,
+		Query:        query,
+		RequestBody:  redactBody(reqBody),
+		Status:       status,
+		ResponseBody: redactBody(ret),
+	})
+	return status, ret, nil
+}
+
+// redactBody removes secrets from a form encoded or JSON body
+func redactBody(body []byte) string {
+	if len(body) == 0 {
+		return ""
+	}
+	obj := map[string]interface{}{}
+	if json.Unmarshal(body, &obj) == nil {
+		changed := false
+		for _, p := range secretParams {
+			if _, ok := obj[p]; ok {
+				obj[p] = redacted
+				changed = true
+			}
+		}
+		if !changed {
+			return string(body)
+		}
+		by, err := json.Marshal(obj)
+		if err != nil {
+			return redacted
+		}
+		return string(by)
+	}
+	values, err := url.ParseQuery(string(body))
+	if err != nil {
+		return string(body)
+	}
+	changed := false
+	for _, p := range secretParams {
+		if values.Has(p) {
+			values.Set(p, redacted)
+			changed = true
+		}
+	}
+	if !changed {
+		return string(body)
+	}
+	return values.Encode()
+}
@@ -0,0 +1,87 @@
+package dexcom
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestUnit_CassetteRecordReplay(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/v1/oauth2/token":
+			fmt.Fprint(w, `{"access_token":"secret-access", "expires_in":600, "token_type":"Bearer", "refresh_token":"secret-refresh"}`)
+		default:
+			fmt.Fprintf(w, `{"unit": "mg/dL","rateUnit": "mg/dL/min","egvs": [{"systemTime": "%s","displayTime": "2017-06-16T07:40:00","value": 119}]}`, r.URL.Query().Get(paramStartDate))
+		}
+	}))
+	ctx := context.Background()
+	day1 := time.Date(2017, 6, 16, 0, 0, 0, 0, time.UTC)
+	day2 := day1.Add(24 * time.Hour)
+
+	cassette := NewCassette()
+	rec := NewRecorderClient(ts.URL, "123", "client-secret", 5*time.Second, cassette)
+	token, err := rec.GetUser(ctx, "auth-code", "uri")
+	if err != nil {
+		t.Fatalf("Unexpected error occurred (%#v)", err)
+	}
+	rec.GetEGVs(ctx, token.AccessToken, day1, day2)
+	rec.GetEGVs(ctx, token.AccessToken, day2, day2.Add(24*time.Hour))
+	ts.Close()
+
+	path := filepath.Join(t.TempDir(), "cassette.json")
+	if err := cassette.Save(path); err != nil {
+		t.Fatalf("Unexpected error occurred (%#v)", err)
+	}
+	loaded, err := LoadCassette(path)
+	if err != nil {
+		t.Fatalf("Unexpected error occurred (%#v)", err)
+	}
+	for _, in := range loaded.Interactions {
+		for _, secret := range []string{"secret-access", "secret-refresh", "client-secret", "auth-code"} {
+			if strings.Contains(in.RequestBody+in.ResponseBody, secret) {
+				t.Fatalf("Interaction (%#v) leaked %s", in, secret)
+			}
+		}
+	}
+
+	type testcase struct {
+		name            string
+		start           time.Time
+		expectedErrCode string
+		expectedTime    string
+	}
+
+	testcases := []testcase{
+		{name: "first window", start: day2, expectedTime: "2017-06-17T00:00:00"},
+		{name: "second window", start: day1, expectedTime: "2017-06-16T00:00:00"},
+		{name: "exceptional path - not recorded", start: day2.Add(24 * time.Hour), expectedErrCode: ErrorCassette},
+	}
+
+	replay := NewReplayClient(loaded)
+	for _, tc := range testcases {
+		t.Run(tc.name, func(t *testing.T) {
+			ret, err := replay.GetEGVs(ctx, "anything", tc.start, tc.start.Add(24*time.Hour))
+			if tc.expectedErrCode != "" || err != nil {
+				if tc.expectedErrCode == "" {
+					t.Fatalf("Unexpected error occurred (%#v)", err)
+				}
+				if err == nil {
+					t.Fatalf("Expected error did not occur")
+				}
+				if err.Code() != tc.expectedErrCode {
+					t.Fatalf("Actual error (%#v) did not match expected (%#v)", err.Code(), tc.expectedErrCode)
+				}
+				return
+			}
+			if ret.EGVs[0].SystemTime != tc.expectedTime {
+				t.Fatalf("Actual time (%s) did not match expected (%s)", ret.EGVs[0].SystemTime, tc.expectedTime)
+			}
+		})
+	}
+}
@@ -0,0 +1,113 @@
+package dexcom
+
+import "strings"
+
+// Columns of a Dexcom Clarity CSV export.  Glucose columns are named for the unit the export was made in.
+const (
+	ClarityIndex           = "Index"
+	ClarityTimestamp       = "Timestamp (YYYY-MM-DDThh:mm:ss)"
+	ClarityEventType       = "Event Type"
+	ClarityEventSubtype    = "Event Subtype"
+	ClarityPatientInfo     = "Patient Info"
+	ClarityDeviceInfo      = "Device Info"
+	ClaritySourceDeviceID  = "Source Device ID"
+	ClarityGlucoseMgDL     = "Glucose Value (mg/dL)"
+	ClarityGlucoseMmolL    = "Glucose Value (mmol/L)"
+	ClarityInsulin         = "Insulin Value (u)"
+	ClarityCarbs           = "Carb Value (grams)"
+	ClarityDuration        = "Duration (hh:mm:ss)"
+	ClarityRateMgDL        = "Glucose Rate of Change (mg/dL/min)"
+	ClarityRateMmolL       = "Glucose Rate of Change (mmol/L/min)"
+	ClarityTransmitterTime = "Transmitter Time (Long Integer)"
+	ClarityTransmitterID   = "Transmitter ID"
+)
+
+// Clarity event types
+const (
+	clarityFirstName   = "FirstName"
+	clarityLastName    = "LastName"
+	clarityDevice      = "Device"
+	clarityAlert       = "Alert"
+	clarityEGV         = "EGV"
+	clarityCalibration = "Calibration"
+	clarityLow         = "Low"
+	clarityHigh        = "High"
+)
+
+// Values Clarity reports as Low and High are outside the sensor's range, in mg/dL
+const (
+	sensorLow  = 40
+	sensorHigh = 400
+)
+
+// ClarityColumns returns the columns of a Clarity export made in unit
+func ClarityColumns(unit string) []string {
+	glucose, rate := ClarityGlucoseMgDL, ClarityRateMgDL
+	if isMmolL(unit) {
+		glucose, rate = ClarityGlucoseMmolL, ClarityRateMmolL
+	}
+	return []string{
+		ClarityIndex, ClarityTimestamp, ClarityEventType, ClarityEventSubtype, ClarityPatientInfo, ClarityDeviceInfo,
+		ClaritySourceDeviceID, glucose, ClarityInsulin, ClarityCarbs, ClarityDuration, rate, ClarityTransmitterTime,
+		ClarityTransmitterID,
+	}
+}
+
+// clarityEventTypes maps api event types to Clarity event types
+var clarityEventTypes = map[string]string{
+	"carbs":    "Carbs",
+	"insulin":  "Insulin",
+	"exercise": "Exercise",
+	"health":   "Health",
+}
+
+// claritySubtypes maps api event subtypes to Clarity event subtypes
+var claritySubtypes = map[string]string{
+	"fastActing":   "Fast-Acting",
+	"longActing":   "Long-Acting",
+	"light":        "Light",
+	"medium":       "Medium",
+	"heavy":        "Heavy",
+	"illness":      "Illness",
+	"stress":       "Stress",
+	"highSymptoms": "High Symptoms",
+	"lowSymptoms":  "Low Symptoms",
+	"cycle":        "Menstrual Cycle",
+	"alcohol":      "Alcohol",
+}
+
+// clarityAlerts maps api alert names to Clarity alert subtypes
+var clarityAlerts = map[string]string{
+	"high":          "High",
+	"low":           "Low",
+	"urgentLow":     "Urgent Low",
+	"urgentLowSoon": "Urgent Low Soon",
+	"rise":          "Rise",
+	"fall":          "Fall",
+	"outOfRange":    "Signal Loss",
+	"noReadings":    "No Readings",
+}
+
+// toClarity maps an api value through m, title casing values it does not know
+func toClarity(m map[string]string, value string) string {
+	if v, ok := m[value]; ok {
+		return v
+	}
+	if value == "" {
+		return ""
+	}
+	return strings.ToUpper(value[:1]) + value[1:]
+}
+
+// fromClarity maps a Clarity value back through m, lower casing the first letter of values it does not know
+func fromClarity(m map[string]string, value string) string {
+	for k, v := range m {
+		if v == value {
+			return k
+		}
+	}
+	if value == "" {
+		return ""
+	}
+	return strings.ToLower(value[:1]) + value[1:]
+}
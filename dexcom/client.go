@@ -4,6 +4,7 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"io"
 	"net/http"
 	"net/url"
 	"strings"
@@ -16,13 +17,24 @@ import (
 //Error codes
 const (
 	ErrorAPI          = "ERROR_API"
+	ErrorUnauthorized = "ERROR_UNAUTHORIZED"
 	ErrorJSON         = "ERROR_JSON"
 	ErrorMissingParam = "ERROR_MISSING_PARAM"
+	ErrorTime         = "ERROR_TIME"
+	ErrorInvalidGrant = "ERROR_INVALID_GRANT"
+	ErrorCanceled     = "ERROR_CANCELED"
+	ErrorUnitMismatch = "ERROR_UNIT_MISMATCH"
+	ErrorStorage      = "ERROR_STORAGE"
+	ErrorCassette     = "ERROR_CASSETTE"
+	ErrorCSV          = "ERROR_CSV"
 
 	// grant types
 	grantTypeAuthorizationCode = "authorization_code"
 	grantTypeRefreshToken      = "refresh_token"
 
+	// oauth error responses
+	oauthErrorInvalidGrant = "invalid_grant"
+
 	// params
 	paramClientID          = "client_id"
 	paramClientSecret      = "client_secret"
@@ -47,8 +59,23 @@ type Client interface {
 	GetStatistics(ctx context.Context, accessToken string, startDate, endDate time.Time, stats map[string][]StatRequest) (*Statistics, glitch.DataError)
 }
 
+// CalibrationGetter is implemented by clients that can fetch calibrations.  It is kept out of Client so that Client
+// implementations written before calibrations were supported keep compiling.
+type CalibrationGetter interface {
+	GetCalibrations(ctx context.Context, accessToken string, startDate, endDate time.Time) (*CalibrationResponse, glitch.DataError)
+}
+
+// GetCalibrations fetches calibrations with c if it is a CalibrationGetter.  Other clients have no calibrations.
+func GetCalibrations(ctx context.Context, c Client, accessToken string, startDate, endDate time.Time) (*CalibrationResponse, glitch.DataError) {
+	if cg, ok := c.(CalibrationGetter); ok {
+		return cg.GetCalibrations(ctx, accessToken, startDate, endDate)
+	}
+	return &CalibrationResponse{}, nil
+}
+
 type dexcomClient struct {
 	c            client.BaseClient
+	stream       *streamer
 	clientID     string
 	clientSecret string
 }
@@ -57,6 +84,7 @@ type dexcomClient struct {
 func NewClient(clientID string, clientSecret string, timeout time.Duration) Client {
 	return &dexcomClient{
 		c:            client.NewBaseClient(findDexcom, "dexcom", true, timeout),
+		stream:       newStreamer(findDexcom, timeout),
 		clientID:     clientID,
 		clientSecret: clientSecret,
 	}
@@ -66,6 +94,17 @@ func NewClient(clientID string, clientSecret string, timeout time.Duration) Clie
 func NewSandboxClient(clientID string, clientSecret string, timeout time.Duration) Client {
 	return &dexcomClient{
 		c:            client.NewBaseClient(findDexcomSandbox, "dexcom", true, timeout),
+		stream:       newStreamer(findDexcomSandbox, timeout),
+		clientID:     clientID,
+		clientSecret: clientSecret,
+	}
+}
+
+// NewClientWithBaseURL gets a client that talks to the api at baseURL, e.g. a dexcomtest.Server
+func NewClientWithBaseURL(baseURL string, clientID string, clientSecret string, timeout time.Duration) Client {
+	return &dexcomClient{
+		c:            client.NewBaseClient(staticFinder(baseURL), "dexcom", true, timeout),
+		stream:       newStreamer(staticFinder(baseURL), timeout),
 		clientID:     clientID,
 		clientSecret: clientSecret,
 	}
@@ -91,7 +130,11 @@ func (d *dexcomClient) getUser(ctx context.Context, authorizationCode, refreshTo
 		return nil, glitch.NewDataError(nil, ErrorMissingParam, "authorization_code or refresh_token is missing")
 	}
 
-	statusCode, ret, err := d.c.MakeRequest(ctx, http.MethodPost, slug, nil, h, strings.NewReader(values.Encode()))
+	endpoint := EndpointGetUser
+	if len(authorizationCode) == 0 {
+		endpoint = EndpointRefreshUser
+	}
+	statusCode, ret, err := d.request(ctx, endpoint, http.MethodPost, slug, nil, h, strings.NewReader(values.Encode()))
 	if err != nil {
 		return nil, err
 	}
@@ -106,7 +149,11 @@ func (d *dexcomClient) getUser(ctx context.Context, authorizationCode, refreshTo
 		result.ExpireTime = &t
 		return result, nil
 	}
-	return nil, glitch.NewDataError(fmt.Errorf("Error from API: %d - %s", statusCode, ret), ErrorAPI, fmt.Sprintf("Status code was not in the 2xx range: %d", statusCode))
+	oauthErr := oauthError{}
+	if json.Unmarshal(ret, &oauthErr) == nil && oauthErr.Error == oauthErrorInvalidGrant {
+		return nil, glitch.NewDataError(fmt.Errorf("Error from API: %d - %s", statusCode, ret), ErrorInvalidGrant, "The authorization code or refresh token is invalid, expired or revoked")
+	}
+	return nil, apiError(statusCode, ret)
 }
 
 func (d *dexcomClient) GetUser(ctx context.Context, authorizationCode, redirectURI string) (*UserToken, glitch.DataError) {
@@ -114,7 +161,37 @@ func (d *dexcomClient) GetUser(ctx context.Context, authorizationCode, redirectU
 }
 
 func (d *dexcomClient) RefreshUser(ctx context.Context, refreshToken, redirectURI string) (*UserToken, glitch.DataError) {
-	return d.getUser(ctx, "", refreshToken, redirectURI)
+	token, err := d.getUser(ctx, "", refreshToken, redirectURI)
+	MetricsFromContext(ctx).ObserveTokenRefresh(err == nil)
+	return token, err
+}
+
+// request makes a request, reporting it to the metrics, span and logger in ctx
+func (d *dexcomClient) request(ctx context.Context, endpoint, method, slug string, query url.Values, headers http.Header, body io.Reader) (int, []byte, glitch.DataError) {
+	reqBody, body := loggerFromContext(ctx).captureBody(body)
+	start := time.Now()
+	statusCode, ret, err := d.c.MakeRequest(ctx, method, slug, query, headers, body)
+	observe(ctx, endpoint, method, slug, query, headers, reqBody, statusCode, ret, len(ret), time.Since(start), err)
+	return statusCode, ret, err
+}
+
+// apiError is the error for a response outside the 2xx range.  A 401 gets ErrorUnauthorized, since the credentials
+// were rejected and a refresh may fix it.
+func apiError(statusCode int, body []byte) glitch.DataError {
+	code := ErrorAPI
+	if statusCode == http.StatusUnauthorized {
+		code = ErrorUnauthorized
+	}
+	return glitch.NewDataError(fmt.Errorf("Error from API: %d - %s", statusCode, body), code, fmt.Sprintf("Status code was not in the 2xx range: %d", statusCode))
+}
+
+// observe reports a finished request to the metrics, span and logger in ctx
+func observe(ctx context.Context, endpoint, method, slug string, query url.Values, headers http.Header, reqBody []byte, statusCode int, respBody []byte, respSize int, latency time.Duration, err glitch.DataError) {
+	MetricsFromContext(ctx).ObserveRequest(endpoint, statusCode, latency)
+	if span, ok := spanFromContext(ctx); ok && statusCode != 0 {
+		span.SetAttributes(Attribute{Key: AttributeHTTPStatus, Value: int64(statusCode)})
+	}
+	loggerFromContext(ctx).log(ctx, endpoint, method, slug, query, headers, reqBody, statusCode, respBody, respSize, latency, err)
 }
 
 func (d *dexcomClient) GetDevices(ctx context.Context, accessToken string, startDate, endDate time.Time) (*DeviceResponse, glitch.DataError) {
@@ -126,7 +203,7 @@ func (d *dexcomClient) GetDevices(ctx context.Context, accessToken string, start
 	q.Set(paramStartDate, startDate.UTC().Format(timeformat))
 	q.Set(paramEndDate, endDate.UTC().Format(timeformat))
 
-	statusCode, ret, err := d.c.MakeRequest(ctx, http.MethodGet, slug, q, h, nil)
+	statusCode, ret, err := d.request(ctx, EndpointGetDevices, http.MethodGet, slug, q, h, nil)
 	if err != nil {
 		return nil, err
 	}
@@ -139,7 +216,7 @@ func (d *dexcomClient) GetDevices(ctx context.Context, accessToken string, start
 		}
 		return result, nil
 	}
-	return nil, glitch.NewDataError(fmt.Errorf("Error from API: %d - %s", statusCode, ret), ErrorAPI, fmt.Sprintf("Status code was not in the 2xx range: %d", statusCode))
+	return nil, apiError(statusCode, ret)
 }
 
 func (d *dexcomClient) GetEGVs(ctx context.Context, accessToken string, startDate, endDate time.Time) (*EGVResponse, glitch.DataError) {
@@ -151,7 +228,7 @@ func (d *dexcomClient) GetEGVs(ctx context.Context, accessToken string, startDat
 	q.Set(paramStartDate, startDate.UTC().Format(timeformat))
 	q.Set(paramEndDate, endDate.UTC().Format(timeformat))
 
-	statusCode, ret, err := d.c.MakeRequest(ctx, http.MethodGet, slug, q, h, nil)
+	statusCode, ret, err := d.request(ctx, EndpointGetEGVs, http.MethodGet, slug, q, h, nil)
 	if err != nil {
 		return nil, err
 	}
@@ -164,7 +241,7 @@ func (d *dexcomClient) GetEGVs(ctx context.Context, accessToken string, startDat
 		}
 		return result, nil
 	}
-	return nil, glitch.NewDataError(fmt.Errorf("Error from API: %d - %s", statusCode, ret), ErrorAPI, fmt.Sprintf("Status code was not in the 2xx range: %d", statusCode))
+	return nil, apiError(statusCode, ret)
 }
 
 func (d *dexcomClient) GetEvents(ctx context.Context, accessToken string, startDate, endDate time.Time) (*EventResponse, glitch.DataError) {
@@ -176,7 +253,7 @@ func (d *dexcomClient) GetEvents(ctx context.Context, accessToken string, startD
 	q.Set(paramStartDate, startDate.UTC().Format(timeformat))
 	q.Set(paramEndDate, endDate.UTC().Format(timeformat))
 
-	statusCode, ret, err := d.c.MakeRequest(ctx, http.MethodGet, slug, q, h, nil)
+	statusCode, ret, err := d.request(ctx, EndpointGetEvents, http.MethodGet, slug, q, h, nil)
 	if err != nil {
 		return nil, err
 	}
@@ -189,7 +266,32 @@ func (d *dexcomClient) GetEvents(ctx context.Context, accessToken string, startD
 		}
 		return result, nil
 	}
-	return nil, glitch.NewDataError(fmt.Errorf("Error from API: %d - %s", statusCode, ret), ErrorAPI, fmt.Sprintf("Status code was not in the 2xx range: %d", statusCode))
+	return nil, apiError(statusCode, ret)
+}
+
+func (d *dexcomClient) GetCalibrations(ctx context.Context, accessToken string, startDate, endDate time.Time) (*CalibrationResponse, glitch.DataError) {
+	slug := "/v1/users/self/calibrations"
+	h := http.Header{}
+	h.Add("authorization", fmt.Sprintf("Bearer %s", accessToken))
+
+	q := url.Values{}
+	q.Set(paramStartDate, startDate.UTC().Format(timeformat))
+	q.Set(paramEndDate, endDate.UTC().Format(timeformat))
+
+	statusCode, ret, err := d.request(ctx, EndpointGetCalibrations, http.MethodGet, slug, q, h, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	result := new(CalibrationResponse)
+	if statusCode >= 200 && statusCode < 300 {
+		err := json.Unmarshal(ret, result)
+		if err != nil {
+			return nil, glitch.NewDataError(err, ErrorJSON, fmt.Sprintf("Could not unmarshal response with code %d | %s", statusCode, err.Error()))
+		}
+		return result, nil
+	}
+	return nil, apiError(statusCode, ret)
 }
 
 func (d *dexcomClient) GetStatistics(ctx context.Context, accessToken string, startDate, endDate time.Time, stats map[string][]StatRequest) (*Statistics, glitch.DataError) {
@@ -206,7 +308,7 @@ func (d *dexcomClient) GetStatistics(ctx context.Context, accessToken string, st
 		return nil, err
 	}
 
-	statusCode, ret, err := d.c.MakeRequest(ctx, http.MethodPost, slug, q, h, body)
+	statusCode, ret, err := d.request(ctx, EndpointGetStatistics, http.MethodPost, slug, q, h, body)
 	if err != nil {
 		return nil, err
 	}
@@ -219,5 +321,5 @@ func (d *dexcomClient) GetStatistics(ctx context.Context, accessToken string, st
 		}
 		return result, nil
 	}
-	return nil, glitch.NewDataError(fmt.Errorf("Error from API: %d - %s", statusCode, ret), ErrorAPI, fmt.Sprintf("Status code was not in the 2xx range: %d", statusCode))
+	return nil, apiError(statusCode, ret)
 }
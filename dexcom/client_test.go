@@ -24,6 +24,7 @@ func testClient(handler http.HandlerFunc, timeout time.Duration) (Client, *httpt
 	}
 	c := &dexcomClient{
 		c:            client.NewBaseClient(finder, "dexcom", true, timeout),
+		stream:       newStreamer(finder, timeout),
 		clientID:     "123",
 		clientSecret: "abc",
 	}
@@ -151,6 +152,18 @@ func TestUnit_RefreshUser(t *testing.T) {
 			redirectURI:     "abc",
 			expectedErrCode: ErrorAPI,
 		},
+		{
+			name: "exceptional path - invalid grant",
+			handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusBadRequest)
+				fmt.Fprint(w, `{"error": "invalid_grant"}`)
+			}),
+			timeout:         5 * time.Second,
+			ctx:             context.Background(),
+			refreshToken:    "123",
+			redirectURI:     "abc",
+			expectedErrCode: ErrorInvalidGrant,
+		},
 		{
 			name: "exceptional path - timeout",
 			handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
@@ -231,6 +244,19 @@ func TestUnit_GetDevices(t *testing.T) {
 			endDate:         time.Now(),
 			expectedErrCode: ErrorAPI,
 		},
+		{
+			name: "exceptional path - unauthorized",
+			handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusUnauthorized)
+				fmt.Fprint(w, `{"fault": {"faultstring": "Invalid Access Token"}}`)
+			}),
+			timeout:         5 * time.Second,
+			ctx:             context.Background(),
+			accessToken:     "123",
+			startDate:       time.Now(),
+			endDate:         time.Now(),
+			expectedErrCode: ErrorUnauthorized,
+		},
 		{
 			name: "exceptional path - timeout",
 			handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
@@ -320,7 +346,7 @@ func TestUnit_GetEGVs(t *testing.T) {
 		t.Run(tc.name, func(t *testing.T) {
 			c, ts := testClient(tc.handler, tc.timeout)
 			defer ts.Close()
-			ret, err := c.GetEGVs(tc.ctx, tc.accessToken)
+			ret, err := c.GetEGVs(tc.ctx, tc.accessToken, time.Now(), time.Now())
 			if tc.expectedErrCode != "" || err != nil {
 				if tc.expectedErrCode == "" {
 					t.Fatalf("Unexpected error occurred (%#v)", err)
@@ -417,6 +443,96 @@ func TestUnit_GetEvents(t *testing.T) {
 	}
 }
 
+func TestUnit_GetCalibrations(t *testing.T) {
+
+	type testcase struct {
+		name             string
+		handler          http.HandlerFunc
+		timeout          time.Duration
+		ctx              context.Context
+		accessToken      string
+		startDate        time.Time
+		endDate          time.Time
+		expectedErrCode  string
+		expectedResponse *CalibrationResponse
+	}
+
+	testcases := []testcase{
+		{
+			name: "base path",
+			handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				fmt.Fprint(w, `{"calibrations": [{"systemTime": "2017-06-16T19:45:00","displayTime": "2017-06-16T11:45:00","value": 142,"unit": "mg/dL"}]}`)
+			}),
+			timeout:          5 * time.Second,
+			ctx:              context.Background(),
+			accessToken:      "123",
+			startDate:        time.Now(),
+			endDate:          time.Now(),
+			expectedResponse: &CalibrationResponse{Calibrations: []Calibration{Calibration{SystemTime: "2017-06-16T19:45:00", DisplayTime: "2017-06-16T11:45:00", Value: 142, Unit: "mg/dL"}}},
+		},
+		{
+			name: "exceptional path",
+			handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusBadRequest)
+				fmt.Fprint(w, `invalid_request`)
+			}),
+			timeout:         5 * time.Second,
+			ctx:             context.Background(),
+			accessToken:     "123",
+			startDate:       time.Now(),
+			endDate:         time.Now(),
+			expectedErrCode: ErrorAPI,
+		},
+		{
+			name: "exceptional path - timeout",
+			handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				time.Sleep(2 * time.Millisecond)
+				fmt.Fprint(w, `foo`)
+			}),
+			timeout:         1 * time.Millisecond,
+			ctx:             context.Background(),
+			accessToken:     "123",
+			startDate:       time.Now(),
+			endDate:         time.Now(),
+			expectedErrCode: client.ErrorRequestError,
+		},
+	}
+
+	for _, tc := range testcases {
+		t.Run(tc.name, func(t *testing.T) {
+			c, ts := testClient(tc.handler, tc.timeout)
+			defer ts.Close()
+			ret, err := GetCalibrations(tc.ctx, c, tc.accessToken, tc.startDate, tc.endDate)
+			if tc.expectedErrCode != "" || err != nil {
+				if tc.expectedErrCode == "" {
+					t.Fatalf("Unexpected error occurred (%#v)", err)
+				}
+				if err == nil {
+					t.Fatalf("Expected error did not occur")
+				}
+				if err.Code() != tc.expectedErrCode {
+					t.Fatalf("Actual error (%#v) did not match expected (%#v)", err.Code(), tc.expectedErrCode)
+				}
+				if !reflect.DeepEqual(tc.expectedResponse, ret) {
+					t.Fatalf("Actual response (%#v) did not match expected (%#v)", ret, tc.expectedResponse)
+				}
+			}
+		})
+	}
+}
+
+func TestUnit_GetCalibrationsWithoutGetter(t *testing.T) {
+	// embedding only the Client interface hides GetCalibrations
+	c := struct{ Client }{}
+	ret, err := GetCalibrations(context.Background(), c, "token", time.Now().Add(-time.Hour), time.Now())
+	if err != nil {
+		t.Fatalf("Unexpected error occurred (%#v)", err)
+	}
+	if !reflect.DeepEqual(ret, &CalibrationResponse{}) {
+		t.Fatalf("Actual response (%#v) did not match expected (%#v)", ret, &CalibrationResponse{})
+	}
+}
+
 func TestUnit_GetStatistics(t *testing.T) {
 
 	type testcase struct {
@@ -497,3 +613,11 @@ func TestUnit_GetStatistics(t *testing.T) {
 		})
 	}
 }
+
+func TestUnit_LoginURL(t *testing.T) {
+	actual := LoginURL(SandboxBaseURL, "123", "http://localhost:8080/callback", "xyz")
+	expected := "https://sandbox-api.dexcom.com/v1/oauth2/login?client_id=123&redirect_uri=http%3A%2F%2Flocalhost%3A8080%2Fcallback&response_type=code&scope=offline_access&state=xyz"
+	if actual != expected {
+		t.Fatalf("Actual (%s) did not match expected (%s)", actual, expected)
+	}
+}
@@ -0,0 +1,297 @@
+// Package columnar converts dexcom records to column oriented record batches and writes them to Parquet files
+// partitioned by user and day.  The batches are plain Go slices, not Arrow arrays; read the Parquet files with an
+// Arrow implementation when Arrow is needed.
+package columnar
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/healthimation/go-dexcom/dexcom"
+	"github.com/healthimation/go-glitch/glitch"
+)
+
+// Type is the logical type of a column
+type Type int
+
+// Column types.  Timestamps are stored as milliseconds since the epoch; LocalTimestamp is a wall clock time, e.g.
+// displayTime, stored as if it were UTC.
+const (
+	String Type = iota
+	Int64
+	Float64
+	Timestamp
+	LocalTimestamp
+)
+
+// Field describes a column
+type Field struct {
+	Name     string
+	Type     Type
+	Nullable bool
+	// Dictionary columns hold few distinct strings, e.g. trend, and are stored as indices into Dictionary
+	Dictionary bool
+}
+
+// Column holds the values of one field.  Only the slice for the field's type is set: Strings, Int64s (for Int64 and
+// timestamps), Float64s, or Indices and Dictionary for dictionary columns.  Valid is nil when no value is null.
+type Column struct {
+	Strings    []string
+	Int64s     []int64
+	Float64s   []float64
+	Indices    []int32
+	Dictionary []string
+	Valid      []bool
+}
+
+// IsNull reports whether row i is null
+func (c *Column) IsNull(i int) bool {
+	return c.Valid != nil && !c.Valid[i]
+}
+
+// RecordBatch is a set of equal length columns
+type RecordBatch struct {
+	Schema  []Field
+	Columns []Column
+	NumRows int
+}
+
+// Schemas of the batches built by this package.  They only ever gain nullable columns at the end.
+var (
+	EGVSchema = []Field{
+		{Name: "user_id", Type: String},
+		{Name: "record_id", Type: String, Nullable: true},
+		{Name: "system_time", Type: Timestamp},
+		{Name: "display_time", Type: LocalTimestamp},
+		{Name: "value", Type: Float64},
+		{Name: "unit", Type: String, Dictionary: true},
+		{Name: "status", Type: String, Nullable: true, Dictionary: true},
+		{Name: "trend", Type: String, Nullable: true, Dictionary: true},
+		{Name: "trend_rate", Type: Float64, Nullable: true},
+	}
+	EventSchema = []Field{
+		{Name: "user_id", Type: String},
+		{Name: "record_id", Type: String, Nullable: true},
+		{Name: "system_time", Type: Timestamp},
+		{Name: "display_time", Type: LocalTimestamp},
+		{Name: "event_type", Type: String, Dictionary: true},
+		{Name: "event_sub_type", Type: String, Nullable: true, Dictionary: true},
+		{Name: "value", Type: Float64},
+		{Name: "unit", Type: String, Nullable: true, Dictionary: true},
+	}
+	StatisticsSchema = []Field{
+		{Name: "user_id", Type: String},
+		{Name: "start_date", Type: Timestamp},
+		{Name: "end_date", Type: Timestamp},
+		{Name: "hypoglycemia_risk", Type: String, Nullable: true, Dictionary: true},
+		{Name: "min", Type: Float64},
+		{Name: "max", Type: Float64},
+		{Name: "mean", Type: Float64},
+		{Name: "median", Type: Float64},
+		{Name: "variance", Type: Float64},
+		{Name: "std_dev", Type: Float64},
+		{Name: "sum", Type: Float64},
+		{Name: "q1", Type: Float64},
+		{Name: "q2", Type: Float64},
+		{Name: "q3", Type: Float64},
+		{Name: "utilization_percent", Type: Float64},
+		{Name: "mean_daily_calibrations", Type: Float64},
+		{Name: "n_days", Type: Int64},
+		{Name: "n_values", Type: Int64},
+		{Name: "n_below_range", Type: Int64},
+		{Name: "n_within_range", Type: Int64},
+		{Name: "n_above_range", Type: Int64},
+		{Name: "percent_below_range", Type: Float64},
+		{Name: "percent_within_range", Type: Float64},
+		{Name: "percent_above_range", Type: Float64},
+	}
+)
+
+// builder appends rows to a record batch one column at a time
+type builder struct {
+	batch *RecordBatch
+	dicts []map[string]int32
+	col   int
+}
+
+func newBuilder(schema []Field, capacity int) *builder {
+	b := &builder{
+		batch: &RecordBatch{Schema: schema, Columns: make([]Column, len(schema))},
+		dicts: make([]map[string]int32, len(schema)),
+	}
+	for i, f := range schema {
+		if f.Dictionary {
+			b.dicts[i] = make(map[string]int32)
+			b.batch.Columns[i].Indices = make([]int32, 0, capacity)
+		}
+	}
+	return b
+}
+
+// endRow moves on to the next row, every column must have been appended to
+func (b *builder) endRow() {
+	b.batch.NumRows++
+	b.col = 0
+}
+
+func (b *builder) valid(ok bool) {
+	c := &b.batch.Columns[b.col]
+	if c.Valid == nil && !ok {
+		c.Valid = make([]bool, b.batch.NumRows, b.batch.NumRows+1)
+		for i := range c.Valid {
+			c.Valid[i] = true
+		}
+	}
+	if c.Valid != nil {
+		c.Valid = append(c.Valid, ok)
+	}
+}
+
+// str appends a string, a nil value is null
+func (b *builder) str(value *string) {
+	c := &b.batch.Columns[b.col]
+	b.valid(value != nil)
+	s := ""
+	if value != nil {
+		s = *value
+	}
+	if d := b.dicts[b.col]; d != nil {
+		if value == nil {
+			// the index of a null is never read
+			c.Indices = append(c.Indices, 0)
+			b.col++
+			return
+		}
+		i, ok := d[s]
+		if !ok {
+			i = int32(len(c.Dictionary))
+			d[s] = i
+			c.Dictionary = append(c.Dictionary, s)
+		}
+		c.Indices = append(c.Indices, i)
+	} else {
+		c.Strings = append(c.Strings, s)
+	}
+	b.col++
+}
+
+func (b *builder) int64(value int64) {
+	b.valid(true)
+	c := &b.batch.Columns[b.col]
+	c.Int64s = append(c.Int64s, value)
+	b.col++
+}
+
+func (b *builder) float64(value *float64) {
+	b.valid(value != nil)
+	c := &b.batch.Columns[b.col]
+	f := 0.0
+	if value != nil {
+		f = *value
+	}
+	c.Float64s = append(c.Float64s, f)
+	b.col++
+}
+
+// EGVBatch converts egvs in unit to a record batch with EGVSchema
+func EGVBatch(userID, unit string, egvs []dexcom.EGV) (*RecordBatch, glitch.DataError) {
+	b := newBuilder(EGVSchema, len(egvs))
+	for _, e := range egvs {
+		system, display, err := times(e.SystemTime, e.DisplayTime)
+		if err != nil {
+			return nil, err
+		}
+		b.str(&userID)
+		b.str(optional(e.RecordID))
+		b.int64(system)
+		b.int64(display)
+		b.float64(&e.Value)
+		b.str(&unit)
+		b.str(e.Status)
+		b.str(e.Trend)
+		b.float64(e.TrendRate)
+		b.endRow()
+	}
+	return b.batch, nil
+}
+
+// EventBatch converts events to a record batch with EventSchema
+func EventBatch(userID string, events []dexcom.Event) (*RecordBatch, glitch.DataError) {
+	b := newBuilder(EventSchema, len(events))
+	for _, e := range events {
+		system, display, err := times(e.SystemTime, e.DisplayTime)
+		if err != nil {
+			return nil, err
+		}
+		b.str(&userID)
+		b.str(optional(e.RecordID))
+		b.int64(system)
+		b.int64(display)
+		b.str(&e.EventType)
+		b.str(optional(e.EventSubType))
+		b.float64(&e.Value)
+		b.str(optional(e.Unit))
+		b.endRow()
+	}
+	return b.batch, nil
+}
+
+// StatisticsBatch converts the statistics for [start, end) to a single row record batch with StatisticsSchema
+func StatisticsBatch(userID string, start, end time.Time, s *dexcom.Statistics) *RecordBatch {
+	b := newBuilder(StatisticsSchema, 1)
+	if s == nil {
+		return b.batch
+	}
+	b.str(&userID)
+	b.int64(start.UnixMilli())
+	b.int64(end.UnixMilli())
+	b.str(optional(s.HypoglycemiaRisk))
+	for _, f := range []float64{s.Min, s.Max, s.Mean, s.Median, s.Variance, s.StdDev, s.Sum, s.Q1, s.Q2, s.Q3, s.UtilizationPercent, s.MeanDailyCalibrations} {
+		b.float64(&f)
+	}
+	for _, n := range []int64{s.NDays, s.NValues, s.NBelowRange, s.NWithinRange, s.NAboveRange} {
+		b.int64(n)
+	}
+	for _, f := range []float64{s.PercentBelowRange, s.PercentWithinRange, s.PercentAboveRange} {
+		b.float64(&f)
+	}
+	b.endRow()
+	return b.batch
+}
+
+// times returns systemTime in ms since the epoch and displayTime as a wall clock in ms, falling back to systemTime
+func times(systemTime, displayTime string) (int64, int64, glitch.DataError) {
+	system, err := dexcom.ParseTime(systemTime)
+	if err != nil {
+		return 0, 0, err
+	}
+	display, derr := dexcom.ParseTime(displayTime)
+	if derr != nil {
+		display = system
+	}
+	wall := time.Date(display.Year(), display.Month(), display.Day(), display.Hour(), display.Minute(), display.Second(), display.Nanosecond(), time.UTC)
+	return system.UnixMilli(), wall.UnixMilli(), nil
+}
+
+func optional(s string) *string {
+	if s == "" {
+		return nil
+	}
+	return &s
+}
+
+func (t Type) String() string {
+	switch t {
+	case String:
+		return "string"
+	case Int64:
+		return "int64"
+	case Float64:
+		return "float64"
+	case Timestamp:
+		return "timestamp"
+	case LocalTimestamp:
+		return "local timestamp"
+	}
+	return fmt.Sprintf("Type(%d)", int(t))
+}
@@ -0,0 +1,401 @@
+package columnar
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+	"math/bits"
+
+	"github.com/healthimation/go-dexcom/dexcom"
+	"github.com/healthimation/go-glitch/glitch"
+)
+
+const parquetMagic = "PAR1"
+
+// parquet physical types, repetitions, encodings and page types from parquet.thrift
+const (
+	parquetInt64     = 2
+	parquetDouble    = 5
+	parquetByteArray = 6
+
+	parquetRequired = 0
+	parquetOptional = 1
+
+	encodingPlain           = 0
+	encodingPlainDictionary = 2
+	encodingRLE             = 3
+
+	pageData       = 0
+	pageDictionary = 2
+
+	convertedUTF8            = 0
+	convertedTimestampMillis = 9
+)
+
+// thrift compact protocol types
+const (
+	thriftTrue   = 1
+	thriftFalse  = 2
+	thriftI32    = 5
+	thriftI64    = 6
+	thriftBinary = 8
+	thriftList   = 9
+	thriftStruct = 12
+)
+
+// WriteParquet writes batches to w as an uncompressed Parquet file with one row group per batch.  Every batch must
+// have the same schema.  Dictionary columns are dictionary encoded.
+func WriteParquet(w io.Writer, batches ...*RecordBatch) glitch.DataError {
+	if len(batches) == 0 {
+		return glitch.NewDataError(fmt.Errorf("no record batches"), dexcom.ErrorMissingParam, "Nothing to write")
+	}
+	schema := batches[0].Schema
+	for _, b := range batches[1:] {
+		if !sameSchema(schema, b.Schema) {
+			return glitch.NewDataError(fmt.Errorf("record batches have different schemas"), dexcom.ErrorMissingParam, "Could not write parquet")
+		}
+	}
+
+	out := &bytes.Buffer{}
+	out.WriteString(parquetMagic)
+	var rowGroups []rowGroup
+	numRows := 0
+	for _, b := range batches {
+		rg := rowGroup{numRows: b.NumRows}
+		for i, f := range schema {
+			rg.columns = append(rg.columns, writeColumn(out, f, &b.Columns[i], b.NumRows))
+		}
+		rowGroups = append(rowGroups, rg)
+		numRows += b.NumRows
+	}
+
+	footer := fileMetaData(schema, rowGroups, numRows)
+	out.Write(footer)
+	binary.Write(out, binary.LittleEndian, uint32(len(footer)))
+	out.WriteString(parquetMagic)
+	if _, err := w.Write(out.Bytes()); err != nil {
+		return glitch.NewDataError(err, dexcom.ErrorStorage, "Could not write parquet")
+	}
+	return nil
+}
+
+type columnChunk struct {
+	field            Field
+	numValues        int
+	offset           int64
+	dictionaryOffset int64
+	dataOffset       int64
+	size             int64
+}
+
+type rowGroup struct {
+	columns []columnChunk
+	numRows int
+}
+
+// writeColumn writes the pages of a column chunk to out
+func writeColumn(out *bytes.Buffer, f Field, c *Column, numRows int) columnChunk {
+	chunk := columnChunk{field: f, numValues: numRows, offset: int64(out.Len()), dictionaryOffset: -1}
+
+	if f.Dictionary {
+		dict := &bytes.Buffer{}
+		for _, s := range c.Dictionary {
+			plainString(dict, s)
+		}
+		chunk.dictionaryOffset = int64(out.Len())
+		writePage(out, pageDictionary, dict.Bytes(), len(c.Dictionary), encodingPlainDictionary)
+	}
+
+	page := &bytes.Buffer{}
+	if f.Nullable {
+		levels := make([]uint32, numRows)
+		for i := range levels {
+			if !c.IsNull(i) {
+				levels[i] = 1
+			}
+		}
+		encoded := rle(levels, 1)
+		binary.Write(page, binary.LittleEndian, uint32(len(encoded)))
+		page.Write(encoded)
+	}
+	encoding := encodingPlain
+	switch {
+	case f.Dictionary:
+		encoding = encodingPlainDictionary
+		width := 1
+		if n := len(c.Dictionary); n > 1 {
+			width = bits.Len32(uint32(n - 1))
+		}
+		var indices []uint32
+		for i, idx := range c.Indices {
+			if !c.IsNull(i) {
+				indices = append(indices, uint32(idx))
+			}
+		}
+		page.WriteByte(byte(width))
+		page.Write(rle(indices, width))
+	case f.Type == String:
+		for i, s := range c.Strings {
+			if !c.IsNull(i) {
+				plainString(page, s)
+			}
+		}
+	case f.Type == Float64:
+		for i, v := range c.Float64s {
+			if !c.IsNull(i) {
+				binary.Write(page, binary.LittleEndian, math.Float64bits(v))
+			}
+		}
+	default:
+		for i, v := range c.Int64s {
+			if !c.IsNull(i) {
+				binary.Write(page, binary.LittleEndian, v)
+			}
+		}
+	}
+	chunk.dataOffset = int64(out.Len())
+	writePage(out, pageData, page.Bytes(), numRows, encoding)
+	chunk.size = int64(out.Len()) - chunk.offset
+	return chunk
+}
+
+func writePage(out *bytes.Buffer, pageType int, data []byte, numValues int, encoding int) {
+	t := &thriftWriter{}
+	t.i32(1, int64(pageType))
+	t.i32(2, int64(len(data)))
+	t.i32(3, int64(len(data)))
+	if pageType == pageDictionary {
+		t.structBegin(7)
+		t.i32(1, int64(numValues))
+		t.i32(2, int64(encoding))
+		t.structEnd()
+	} else {
+		t.structBegin(5)
+		t.i32(1, int64(numValues))
+		t.i32(2, int64(encoding))
+		t.i32(3, encodingRLE)
+		t.i32(4, encodingRLE)
+		t.structEnd()
+	}
+	t.stop()
+	out.Write(t.buf.Bytes())
+	out.Write(data)
+}
+
+func fileMetaData(schema []Field, rowGroups []rowGroup, numRows int) []byte {
+	t := &thriftWriter{}
+	t.i32(1, 1)
+
+	t.listBegin(2, thriftStruct, len(schema)+1)
+	t.elemBegin()
+	t.binary(4, "schema")
+	t.i32(5, int64(len(schema)))
+	t.structEnd()
+	for _, f := range schema {
+		t.elemBegin()
+		repetition := parquetRequired
+		if f.Nullable {
+			repetition = parquetOptional
+		}
+		t.i32(1, physicalType(f.Type))
+		t.i32(3, int64(repetition))
+		t.binary(4, f.Name)
+		switch f.Type {
+		case String:
+			t.i32(6, convertedUTF8)
+			t.structBegin(10)
+			t.structBegin(1) // STRING
+			t.structEnd()
+			t.structEnd()
+		case Timestamp, LocalTimestamp:
+			if f.Type == Timestamp {
+				t.i32(6, convertedTimestampMillis)
+			}
+			t.structBegin(10)
+			t.structBegin(8) // TIMESTAMP
+			t.bool(1, f.Type == Timestamp)
+			t.structBegin(2)
+			t.structBegin(1) // MILLIS
+			t.structEnd()
+			t.structEnd()
+			t.structEnd()
+			t.structEnd()
+		}
+		t.structEnd()
+	}
+
+	t.i64(3, int64(numRows))
+
+	t.listBegin(4, thriftStruct, len(rowGroups))
+	for _, rg := range rowGroups {
+		t.elemBegin()
+		t.listBegin(1, thriftStruct, len(rg.columns))
+		var total int64
+		for _, c := range rg.columns {
+			total += c.size
+			t.elemBegin()
+			t.i64(2, c.offset)
+			t.structBegin(3)
+			t.i32(1, physicalType(c.field.Type))
+			encodings := []int64{encodingPlain, encodingRLE}
+			if c.field.Dictionary {
+				encodings = []int64{encodingPlainDictionary, encodingRLE}
+			}
+			t.listBegin(2, thriftI32, len(encodings))
+			for _, e := range encodings {
+				t.varint(zigzag(e))
+			}
+			t.listBegin(3, thriftBinary, 1)
+			t.varint(uint64(len(c.field.Name)))
+			t.buf.WriteString(c.field.Name)
+			t.i32(4, 0) // UNCOMPRESSED
+			t.i64(5, int64(c.numValues))
+			t.i64(6, c.size)
+			t.i64(7, c.size)
+			t.i64(9, c.dataOffset)
+			if c.dictionaryOffset >= 0 {
+				t.i64(11, c.dictionaryOffset)
+			}
+			t.structEnd()
+			t.structEnd()
+		}
+		t.i64(2, total)
+		t.i64(3, int64(rg.numRows))
+		t.structEnd()
+	}
+	t.binary(6, "go-dexcom")
+	t.stop()
+	return t.buf.Bytes()
+}
+
+func physicalType(t Type) int64 {
+	switch t {
+	case Int64, Timestamp, LocalTimestamp:
+		return parquetInt64
+	case Float64:
+		return parquetDouble
+	}
+	return parquetByteArray
+}
+
+// rle encodes values with the RLE/bit-packing hybrid encoding, using only RLE runs
+func rle(values []uint32, width int) []byte {
+	out := &bytes.Buffer{}
+	byteWidth := (width + 7) / 8
+	for i := 0; i < len(values); {
+		j := i + 1
+		for j < len(values) && values[j] == values[i] {
+			j++
+		}
+		writeUvarint(out, uint64(j-i)<<1)
+		var b [4]byte
+		binary.LittleEndian.PutUint32(b[:], values[i])
+		out.Write(b[:byteWidth])
+		i = j
+	}
+	return out.Bytes()
+}
+
+func plainString(out *bytes.Buffer, s string) {
+	binary.Write(out, binary.LittleEndian, uint32(len(s)))
+	out.WriteString(s)
+}
+
+func sameSchema(a, b []Field) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// thriftWriter writes the thrift compact protocol
+type thriftWriter struct {
+	buf    bytes.Buffer
+	last   int16
+	parent []int16
+}
+
+func (t *thriftWriter) field(id int16, typ byte) {
+	if delta := id - t.last; delta > 0 && delta <= 15 {
+		t.buf.WriteByte(byte(delta)<<4 | typ)
+	} else {
+		t.buf.WriteByte(typ)
+		t.varint(zigzag(int64(id)))
+	}
+	t.last = id
+}
+
+func (t *thriftWriter) i32(id int16, v int64) {
+	t.field(id, thriftI32)
+	t.varint(zigzag(v))
+}
+
+func (t *thriftWriter) i64(id int16, v int64) {
+	t.field(id, thriftI64)
+	t.varint(zigzag(v))
+}
+
+func (t *thriftWriter) bool(id int16, v bool) {
+	if v {
+		t.field(id, thriftTrue)
+	} else {
+		t.field(id, thriftFalse)
+	}
+}
+
+func (t *thriftWriter) binary(id int16, s string) {
+	t.field(id, thriftBinary)
+	t.varint(uint64(len(s)))
+	t.buf.WriteString(s)
+}
+
+func (t *thriftWriter) structBegin(id int16) {
+	t.field(id, thriftStruct)
+	t.elemBegin()
+}
+
+// elemBegin starts a struct that is a list element, which has no field header
+func (t *thriftWriter) elemBegin() {
+	t.parent = append(t.parent, t.last)
+	t.last = 0
+}
+
+func (t *thriftWriter) structEnd() {
+	t.stop()
+	t.last = t.parent[len(t.parent)-1]
+	t.parent = t.parent[:len(t.parent)-1]
+}
+
+func (t *thriftWriter) stop() {
+	t.buf.WriteByte(0)
+}
+
+func (t *thriftWriter) listBegin(id int16, elemType byte, size int) {
+	t.field(id, thriftList)
+	if size < 15 {
+		t.buf.WriteByte(byte(size)<<4 | elemType)
+	} else {
+		t.buf.WriteByte(0xf0 | elemType)
+		t.varint(uint64(size))
+	}
+}
+
+func (t *thriftWriter) varint(v uint64) {
+	writeUvarint(&t.buf, v)
+}
+
+func writeUvarint(out *bytes.Buffer, v uint64) {
+	var b [binary.MaxVarintLen64]byte
+	out.Write(b[:binary.PutUvarint(b[:], v)])
+}
+
+func zigzag(v int64) uint64 {
+	return uint64((v << 1) ^ (v >> 63))
+}
@@ -0,0 +1,301 @@
+package columnar
+
+import (
+	"bytes"
+	"encoding/binary"
+	"flag"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/healthimation/go-dexcom/dexcom"
+)
+
+var update = flag.Bool("update", false, "rewrite the golden parquet files in testdata")
+
+// thriftReader decodes the thrift compact protocol into maps of field id to value, enough to check the footer
+type thriftReader struct {
+	r *bytes.Reader
+}
+
+func (t *thriftReader) uvarint() uint64 {
+	v, _ := binary.ReadUvarint(t.r)
+	return v
+}
+
+func (t *thriftReader) int() int64 {
+	v := t.uvarint()
+	return int64(v>>1) ^ -int64(v&1)
+}
+
+func (t *thriftReader) value(typ byte) interface{} {
+	switch typ {
+	case thriftTrue:
+		return true
+	case thriftFalse:
+		return false
+	case thriftI32, thriftI64:
+		return t.int()
+	case thriftBinary:
+		b := make([]byte, t.uvarint())
+		t.r.Read(b)
+		return string(b)
+	case thriftList:
+		h, _ := t.r.ReadByte()
+		size := int(h >> 4)
+		if size == 15 {
+			size = int(t.uvarint())
+		}
+		var ret []interface{}
+		for i := 0; i < size; i++ {
+			ret = append(ret, t.value(h&0x0f))
+		}
+		return ret
+	case thriftStruct:
+		return t.structure()
+	}
+	panic("unexpected thrift type")
+}
+
+func (t *thriftReader) structure() map[int]interface{} {
+	ret := map[int]interface{}{}
+	id := 0
+	for {
+		h, _ := t.r.ReadByte()
+		if h == 0 {
+			return ret
+		}
+		if h>>4 == 0 {
+			id = int(t.int())
+		} else {
+			id += int(h >> 4)
+		}
+		ret[id] = t.value(h & 0x0f)
+	}
+}
+
+// readColumn decodes the strings of a dictionary column, or the int64s or float64s of a plain column, with nil for nulls
+func readColumn(file []byte, meta map[int]interface{}, f Field) []interface{} {
+	r := &thriftReader{r: bytes.NewReader(file[meta[9].(int64):])}
+	if f.Dictionary {
+		r = &thriftReader{r: bytes.NewReader(file[meta[11].(int64):])}
+	}
+	var dict []string
+	if f.Dictionary {
+		header := r.structure()
+		data := make([]byte, header[3].(int64))
+		r.r.Read(data)
+		for n := header[7].(map[int]interface{})[1].(int64); n > 0; n-- {
+			l := binary.LittleEndian.Uint32(data)
+			dict = append(dict, string(data[4:4+l]))
+			data = data[4+l:]
+		}
+	}
+	header := r.structure()
+	numValues := int(header[5].(map[int]interface{})[1].(int64))
+	data := make([]byte, header[3].(int64))
+	r.r.Read(data)
+	levels := make([]uint64, numValues)
+	for i := range levels {
+		levels[i] = 1
+	}
+	if f.Nullable {
+		l := binary.LittleEndian.Uint32(data)
+		levels = rleDecode(data[4:4+l], 1, numValues)
+		data = data[4+l:]
+	}
+	var values []uint64
+	if f.Dictionary {
+		width := int(data[0])
+		values = rleDecode(data[1:], width, numValues)
+	} else {
+		for len(data) >= 8 {
+			values = append(values, binary.LittleEndian.Uint64(data))
+			data = data[8:]
+		}
+	}
+	var ret []interface{}
+	for _, l := range levels {
+		if l == 0 {
+			ret = append(ret, nil)
+			continue
+		}
+		v := values[0]
+		values = values[1:]
+		switch {
+		case f.Dictionary:
+			ret = append(ret, dict[v])
+		default:
+			ret = append(ret, int64(v))
+		}
+	}
+	return ret
+}
+
+func rleDecode(data []byte, width, max int) []uint64 {
+	r := bytes.NewReader(data)
+	var ret []uint64
+	for len(ret) < max && r.Len() > 0 {
+		h, _ := binary.ReadUvarint(r)
+		b := make([]byte, 8)
+		r.Read(b[:(width+7)/8])
+		for n := h >> 1; n > 0; n-- {
+			ret = append(ret, binary.LittleEndian.Uint64(b))
+		}
+	}
+	return ret
+}
+
+func TestUnit_WriteParquet(t *testing.T) {
+	low := dexcom.StatusLow
+	flat := dexcom.TrendFlat
+	down := dexcom.TrendSingleDown
+	egvs := []dexcom.EGV{
+		dexcom.EGV{SystemTime: "2017-06-16T15:40:00", DisplayTime: "2017-06-16T08:40:00", Value: 119, Trend: &flat},
+		dexcom.EGV{SystemTime: "2017-06-16T15:45:00", DisplayTime: "2017-06-16T08:45:00", Value: 40, Status: &low, Trend: &down},
+		dexcom.EGV{SystemTime: "2017-06-16T15:50:00", DisplayTime: "2017-06-16T08:50:00", Value: 45, Trend: &down},
+	}
+	batch, err := EGVBatch("user", "mg/dL", egvs)
+	if err != nil {
+		t.Fatalf("Unexpected error occurred (%#v)", err)
+	}
+	buf := &bytes.Buffer{}
+	if err := WriteParquet(buf, batch, batch); err != nil {
+		t.Fatalf("Unexpected error occurred (%#v)", err)
+	}
+	file := buf.Bytes()
+	if string(file[:4]) != parquetMagic || string(file[len(file)-4:]) != parquetMagic {
+		t.Fatalf("Missing parquet magic")
+	}
+	footerLen := binary.LittleEndian.Uint32(file[len(file)-8:])
+	footer := (&thriftReader{r: bytes.NewReader(file[len(file)-8-int(footerLen) : len(file)-8])}).structure()
+
+	if footer[3].(int64) != 6 {
+		t.Fatalf("Actual num_rows (%v) did not match expected (6)", footer[3])
+	}
+	schema := footer[2].([]interface{})
+	if len(schema) != len(EGVSchema)+1 {
+		t.Fatalf("Actual schema (%v) did not have %d elements", schema, len(EGVSchema)+1)
+	}
+	for i, f := range EGVSchema {
+		if name := schema[i+1].(map[int]interface{})[4]; name != f.Name {
+			t.Fatalf("Actual column (%v) did not match expected (%v)", name, f.Name)
+		}
+	}
+	rowGroups := footer[4].([]interface{})
+	if len(rowGroups) != 2 {
+		t.Fatalf("Actual row groups (%d) did not match expected (2)", len(rowGroups))
+	}
+	columns := rowGroups[1].(map[int]interface{})[1].([]interface{})
+	meta := func(i int) map[int]interface{} {
+		return columns[i].(map[int]interface{})[3].(map[int]interface{})
+	}
+
+	expected := map[string][]interface{}{
+		"system_time":  []interface{}{int64(1497627600000), int64(1497627900000), int64(1497628200000)},
+		"display_time": []interface{}{int64(1497602400000), int64(1497602700000), int64(1497603000000)},
+		"status":       []interface{}{nil, "low", nil},
+		"trend":        []interface{}{"flat", "singleDown", "singleDown"},
+	}
+	for i, f := range EGVSchema {
+		want, ok := expected[f.Name]
+		if !ok {
+			continue
+		}
+		if actual := readColumn(file, meta(i), f); !reflect.DeepEqual(actual, want) {
+			t.Fatalf("Actual %s (%v) did not match expected (%v)", f.Name, actual, want)
+		}
+	}
+
+	if err := WriteParquet(buf, batch, StatisticsBatch("user", time.Now(), time.Now(), &dexcom.Statistics{})); err == nil {
+		t.Fatalf("Expected error did not occur")
+	}
+}
+
+func TestUnit_ReplaceEGVPartitions(t *testing.T) {
+	dir := t.TempDir()
+	egvs := []dexcom.EGV{
+		dexcom.EGV{SystemTime: "2017-06-16T23:55:00", Value: 119},
+		dexcom.EGV{SystemTime: "2017-06-17T00:00:00", Value: 121},
+	}
+	paths, err := ReplaceEGVPartitions(dir, "user/1", "mg/dL", egvs)
+	if err != nil {
+		t.Fatalf("Unexpected error occurred (%#v)", err)
+	}
+	expected := []string{
+		filepath.Join(dir, "user=user%2F1", "date=2017-06-16", "egvs.parquet"),
+		filepath.Join(dir, "user=user%2F1", "date=2017-06-17", "egvs.parquet"),
+	}
+	if !reflect.DeepEqual(paths, expected) {
+		t.Fatalf("Actual (%v) did not match expected (%v)", paths, expected)
+	}
+	for _, p := range paths {
+		if _, err := os.Stat(p); err != nil {
+			t.Fatalf("Unexpected error occurred (%#v)", err)
+		}
+	}
+}
+
+// The golden files in testdata were read back with github.com/xitongsys/parquet-go, an independent reader built on the
+// apache thrift library, which returned the schema, logical types and rows below.  Any change to the bytes written
+// needs the new files checking the same way before they are committed with -update.
+func TestUnit_WriteParquetGolden(t *testing.T) {
+	low := dexcom.StatusLow
+	flat := dexcom.TrendFlat
+	down := dexcom.TrendSingleDown
+	rate := -1.5
+	egvs, err := EGVBatch("user", "mg/dL", []dexcom.EGV{
+		dexcom.EGV{SystemTime: "2017-06-16T15:40:00", DisplayTime: "2017-06-16T08:40:00", Value: 119, Trend: &flat},
+		dexcom.EGV{SystemTime: "2017-06-16T15:45:00", DisplayTime: "2017-06-16T08:45:00", Value: 40, Status: &low, Trend: &down, TrendRate: &rate},
+		dexcom.EGV{SystemTime: "2017-06-16T15:50:00", DisplayTime: "2017-06-16T08:50:00", Value: 45, Trend: &down},
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error occurred (%#v)", err)
+	}
+	events, err := EventBatch("user", []dexcom.Event{
+		dexcom.Event{SystemTime: "2017-06-16T19:45:00", DisplayTime: "2017-06-16T12:45:00", EventType: "exercise", EventSubType: "medium", Value: 42, Unit: "minutes"},
+		dexcom.Event{SystemTime: "2017-06-16T19:50:00", DisplayTime: "2017-06-16T12:50:00", EventType: "carbs", Value: 45, Unit: "grams"},
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error occurred (%#v)", err)
+	}
+	start := time.Date(2017, 6, 1, 0, 0, 0, 0, time.UTC)
+	stats := StatisticsBatch("user", start, start.AddDate(0, 0, 14), &dexcom.Statistics{Mean: 154, NValues: 4032, HypoglycemiaRisk: "low"})
+
+	type testcase struct {
+		file    string
+		batches []*RecordBatch
+	}
+
+	testcases := []testcase{
+		// read back as 6 rows in 2 row groups: status null, low, null; trend flat, singleDown, singleDown; trend_rate
+		// null, -1.5, null; display_time a timestamp not adjusted to utc
+		{file: "egvs.parquet", batches: []*RecordBatch{egvs, egvs}},
+		// read back as exercise/medium/42 minutes and carbs/null/45 grams
+		{file: "events.parquet", batches: []*RecordBatch{events}},
+		// read back as one row with mean 154, n_values 4032 and hypoglycemia_risk low
+		{file: "statistics.parquet", batches: []*RecordBatch{stats}},
+	}
+
+	for _, tc := range testcases {
+		buf := &bytes.Buffer{}
+		if err := WriteParquet(buf, tc.batches...); err != nil {
+			t.Fatalf("[%s] Unexpected error occurred (%#v)", tc.file, err)
+		}
+		path := filepath.Join("testdata", tc.file)
+		if *update {
+			if err := os.WriteFile(path, buf.Bytes(), 0644); err != nil {
+				t.Fatalf("[%s] Unexpected error occurred (%#v)", tc.file, err)
+			}
+		}
+		golden, rerr := os.ReadFile(path)
+		if rerr != nil {
+			t.Fatalf("[%s] Unexpected error occurred (%#v)", tc.file, rerr)
+		}
+		if !bytes.Equal(buf.Bytes(), golden) {
+			t.Fatalf("[%s] Actual file (%d bytes) did not match the golden file (%d bytes)", tc.file, buf.Len(), len(golden))
+		}
+	}
+}
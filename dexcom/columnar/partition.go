@@ -0,0 +1,99 @@
+package columnar
+
+import (
+	"bytes"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/healthimation/go-dexcom/dexcom"
+	"github.com/healthimation/go-glitch/glitch"
+)
+
+const partitionDate = "2006-01-02"
+
+// PartitionPath returns the hive style directory for a user and UTC day, dir/user=<id>/date=<yyyy-mm-dd>
+func PartitionPath(dir, userID string, day time.Time) string {
+	return filepath.Join(dir, "user="+url.PathEscape(userID), "date="+day.UTC().Format(partitionDate))
+}
+
+// ReplaceEGVPartitions writes egvs to egvs.parquet in the partition of each UTC day they fall on and returns the paths
+// written.  A day's file is replaced with only the egvs passed for that day, so pass every egv of each day they cover,
+// e.g. whole days fetched again after a sync.
+func ReplaceEGVPartitions(dir, userID, unit string, egvs []dexcom.EGV) ([]string, glitch.DataError) {
+	return writePartitions(dir, userID, "egvs.parquet", egvs, func(e dexcom.EGV) string { return e.SystemTime },
+		func(egvs []dexcom.EGV) (*RecordBatch, glitch.DataError) { return EGVBatch(userID, unit, egvs) })
+}
+
+// ReplaceEventPartitions writes events to events.parquet in the partition of each UTC day they fall on, replacing each
+// day's file like ReplaceEGVPartitions
+func ReplaceEventPartitions(dir, userID string, events []dexcom.Event) ([]string, glitch.DataError) {
+	return writePartitions(dir, userID, "events.parquet", events, func(e dexcom.Event) string { return e.SystemTime },
+		func(events []dexcom.Event) (*RecordBatch, glitch.DataError) { return EventBatch(userID, events) })
+}
+
+// WriteStatisticsPartition writes the statistics for [start, end) to statistics.parquet in the partition of start
+func WriteStatisticsPartition(dir, userID string, start, end time.Time, stats *dexcom.Statistics) (string, glitch.DataError) {
+	path := filepath.Join(PartitionPath(dir, userID, start), "statistics.parquet")
+	return path, writeFile(path, StatisticsBatch(userID, start, end, stats))
+}
+
+func writePartitions[T any](dir, userID, name string, records []T, systemTime func(T) string, batch func([]T) (*RecordBatch, glitch.DataError)) ([]string, glitch.DataError) {
+	days := make(map[time.Time][]T)
+	for _, r := range records {
+		t, err := dexcom.ParseTime(systemTime(r))
+		if err != nil {
+			return nil, err
+		}
+		day := t.UTC().Truncate(24 * time.Hour)
+		days[day] = append(days[day], r)
+	}
+	keys := make([]time.Time, 0, len(days))
+	for day := range days {
+		keys = append(keys, day)
+	}
+	sort.Slice(keys, func(i, j int) bool { return keys[i].Before(keys[j]) })
+
+	var ret []string
+	for _, day := range keys {
+		b, err := batch(days[day])
+		if err != nil {
+			return ret, err
+		}
+		path := filepath.Join(PartitionPath(dir, userID, day), name)
+		if err := writeFile(path, b); err != nil {
+			return ret, err
+		}
+		ret = append(ret, path)
+	}
+	return ret, nil
+}
+
+// writeFile writes a parquet file through a temp file so readers never see a partial file
+func writeFile(path string, b *RecordBatch) glitch.DataError {
+	buf := &bytes.Buffer{}
+	if err := WriteParquet(buf, b); err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return glitch.NewDataError(err, dexcom.ErrorStorage, "Could not create partition")
+	}
+	f, err := os.CreateTemp(filepath.Dir(path), ".tmp-*")
+	if err != nil {
+		return glitch.NewDataError(err, dexcom.ErrorStorage, "Could not create parquet file")
+	}
+	defer os.Remove(f.Name())
+	_, err = f.Write(buf.Bytes())
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Rename(f.Name(), path)
+	}
+	if err != nil {
+		return glitch.NewDataError(err, dexcom.ErrorStorage, "Could not write parquet file")
+	}
+	return nil
+}
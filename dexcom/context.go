@@ -0,0 +1,54 @@
+package dexcom
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+)
+
+type contextKey int
+
+const (
+	contextKeyUserID contextKey = iota
+	contextKeyMetrics
+	contextKeySpan
+	contextKeyLogger
+	contextKeyRequestID
+	contextKeyDrain
+)
+
+// WithUserID tags ctx with the id of the user whose token is being used.  Caching uses it to key entries by user
+// rather than by token, so entries survive token refreshes.
+func WithUserID(ctx context.Context, userID string) context.Context {
+	return context.WithValue(ctx, contextKeyUserID, userID)
+}
+
+// UserIDFromContext returns the user id set by WithUserID
+func UserIDFromContext(ctx context.Context) (string, bool) {
+	if ctx == nil {
+		return "", false
+	}
+	userID, ok := ctx.Value(contextKeyUserID).(string)
+	return userID, ok
+}
+
+// WithDrain tags ctx with a channel that is closed on shutdown.  Once it is closed a Scheduler run starts no new user
+// syncs, while those already running finish on ctx.
+func WithDrain(ctx context.Context, drain <-chan struct{}) context.Context {
+	return context.WithValue(ctx, contextKeyDrain, drain)
+}
+
+// drainFromContext returns the channel set by WithDrain, nil (never closed) when there is none
+func drainFromContext(ctx context.Context) <-chan struct{} {
+	drain, _ := ctx.Value(contextKeyDrain).(<-chan struct{})
+	return drain
+}
+
+// userKey identifies the user behind a request without ever exposing the access token
+func userKey(ctx context.Context, accessToken string) string {
+	if userID, ok := UserIDFromContext(ctx); ok {
+		return "user:" + userID
+	}
+	sum := sha256.Sum256([]byte(accessToken))
+	return "token:" + hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,246 @@
+package dexcom
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"strconv"
+	"time"
+
+	"github.com/healthimation/go-glitch/glitch"
+)
+
+// CSVOptions controls a CSVWriter
+type CSVOptions struct {
+	// Columns to write, in order.  Defaults to ClarityColumns(Unit).
+	Columns []string
+	// Unit glucose values are written in, mg/dL or mmol/L.  Defaults to mg/dL.
+	Unit string
+	// Location timestamps are rendered in.  When nil the displayTime reported by the device is written as is.
+	Location *time.Location
+}
+
+// CSVWriter writes egvs, events and devices in the layout of a Dexcom Clarity CSV export
+type CSVWriter struct {
+	w       *csv.Writer
+	opts    CSVOptions
+	known   map[string]bool
+	index   int
+	started bool
+}
+
+// NewCSVWriter returns a CSVWriter writing to w.  Devices should be written first since Clarity puts device and alert
+// rows ahead of the readings.
+func NewCSVWriter(w io.Writer, opts CSVOptions) *CSVWriter {
+	if opts.Unit == "" {
+		opts.Unit = UnitMgDL
+	}
+	if len(opts.Columns) == 0 {
+		opts.Columns = ClarityColumns(opts.Unit)
+	}
+	known := make(map[string]bool)
+	for _, c := range ClarityColumns(opts.Unit) {
+		known[c] = true
+	}
+	return &CSVWriter{w: csv.NewWriter(w), opts: opts, known: known}
+}
+
+// WriteDevices writes a Device row for each device followed by an Alert row for each of its alert settings
+func (c *CSVWriter) WriteDevices(resp *DeviceResponse) glitch.DataError {
+	if resp == nil {
+		return nil
+	}
+	for _, d := range resp.Devices {
+		err := c.write(map[string]string{
+			ClarityEventType:      clarityDevice,
+			ClarityDeviceInfo:     d.Model,
+			ClaritySourceDeviceID: d.Model,
+		})
+		if err != nil {
+			return err
+		}
+		for _, a := range d.AlertSettings {
+			row := map[string]string{
+				ClarityTimestamp:      c.timestamp(a.SystemTime, a.DisplayTime),
+				ClarityEventType:      clarityAlert,
+				ClarityEventSubtype:   toClarity(clarityAlerts, a.AlertName),
+				ClaritySourceDeviceID: d.Model,
+			}
+			switch {
+			case a.Unit == "minutes":
+				row[ClarityDuration] = duration(a.Value)
+			case isRate(a.Unit):
+				row[c.rateColumn()] = c.glucose(a.Value, a.Unit)
+			case a.Value != 0:
+				row[c.glucoseColumn()] = c.glucose(a.Value, a.Unit)
+			}
+			if err := c.write(row); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// WriteEGVs writes an EGV row for each reading.  Readings outside the sensor range are written as High or Low, as
+// Clarity does.
+func (c *CSVWriter) WriteEGVs(resp *EGVResponse) glitch.DataError {
+	if resp == nil {
+		return nil
+	}
+	unit := resp.Unit
+	if unit == "" {
+		unit = UnitMgDL
+	}
+	rateUnit := resp.RateUnit
+	if rateUnit == "" {
+		rateUnit = unit + "/min"
+	}
+	for _, e := range resp.EGVs {
+		row := map[string]string{
+			ClarityTimestamp:  c.timestamp(e.SystemTime, e.DisplayTime),
+			ClarityEventType:  clarityEGV,
+			c.glucoseColumn(): c.glucose(e.Value, unit),
+		}
+		if e.Status != nil {
+			switch *e.Status {
+			case StatusLow:
+				row[c.glucoseColumn()] = clarityLow
+			case StatusHigh:
+				row[c.glucoseColumn()] = clarityHigh
+			}
+		}
+		if e.TrendRate != nil {
+			row[c.rateColumn()] = c.glucose(*e.TrendRate, rateUnit)
+		}
+		if err := c.write(row); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// WriteEvents writes a row for each carbs, insulin, exercise and health event
+func (c *CSVWriter) WriteEvents(resp *EventResponse) glitch.DataError {
+	if resp == nil {
+		return nil
+	}
+	for _, e := range resp.Events {
+		row := map[string]string{
+			ClarityTimestamp:    c.timestamp(e.SystemTime, e.DisplayTime),
+			ClarityEventType:    toClarity(clarityEventTypes, e.EventType),
+			ClarityEventSubtype: toClarity(claritySubtypes, e.EventSubType),
+		}
+		switch e.EventType {
+		case "carbs":
+			row[ClarityCarbs] = number(e.Value)
+		case "insulin":
+			row[ClarityInsulin] = number(e.Value)
+		case "exercise":
+			row[ClarityDuration] = duration(e.Value)
+		}
+		if err := c.write(row); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// WriteCalibrations writes a Calibration row for each calibration
+func (c *CSVWriter) WriteCalibrations(resp *CalibrationResponse) glitch.DataError {
+	if resp == nil {
+		return nil
+	}
+	for _, cal := range resp.Calibrations {
+		row := map[string]string{
+			ClarityTimestamp:  c.timestamp(cal.SystemTime, cal.DisplayTime),
+			ClarityEventType:  clarityCalibration,
+			c.glucoseColumn(): c.glucose(cal.Value, cal.Unit),
+		}
+		if err := c.write(row); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Flush writes any buffered rows to the underlying writer
+func (c *CSVWriter) Flush() glitch.DataError {
+	c.w.Flush()
+	if err := c.w.Error(); err != nil {
+		return glitch.NewDataError(err, ErrorCSV, "Could not write csv")
+	}
+	return nil
+}
+
+func (c *CSVWriter) write(row map[string]string) glitch.DataError {
+	if !c.started {
+		for _, col := range c.opts.Columns {
+			if !c.known[col] {
+				return glitch.NewDataError(fmt.Errorf("unknown column %q", col), ErrorCSV, "Could not write csv header")
+			}
+		}
+		if err := c.w.Write(c.opts.Columns); err != nil {
+			return glitch.NewDataError(err, ErrorCSV, "Could not write csv header")
+		}
+		c.started = true
+	}
+	c.index++
+	row[ClarityIndex] = strconv.Itoa(c.index)
+
+	record := make([]string, len(c.opts.Columns))
+	for i, col := range c.opts.Columns {
+		record[i] = row[col]
+	}
+	if err := c.w.Write(record); err != nil {
+		return glitch.NewDataError(err, ErrorCSV, "Could not write csv row")
+	}
+	return nil
+}
+
+func (c *CSVWriter) glucoseColumn() string {
+	if isMmolL(c.opts.Unit) {
+		return ClarityGlucoseMmolL
+	}
+	return ClarityGlucoseMgDL
+}
+
+func (c *CSVWriter) rateColumn() string {
+	if isMmolL(c.opts.Unit) {
+		return ClarityRateMmolL
+	}
+	return ClarityRateMgDL
+}
+
+// glucose converts value to the output unit, to one decimal place as Clarity does for mmol/L
+func (c *CSVWriter) glucose(value float64, unit string) string {
+	to := c.opts.Unit
+	if isRate(unit) {
+		to += "/min"
+	}
+	return number(round(ConvertGlucose(value, unit, to), 1))
+}
+
+func (c *CSVWriter) timestamp(systemTime, displayTime string) string {
+	if c.opts.Location == nil {
+		if t, err := ParseTime(displayTime); err == nil {
+			return t.Format(timeformat)
+		}
+		return displayTime
+	}
+	t, err := ParseTime(systemTime)
+	if err != nil {
+		return displayTime
+	}
+	return t.In(c.opts.Location).Format(timeformat)
+}
+
+func number(value float64) string {
+	return strconv.FormatFloat(value, 'f', -1, 64)
+}
+
+// duration formats minutes as hh:mm:ss
+func duration(minutes float64) string {
+	d := time.Duration(minutes * float64(time.Minute)).Round(time.Second)
+	return fmt.Sprintf("%02d:%02d:%02d", int(d.Hours()), int(d.Minutes())%60, int(d.Seconds())%60)
+}
@@ -0,0 +1,292 @@
+package dexcom
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/healthimation/go-glitch/glitch"
+)
+
+// ClarityExport holds the records read from a Dexcom Clarity CSV export
+type ClarityExport struct {
+	FirstName    string
+	LastName     string
+	EGVs         *EGVResponse
+	Events       *EventResponse
+	Devices      *DeviceResponse
+	Calibrations *CalibrationResponse
+}
+
+// ReadClarityCSV parses a Clarity CSV export into the types the api returns.  Clarity only records display time, so
+// loc is the time zone the patient's device was set to and is used to work out systemTime.  A nil loc means UTC.
+func ReadClarityCSV(r io.Reader, loc *time.Location) (*ClarityExport, glitch.DataError) {
+	if loc == nil {
+		loc = time.UTC
+	}
+	cr := csv.NewReader(r)
+	cr.FieldsPerRecord = -1
+	header, err := cr.Read()
+	if err != nil {
+		return nil, glitch.NewDataError(err, ErrorCSV, "Could not read csv header")
+	}
+
+	p := &clarityParser{columns: make(map[string]int), loc: loc, unit: UnitMgDL}
+	for i, col := range header {
+		col = strings.TrimSpace(strings.TrimPrefix(col, "\ufeff"))
+		p.columns[col] = i
+		if col == ClarityGlucoseMmolL {
+			p.unit = UnitMmolL
+		}
+	}
+	for _, col := range []string{ClarityTimestamp, ClarityEventType} {
+		if _, ok := p.columns[col]; !ok {
+			return nil, glitch.NewDataError(fmt.Errorf("missing column %q", col), ErrorCSV, "Not a Clarity export")
+		}
+	}
+
+	p.ret = &ClarityExport{
+		EGVs:         &EGVResponse{Unit: p.unit, RateUnit: p.unit + "/min"},
+		Events:       &EventResponse{},
+		Devices:      &DeviceResponse{},
+		Calibrations: &CalibrationResponse{},
+	}
+	for line := 2; ; line++ {
+		row, err := cr.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, glitch.NewDataError(err, ErrorCSV, "Could not read csv row")
+		}
+		p.row = row
+		if err := p.parse(); err != nil {
+			return nil, glitch.NewDataError(err, ErrorCSV, fmt.Sprintf("Could not parse csv line %d", line))
+		}
+	}
+	return p.ret, nil
+}
+
+type clarityParser struct {
+	columns map[string]int
+	loc     *time.Location
+	unit    string
+	row     []string
+	ret     *ClarityExport
+	// devices maps a source device id to its index in ret.Devices
+	devices map[string]int
+}
+
+func (p *clarityParser) parse() error {
+	switch p.get(ClarityEventType) {
+	case clarityFirstName:
+		p.ret.FirstName = p.get(ClarityPatientInfo)
+	case clarityLastName:
+		p.ret.LastName = p.get(ClarityPatientInfo)
+	case clarityDevice:
+		model := p.get(ClarityDeviceInfo)
+		if model == "" {
+			model = p.get(ClaritySourceDeviceID)
+		}
+		p.device(p.get(ClaritySourceDeviceID), model)
+	case clarityAlert:
+		return p.alert()
+	case clarityEGV:
+		return p.egv()
+	case clarityCalibration:
+		return p.calibration()
+	case clarityEventTypes["carbs"], clarityEventTypes["insulin"], clarityEventTypes["exercise"], clarityEventTypes["health"]:
+		return p.event()
+	}
+	// date of birth and any rows newer versions of Clarity add are skipped
+	return nil
+}
+
+// alert adds an alert setting to its device.  Clarity leaves the timestamp blank on alert rows like it does on device
+// rows, so the setting only gets a time when the row has one.
+func (p *clarityParser) alert() error {
+	a := AlertSetting{AlertName: fromClarity(clarityAlerts, p.get(ClarityEventSubtype)), Enabled: true}
+	var err error
+	if p.get(ClarityTimestamp) != "" {
+		if a.SystemTime, a.DisplayTime, err = p.times(); err != nil {
+			return err
+		}
+	}
+	switch {
+	case p.get(p.glucoseColumn()) != "":
+		a.Value, err = p.number(p.glucoseColumn())
+		a.Unit = p.unit
+	case p.get(p.rateColumn()) != "":
+		a.Value, err = p.number(p.rateColumn())
+		a.Unit = p.unit + "/min"
+	case p.get(ClarityDuration) != "":
+		a.Value, err = parseDuration(p.get(ClarityDuration))
+		a.Unit = "minutes"
+	}
+	if err != nil {
+		return err
+	}
+	source := p.get(ClaritySourceDeviceID)
+	d := &p.ret.Devices.Devices[p.device(source, source)]
+	d.AlertSettings = append(d.AlertSettings, a)
+	return nil
+}
+
+func (p *clarityParser) egv() error {
+	systemTime, displayTime, err := p.times()
+	if err != nil {
+		return err
+	}
+	e := EGV{SystemTime: systemTime, DisplayTime: displayTime}
+	switch value := p.get(p.glucoseColumn()); value {
+	case clarityLow, clarityHigh:
+		status, limit := StatusLow, float64(sensorLow)
+		if value == clarityHigh {
+			status, limit = StatusHigh, sensorHigh
+		}
+		e.Status = &status
+		e.Value = round(ConvertGlucose(limit, UnitMgDL, p.unit), 1)
+	default:
+		if e.Value, err = p.number(p.glucoseColumn()); err != nil {
+			return err
+		}
+	}
+	if p.get(p.rateColumn()) != "" {
+		rate, err := p.number(p.rateColumn())
+		if err != nil {
+			return err
+		}
+		trend := TrendForRate(ConvertGlucose(rate, p.unit+"/min", UnitMgDLPerMin))
+		e.TrendRate = &rate
+		e.Trend = &trend
+	}
+	p.ret.EGVs.EGVs = append(p.ret.EGVs.EGVs, e)
+	return nil
+}
+
+func (p *clarityParser) calibration() error {
+	systemTime, displayTime, err := p.times()
+	if err != nil {
+		return err
+	}
+	value, err := p.number(p.glucoseColumn())
+	if err != nil {
+		return err
+	}
+	p.ret.Calibrations.Calibrations = append(p.ret.Calibrations.Calibrations, Calibration{
+		SystemTime:  systemTime,
+		DisplayTime: displayTime,
+		Value:       value,
+		Unit:        p.unit,
+	})
+	return nil
+}
+
+func (p *clarityParser) event() error {
+	systemTime, displayTime, err := p.times()
+	if err != nil {
+		return err
+	}
+	e := Event{
+		SystemTime:   systemTime,
+		DisplayTime:  displayTime,
+		EventType:    fromClarity(clarityEventTypes, p.get(ClarityEventType)),
+		EventSubType: fromClarity(claritySubtypes, p.get(ClarityEventSubtype)),
+	}
+	switch e.EventType {
+	case "carbs":
+		e.Value, err = p.number(ClarityCarbs)
+		e.Unit = "grams"
+	case "insulin":
+		e.Value, err = p.number(ClarityInsulin)
+		e.Unit = "units"
+	case "exercise":
+		e.Value, err = parseDuration(p.get(ClarityDuration))
+		e.Unit = "minutes"
+	}
+	if err != nil {
+		return err
+	}
+	p.ret.Events.Events = append(p.ret.Events.Events, e)
+	return nil
+}
+
+// device returns the index of the device with the source device id, adding it when it has not been seen
+func (p *clarityParser) device(source, model string) int {
+	if p.devices == nil {
+		p.devices = make(map[string]int)
+	}
+	if i, ok := p.devices[source]; ok {
+		return i
+	}
+	p.ret.Devices.Devices = append(p.ret.Devices.Devices, Device{Model: model})
+	p.devices[source] = len(p.ret.Devices.Devices) - 1
+	return p.devices[source]
+}
+
+// times returns the systemTime and displayTime of the row
+func (p *clarityParser) times() (string, string, error) {
+	t, err := ParseTime(p.get(ClarityTimestamp))
+	if err != nil {
+		return "", "", err
+	}
+	local := time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), t.Minute(), t.Second(), t.Nanosecond(), p.loc)
+	return FormatTime(local), t.Format(timeformat), nil
+}
+
+func (p *clarityParser) get(col string) string {
+	i, ok := p.columns[col]
+	if !ok || i >= len(p.row) {
+		return ""
+	}
+	return strings.TrimSpace(p.row[i])
+}
+
+func (p *clarityParser) number(col string) (float64, error) {
+	value := p.get(col)
+	if value == "" {
+		return 0, nil
+	}
+	ret, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		return 0, fmt.Errorf("%s: %v", col, err)
+	}
+	return ret, nil
+}
+
+func (p *clarityParser) glucoseColumn() string {
+	if isMmolL(p.unit) {
+		return ClarityGlucoseMmolL
+	}
+	return ClarityGlucoseMgDL
+}
+
+func (p *clarityParser) rateColumn() string {
+	if isMmolL(p.unit) {
+		return ClarityRateMmolL
+	}
+	return ClarityRateMgDL
+}
+
+// parseDuration parses hh:mm:ss into minutes
+func parseDuration(value string) (float64, error) {
+	if value == "" {
+		return 0, nil
+	}
+	parts := strings.Split(value, ":")
+	if len(parts) != 3 {
+		return 0, fmt.Errorf("unrecognized duration %q", value)
+	}
+	var ret float64
+	for _, part := range parts {
+		n, err := strconv.ParseFloat(part, 64)
+		if err != nil {
+			return 0, fmt.Errorf("unrecognized duration %q", value)
+		}
+		ret = ret*60 + n
+	}
+	return ret / 60, nil
+}
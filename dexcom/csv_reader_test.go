@@ -0,0 +1,111 @@
+package dexcom
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestUnit_ReadClarityCSV(t *testing.T) {
+	type testcase struct {
+		name            string
+		csv             string
+		loc             *time.Location
+		expectedErrCode string
+		expected        *ClarityExport
+	}
+
+	mgdl := "\ufeff" + `Index,Timestamp (YYYY-MM-DDThh:mm:ss),Event Type,Event Subtype,Patient Info,Device Info,Source Device ID,Glucose Value (mg/dL),Insulin Value (u),Carb Value (grams),Duration (hh:mm:ss),Glucose Rate of Change (mg/dL/min),Transmitter Time (Long Integer),Transmitter ID
+1,,FirstName,,Jane,,,,,,,,,
+2,,LastName,,Doe,,,,,,,,,
+3,,DateOfBirth,,1980-01-01,,,,,,,,,
+4,,Device,,,Dexcom G6 Mobile App,Android G6,,,,,,,
+5,,Alert,Urgent Low,,,Android G6,55,,,,,,
+6,,Alert,Signal Loss,,,Android G6,,,,00:20:00,,,
+7,2017-06-16T08:40:00,EGV,,,,Android G6,119,,,,-1.3,9331306,80AAAA
+8,2017-06-16T08:45:00,EGV,,,,Android G6,High,,,,,9331606,80AAAA
+9,2017-06-16T09:00:00,Calibration,,,,Android G6,121,,,,,,
+10,2017-06-16T12:00:00,Carbs,,,,Android G6,,,45,,,,
+11,2017-06-16T12:05:00,Insulin,Fast-Acting,,,Android G6,,4.5,,,,,
+12,2017-06-16T18:00:00,Exercise,Heavy,,,Android G6,,,,01:30:00,,,
+`
+	low := StatusLow
+	high := StatusHigh
+	rate := -1.3
+	trend := TrendFortyFiveDown
+	testcases := []testcase{
+		{
+			name: "base path",
+			csv:  mgdl,
+			loc:  time.FixedZone("", -7*60*60),
+			expected: &ClarityExport{
+				FirstName: "Jane",
+				LastName:  "Doe",
+				EGVs: &EGVResponse{Unit: "mg/dL", RateUnit: "mg/dL/min", EGVs: []EGV{
+					EGV{SystemTime: "2017-06-16T15:40:00", DisplayTime: "2017-06-16T08:40:00", Value: 119, TrendRate: &rate, Trend: &trend},
+					EGV{SystemTime: "2017-06-16T15:45:00", DisplayTime: "2017-06-16T08:45:00", Value: 400, Status: &high},
+				}},
+				Events: &EventResponse{Events: []Event{
+					Event{SystemTime: "2017-06-16T19:00:00", DisplayTime: "2017-06-16T12:00:00", EventType: "carbs", Value: 45, Unit: "grams"},
+					Event{SystemTime: "2017-06-16T19:05:00", DisplayTime: "2017-06-16T12:05:00", EventType: "insulin", EventSubType: "fastActing", Value: 4.5, Unit: "units"},
+					Event{SystemTime: "2017-06-17T01:00:00", DisplayTime: "2017-06-16T18:00:00", EventType: "exercise", EventSubType: "heavy", Value: 90, Unit: "minutes"},
+				}},
+				Devices: &DeviceResponse{Devices: []Device{Device{Model: "Dexcom G6 Mobile App", AlertSettings: []AlertSetting{
+					AlertSetting{AlertName: "urgentLow", Value: 55, Unit: "mg/dL", Enabled: true},
+					AlertSetting{AlertName: "outOfRange", Value: 20, Unit: "minutes", Enabled: true},
+				}}}},
+				Calibrations: &CalibrationResponse{Calibrations: []Calibration{
+					Calibration{SystemTime: "2017-06-16T16:00:00", DisplayTime: "2017-06-16T09:00:00", Value: 121, Unit: "mg/dL"},
+				}},
+			},
+		},
+		{
+			name: "mmol",
+			csv: `Index,Timestamp (YYYY-MM-DDThh:mm:ss),Event Type,Glucose Value (mmol/L)
+1,2017-06-16T08:40:00,EGV,6.6
+2,2017-06-16T08:45:00,EGV,Low
+`,
+			expected: &ClarityExport{
+				EGVs: &EGVResponse{Unit: "mmol/L", RateUnit: "mmol/L/min", EGVs: []EGV{
+					EGV{SystemTime: "2017-06-16T08:40:00", DisplayTime: "2017-06-16T08:40:00", Value: 6.6},
+					EGV{SystemTime: "2017-06-16T08:45:00", DisplayTime: "2017-06-16T08:45:00", Value: 2.2, Status: &low},
+				}},
+				Events:       &EventResponse{},
+				Devices:      &DeviceResponse{},
+				Calibrations: &CalibrationResponse{},
+			},
+		},
+		{
+			name:            "exceptional path - not a clarity export",
+			csv:             "a,b,c\n1,2,3\n",
+			expectedErrCode: ErrorCSV,
+		},
+		{
+			name:            "exceptional path - bad value",
+			csv:             "Timestamp (YYYY-MM-DDThh:mm:ss),Event Type,Glucose Value (mg/dL)\n2017-06-16T08:40:00,EGV,abc\n",
+			expectedErrCode: ErrorCSV,
+		},
+	}
+
+	for _, tc := range testcases {
+		t.Run(tc.name, func(t *testing.T) {
+			actual, err := ReadClarityCSV(strings.NewReader(tc.csv), tc.loc)
+			if tc.expectedErrCode != "" || err != nil {
+				if tc.expectedErrCode == "" {
+					t.Fatalf("Unexpected error occurred (%#v)", err)
+				}
+				if err == nil {
+					t.Fatalf("Expected error did not occur")
+				}
+				if err.Code() != tc.expectedErrCode {
+					t.Fatalf("Actual error (%#v) did not match expected (%#v)", err.Code(), tc.expectedErrCode)
+				}
+				return
+			}
+			if !reflect.DeepEqual(actual, tc.expected) {
+				t.Fatalf("Actual (%#v) did not match expected (%#v)", actual, tc.expected)
+			}
+		})
+	}
+}
@@ -0,0 +1,90 @@
+package dexcom
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestUnit_CSVWriter(t *testing.T) {
+	devices := &DeviceResponse{Devices: []Device{Device{Model: "G6 Mobile App", AlertSettings: []AlertSetting{AlertSetting{AlertName: "urgentLow", Value: 55, Unit: "mg/dL", SystemTime: "2017-06-16T00:00:00", DisplayTime: "2017-06-15T17:00:00"}}}}}
+	egvs := &EGVResponse{Unit: "mg/dL", RateUnit: "mg/dL/min", EGVs: []EGV{
+		EGV{SystemTime: "2017-06-16T15:40:00", DisplayTime: "2017-06-16T08:40:00", Value: 119, TrendRate: makeFloat64Ptr(-1.3)},
+		EGV{SystemTime: "2017-06-16T15:45:00", DisplayTime: "2017-06-16T08:45:00", Value: 40, Status: makeStrPtr(StatusLow)},
+	}}
+	events := &EventResponse{Events: []Event{
+		Event{SystemTime: "2017-06-16T19:45:00", DisplayTime: "2017-06-16T12:45:00", EventType: "exercise", EventSubType: "medium", Value: 42, Unit: "minutes"},
+		Event{SystemTime: "2017-06-16T19:50:00", DisplayTime: "2017-06-16T12:50:00", EventType: "insulin", EventSubType: "fastActing", Value: 4.5, Unit: "units"},
+	}}
+
+	type testcase struct {
+		name            string
+		opts            CSVOptions
+		expectedErrCode string
+		expected        string
+	}
+
+	testcases := []testcase{
+		{
+			name: "base path",
+			expected: `Index,Timestamp (YYYY-MM-DDThh:mm:ss),Event Type,Event Subtype,Patient Info,Device Info,Source Device ID,Glucose Value (mg/dL),Insulin Value (u),Carb Value (grams),Duration (hh:mm:ss),Glucose Rate of Change (mg/dL/min),Transmitter Time (Long Integer),Transmitter ID
+1,,Device,,,G6 Mobile App,G6 Mobile App,,,,,,,
+2,2017-06-15T17:00:00,Alert,Urgent Low,,,G6 Mobile App,55,,,,,,
+3,2017-06-16T08:40:00,EGV,,,,,119,,,,-1.3,,
+4,2017-06-16T08:45:00,EGV,,,,,Low,,,,,,
+5,2017-06-16T12:45:00,Exercise,Medium,,,,,,,00:42:00,,,
+6,2017-06-16T12:50:00,Insulin,Fast-Acting,,,,,4.5,,,,,
+`,
+		},
+		{
+			name: "columns, zone and unit",
+			opts: CSVOptions{Columns: []string{ClarityTimestamp, ClarityEventType, ClarityGlucoseMmolL}, Unit: UnitMmolL, Location: time.FixedZone("", 2*60*60)},
+			expected: `Timestamp (YYYY-MM-DDThh:mm:ss),Event Type,Glucose Value (mmol/L)
+,Device,
+2017-06-16T02:00:00,Alert,3.1
+2017-06-16T17:40:00,EGV,6.6
+2017-06-16T17:45:00,EGV,Low
+2017-06-16T21:45:00,Exercise,
+2017-06-16T21:50:00,Insulin,
+`,
+		},
+		{
+			name:            "exceptional path - unknown column",
+			opts:            CSVOptions{Columns: []string{"foo"}},
+			expectedErrCode: ErrorCSV,
+		},
+	}
+
+	for _, tc := range testcases {
+		t.Run(tc.name, func(t *testing.T) {
+			buf := &bytes.Buffer{}
+			w := NewCSVWriter(buf, tc.opts)
+			err := w.WriteDevices(devices)
+			if err == nil {
+				err = w.WriteEGVs(egvs)
+			}
+			if err == nil {
+				err = w.WriteEvents(events)
+			}
+			if err == nil {
+				err = w.Flush()
+			}
+			if tc.expectedErrCode != "" || err != nil {
+				if tc.expectedErrCode == "" {
+					t.Fatalf("Unexpected error occurred (%#v)", err)
+				}
+				if err == nil {
+					t.Fatalf("Expected error did not occur")
+				}
+				if err.Code() != tc.expectedErrCode {
+					t.Fatalf("Actual error (%#v) did not match expected (%#v)", err.Code(), tc.expectedErrCode)
+				}
+				return
+			}
+			if actual := strings.ReplaceAll(buf.String(), "\r\n", "\n"); actual != tc.expected {
+				t.Fatalf("Actual csv:\n%s\ndid not match expected:\n%s", actual, tc.expected)
+			}
+		})
+	}
+}
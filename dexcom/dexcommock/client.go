@@ -0,0 +1,254 @@
+// Package dexcommock provides a scriptable mock of dexcom.Client for tests of code that depends on it.
+package dexcommock
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/healthimation/go-dexcom/dexcom"
+	"github.com/healthimation/go-glitch/glitch"
+)
+
+// Method names, used to script responses and inspect calls
+const (
+	MethodGetUser         = "GetUser"
+	MethodRefreshUser     = "RefreshUser"
+	MethodGetDevices      = "GetDevices"
+	MethodGetEGVs         = "GetEGVs"
+	MethodGetEvents       = "GetEvents"
+	MethodGetCalibrations = "GetCalibrations"
+	MethodGetStatistics   = "GetStatistics"
+)
+
+// the mock breaks this package's build, not its users', when dexcom.Client grows
+var _ dexcom.Client = (*Client)(nil)
+
+// Call records the arguments of one call to the mock
+type Call struct {
+	Method string
+	// Token is the access token, refresh token or authorization code the call was made with
+	Token       string
+	RedirectURI string
+	StartDate   time.Time
+	EndDate     time.Time
+	Stats       map[string][]dexcom.StatRequest
+}
+
+type result struct {
+	value interface{}
+	err   glitch.DataError
+}
+
+// Client is a mock dexcom.Client.  Each call returns, in order of preference, the next scripted result for the
+// method, the result of the method's Func field, or an empty response.  The zero value is ready to use.
+type Client struct {
+	GetUserFunc         func(ctx context.Context, authorizationCode, redirectURI string) (*dexcom.UserToken, glitch.DataError)
+	RefreshUserFunc     func(ctx context.Context, refreshToken, redirectURI string) (*dexcom.UserToken, glitch.DataError)
+	GetDevicesFunc      func(ctx context.Context, accessToken string, startDate, endDate time.Time) (*dexcom.DeviceResponse, glitch.DataError)
+	GetEGVsFunc         func(ctx context.Context, accessToken string, startDate, endDate time.Time) (*dexcom.EGVResponse, glitch.DataError)
+	GetEventsFunc       func(ctx context.Context, accessToken string, startDate, endDate time.Time) (*dexcom.EventResponse, glitch.DataError)
+	GetCalibrationsFunc func(ctx context.Context, accessToken string, startDate, endDate time.Time) (*dexcom.CalibrationResponse, glitch.DataError)
+	GetStatisticsFunc   func(ctx context.Context, accessToken string, startDate, endDate time.Time, stats map[string][]dexcom.StatRequest) (*dexcom.Statistics, glitch.DataError)
+
+	mu      sync.Mutex
+	calls   []Call
+	scripts map[string][]result
+}
+
+// ScriptGetUser queues the result of the next GetUser call
+func (m *Client) ScriptGetUser(token *dexcom.UserToken, err glitch.DataError) {
+	m.script(MethodGetUser, token, err)
+}
+
+// ScriptRefreshUser queues the result of the next RefreshUser call
+func (m *Client) ScriptRefreshUser(token *dexcom.UserToken, err glitch.DataError) {
+	m.script(MethodRefreshUser, token, err)
+}
+
+// ScriptGetDevices queues the result of the next GetDevices call
+func (m *Client) ScriptGetDevices(resp *dexcom.DeviceResponse, err glitch.DataError) {
+	m.script(MethodGetDevices, resp, err)
+}
+
+// ScriptGetEGVs queues the result of the next GetEGVs call
+func (m *Client) ScriptGetEGVs(resp *dexcom.EGVResponse, err glitch.DataError) {
+	m.script(MethodGetEGVs, resp, err)
+}
+
+// ScriptGetEvents queues the result of the next GetEvents call
+func (m *Client) ScriptGetEvents(resp *dexcom.EventResponse, err glitch.DataError) {
+	m.script(MethodGetEvents, resp, err)
+}
+
+// ScriptGetCalibrations queues the result of the next GetCalibrations call
+func (m *Client) ScriptGetCalibrations(resp *dexcom.CalibrationResponse, err glitch.DataError) {
+	m.script(MethodGetCalibrations, resp, err)
+}
+
+// ScriptGetStatistics queues the result of the next GetStatistics call
+func (m *Client) ScriptGetStatistics(resp *dexcom.Statistics, err glitch.DataError) {
+	m.script(MethodGetStatistics, resp, err)
+}
+
+// Fail queues an error with code, e.g. dexcom.ErrorAPI or dexcom.ErrorInvalidGrant, for the next call to method
+func (m *Client) Fail(method, code string) {
+	m.script(method, nil, glitch.NewDataError(fmt.Errorf("injected by dexcommock"), code, fmt.Sprintf("%s failed", method)))
+}
+
+// Calls returns the calls made to method, or to every method when method is empty
+func (m *Client) Calls(method string) []Call {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var ret []Call
+	for _, c := range m.calls {
+		if method == "" || c.Method == method {
+			ret = append(ret, c)
+		}
+	}
+	return ret
+}
+
+// CallCount returns the number of calls made to method
+func (m *Client) CallCount(method string) int {
+	return len(m.Calls(method))
+}
+
+// TestingT is the part of testing.TB used by the assertions
+type TestingT interface {
+	Helper()
+	Errorf(format string, args ...interface{})
+}
+
+// AssertCalled fails t unless method was called exactly n times
+func (m *Client) AssertCalled(t TestingT, method string, n int) bool {
+	t.Helper()
+	if count := m.CallCount(method); count != n {
+		t.Errorf("dexcommock: expected %d calls to %s, got %d", n, method, count)
+		return false
+	}
+	return true
+}
+
+// AssertScriptsUsed fails t if any scripted result was never returned
+func (m *Client) AssertScriptsUsed(t TestingT) bool {
+	t.Helper()
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	ok := true
+	for method, queue := range m.scripts {
+		if len(queue) > 0 {
+			t.Errorf("dexcommock: %d scripted results for %s were never used", len(queue), method)
+			ok = false
+		}
+	}
+	return ok
+}
+
+// Reset forgets every call and scripted result
+func (m *Client) Reset() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.calls = nil
+	m.scripts = nil
+}
+
+func (m *Client) script(method string, value interface{}, err glitch.DataError) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.scripts == nil {
+		m.scripts = make(map[string][]result)
+	}
+	m.scripts[method] = append(m.scripts[method], result{value: value, err: err})
+}
+
+// record notes the call and pops the next scripted result for it
+func (m *Client) record(c Call) (result, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.calls = append(m.calls, c)
+	queue := m.scripts[c.Method]
+	if len(queue) == 0 {
+		return result{}, false
+	}
+	m.scripts[c.Method] = queue[1:]
+	return queue[0], true
+}
+
+func (m *Client) GetUser(ctx context.Context, authorizationCode, redirectURI string) (*dexcom.UserToken, glitch.DataError) {
+	if r, ok := m.record(Call{Method: MethodGetUser, Token: authorizationCode, RedirectURI: redirectURI}); ok {
+		token, _ := r.value.(*dexcom.UserToken)
+		return token, r.err
+	}
+	if m.GetUserFunc != nil {
+		return m.GetUserFunc(ctx, authorizationCode, redirectURI)
+	}
+	return &dexcom.UserToken{}, nil
+}
+
+func (m *Client) RefreshUser(ctx context.Context, refreshToken, redirectURI string) (*dexcom.UserToken, glitch.DataError) {
+	if r, ok := m.record(Call{Method: MethodRefreshUser, Token: refreshToken, RedirectURI: redirectURI}); ok {
+		token, _ := r.value.(*dexcom.UserToken)
+		return token, r.err
+	}
+	if m.RefreshUserFunc != nil {
+		return m.RefreshUserFunc(ctx, refreshToken, redirectURI)
+	}
+	return &dexcom.UserToken{}, nil
+}
+
+func (m *Client) GetDevices(ctx context.Context, accessToken string, startDate, endDate time.Time) (*dexcom.DeviceResponse, glitch.DataError) {
+	if r, ok := m.record(Call{Method: MethodGetDevices, Token: accessToken, StartDate: startDate, EndDate: endDate}); ok {
+		resp, _ := r.value.(*dexcom.DeviceResponse)
+		return resp, r.err
+	}
+	if m.GetDevicesFunc != nil {
+		return m.GetDevicesFunc(ctx, accessToken, startDate, endDate)
+	}
+	return &dexcom.DeviceResponse{}, nil
+}
+
+func (m *Client) GetEGVs(ctx context.Context, accessToken string, startDate, endDate time.Time) (*dexcom.EGVResponse, glitch.DataError) {
+	if r, ok := m.record(Call{Method: MethodGetEGVs, Token: accessToken, StartDate: startDate, EndDate: endDate}); ok {
+		resp, _ := r.value.(*dexcom.EGVResponse)
+		return resp, r.err
+	}
+	if m.GetEGVsFunc != nil {
+		return m.GetEGVsFunc(ctx, accessToken, startDate, endDate)
+	}
+	return &dexcom.EGVResponse{}, nil
+}
+
+func (m *Client) GetEvents(ctx context.Context, accessToken string, startDate, endDate time.Time) (*dexcom.EventResponse, glitch.DataError) {
+	if r, ok := m.record(Call{Method: MethodGetEvents, Token: accessToken, StartDate: startDate, EndDate: endDate}); ok {
+		resp, _ := r.value.(*dexcom.EventResponse)
+		return resp, r.err
+	}
+	if m.GetEventsFunc != nil {
+		return m.GetEventsFunc(ctx, accessToken, startDate, endDate)
+	}
+	return &dexcom.EventResponse{}, nil
+}
+
+func (m *Client) GetCalibrations(ctx context.Context, accessToken string, startDate, endDate time.Time) (*dexcom.CalibrationResponse, glitch.DataError) {
+	if r, ok := m.record(Call{Method: MethodGetCalibrations, Token: accessToken, StartDate: startDate, EndDate: endDate}); ok {
+		resp, _ := r.value.(*dexcom.CalibrationResponse)
+		return resp, r.err
+	}
+	if m.GetCalibrationsFunc != nil {
+		return m.GetCalibrationsFunc(ctx, accessToken, startDate, endDate)
+	}
+	return &dexcom.CalibrationResponse{}, nil
+}
+
+func (m *Client) GetStatistics(ctx context.Context, accessToken string, startDate, endDate time.Time, stats map[string][]dexcom.StatRequest) (*dexcom.Statistics, glitch.DataError) {
+	if r, ok := m.record(Call{Method: MethodGetStatistics, Token: accessToken, StartDate: startDate, EndDate: endDate, Stats: stats}); ok {
+		resp, _ := r.value.(*dexcom.Statistics)
+		return resp, r.err
+	}
+	if m.GetStatisticsFunc != nil {
+		return m.GetStatisticsFunc(ctx, accessToken, startDate, endDate, stats)
+	}
+	return &dexcom.Statistics{}, nil
+}
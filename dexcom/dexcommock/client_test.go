@@ -0,0 +1,43 @@
+package dexcommock
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/healthimation/go-dexcom/dexcom"
+	"github.com/healthimation/go-glitch/glitch"
+)
+
+func TestUnit_Client(t *testing.T) {
+	m := &Client{}
+	m.ScriptGetEGVs(&dexcom.EGVResponse{EGVs: []dexcom.EGV{dexcom.EGV{SystemTime: "2017-06-16T15:40:00", Value: 119}}}, nil)
+	m.Fail(MethodGetEvents, dexcom.ErrorInvalidGrant)
+
+	s := dexcom.NewSyncer(m, dexcom.NewJSONLSink(t.TempDir()), dexcom.NewMemoryCheckpointStore(), time.Hour, 24*time.Hour)
+	ret, err := s.Sync(context.Background(), "user", "token")
+	if err == nil || err.Code() != dexcom.ErrorInvalidGrant {
+		t.Fatalf("Actual error (%#v) did not match expected (%#v)", err, dexcom.ErrorInvalidGrant)
+	}
+	if ret.EGVs != 0 {
+		t.Fatalf("Expected nothing to be written after the failure, got %d egvs", ret.EGVs)
+	}
+
+	m.AssertCalled(t, MethodGetEGVs, 1)
+	m.AssertCalled(t, MethodGetEvents, 1)
+	m.AssertCalled(t, MethodGetDevices, 0)
+	m.AssertScriptsUsed(t)
+	if call := m.Calls(MethodGetEGVs)[0]; call.Token != "token" || call.EndDate.Sub(call.StartDate) != 24*time.Hour {
+		t.Fatalf("Actual call (%#v) did not match expected", call)
+	}
+
+	// unscripted calls fall back to the func field, then to an empty response
+	m.GetDevicesFunc = func(ctx context.Context, accessToken string, startDate, endDate time.Time) (*dexcom.DeviceResponse, glitch.DataError) {
+		return &dexcom.DeviceResponse{Devices: []dexcom.Device{dexcom.Device{Model: "G6"}}}, nil
+	}
+	devices, _ := m.GetDevices(context.Background(), "token", time.Now(), time.Now())
+	egvs, _ := m.GetEGVs(context.Background(), "token", time.Now(), time.Now())
+	if len(devices.Devices) != 1 || egvs == nil || len(egvs.EGVs) != 0 {
+		t.Fatalf("Unexpected fallback responses (%#v) (%#v)", devices, egvs)
+	}
+}
@@ -0,0 +1,140 @@
+package dexcomtest
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"time"
+
+	"github.com/healthimation/go-dexcom/dexcom"
+)
+
+// UserData is everything the server knows about one user
+type UserData struct {
+	Unit         string               `json:"unit"`
+	EGVs         []dexcom.EGV         `json:"egvs"`
+	Events       []dexcom.Event       `json:"events"`
+	Devices      []dexcom.Device      `json:"devices"`
+	Calibrations []dexcom.Calibration `json:"calibrations"`
+}
+
+// Fixture seeds a server with users keyed by user id
+type Fixture struct {
+	Users map[string]UserData `json:"users"`
+}
+
+func (u *UserData) unit() string {
+	if u.Unit == "" {
+		return "mg/dL"
+	}
+	return u.Unit
+}
+
+func (u *UserData) clone() *UserData {
+	if u == nil {
+		return &UserData{}
+	}
+	return &UserData{
+		Unit:         u.Unit,
+		EGVs:         append([]dexcom.EGV(nil), u.EGVs...),
+		Events:       append([]dexcom.Event(nil), u.Events...),
+		Devices:      append([]dexcom.Device(nil), u.Devices...),
+		Calibrations: append([]dexcom.Calibration(nil), u.Calibrations...),
+	}
+}
+
+// Seed adds data to userID, creating the user if needed
+func (s *Server) Seed(userID string, data UserData) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	user, ok := s.users[userID]
+	if !ok {
+		user = &UserData{}
+		s.users[userID] = user
+	}
+	if data.Unit != "" {
+		user.Unit = data.Unit
+	}
+	user.EGVs = append(user.EGVs, data.EGVs...)
+	user.Events = append(user.Events, data.Events...)
+	user.Devices = append(user.Devices, data.Devices...)
+	user.Calibrations = append(user.Calibrations, data.Calibrations...)
+}
+
+// LoadFixture seeds the server from a JSON encoded Fixture
+func (s *Server) LoadFixture(r io.Reader) error {
+	f := Fixture{}
+	if err := json.NewDecoder(r).Decode(&f); err != nil {
+		return fmt.Errorf("could not decode fixture: %s", err)
+	}
+	for userID, data := range f.Users {
+		s.Seed(userID, data)
+	}
+	return nil
+}
+
+// computeStatistics calculates the statistics the api would return for values
+func computeStatistics(values []float64, calibrations int, target dexcom.MinMax, start, end time.Time) dexcom.Statistics {
+	days := int64(math.Ceil(end.Sub(start).Hours() / 24))
+	ret := dexcom.Statistics{NDays: days, NValues: int64(len(values))}
+	if days > 0 {
+		ret.MeanDailyCalibrations = float64(calibrations) / float64(days)
+		// one reading every 5 minutes
+		ret.UtilizationPercent = 100 * float64(len(values)) / (end.Sub(start).Minutes() / 5)
+	}
+	if len(values) == 0 {
+		ret.HypoglycemiaRisk = "minimal"
+		return ret
+	}
+
+	sorted := append([]float64(nil), values...)
+	sort.Float64s(sorted)
+	ret.Min = sorted[0]
+	ret.Max = sorted[len(sorted)-1]
+	for _, v := range sorted {
+		ret.Sum += v
+		switch {
+		case v < target.Min:
+			ret.NBelowRange++
+		case v > target.Max:
+			ret.NAboveRange++
+		default:
+			ret.NWithinRange++
+		}
+	}
+	n := float64(len(sorted))
+	ret.Mean = ret.Sum / n
+	for _, v := range sorted {
+		ret.Variance += (v - ret.Mean) * (v - ret.Mean)
+	}
+	if len(sorted) > 1 {
+		ret.Variance /= n - 1
+	}
+	ret.StdDev = math.Sqrt(ret.Variance)
+	ret.Q1 = quantile(sorted, 0.25)
+	ret.Q2 = quantile(sorted, 0.5)
+	ret.Q3 = quantile(sorted, 0.75)
+	ret.Median = ret.Q2
+	ret.PercentBelowRange = 100 * float64(ret.NBelowRange) / n
+	ret.PercentWithinRange = 100 * float64(ret.NWithinRange) / n
+	ret.PercentAboveRange = 100 * float64(ret.NAboveRange) / n
+
+	switch {
+	case ret.PercentBelowRange >= 10:
+		ret.HypoglycemiaRisk = "high"
+	case ret.PercentBelowRange >= 4:
+		ret.HypoglycemiaRisk = "moderate"
+	default:
+		ret.HypoglycemiaRisk = "minimal"
+	}
+	return ret
+}
+
+func quantile(sorted []float64, q float64) float64 {
+	pos := q * float64(len(sorted)-1)
+	lo := int(math.Floor(pos))
+	hi := int(math.Ceil(pos))
+	return sorted[lo] + (sorted[hi]-sorted[lo])*(pos-float64(lo))
+}
@@ -0,0 +1,263 @@
+package dexcomtest
+
+import (
+	"math"
+	"math/rand"
+	"sort"
+	"time"
+
+	"github.com/healthimation/go-dexcom/dexcom"
+)
+
+const (
+	readingInterval = 5 * time.Minute
+	sensorMin       = 40
+	sensorMax       = 400
+)
+
+// Meal is a daily meal in the generated data
+type Meal struct {
+	// Hour is the local time of day, e.g. 7.5 for 7:30am
+	Hour  float64
+	Carbs float64
+}
+
+// GeneratorConfig controls Generate.  The same config always produces the same data.
+type GeneratorConfig struct {
+	Seed     int64
+	Start    time.Time
+	Duration time.Duration
+	// Location is used for displayTime and to place meals, exercise and the dawn phenomenon
+	Location *time.Location
+
+	// Baseline is the fasting glucose in mg/dL
+	Baseline float64
+	Meals    []Meal
+	// CarbSensitivity is the mg/dL rise per gram of carbs
+	CarbSensitivity float64
+	// InsulinSensitivity is the mg/dL drop per unit of insulin
+	InsulinSensitivity float64
+	// CarbRatio is grams of carbs covered by one unit of insulin
+	CarbRatio float64
+	// BolusError is the relative error applied to each meal bolus, e.g. 0.2 for +/-20%
+	BolusError float64
+	// Dawn is the early morning rise in mg/dL
+	Dawn float64
+	// ExerciseChance is the chance of an evening workout on any day
+	ExerciseChance float64
+	// ExerciseDrop is the mg/dL drop from an hour of exercise
+	ExerciseDrop float64
+	// Noise is the standard deviation of sensor noise in mg/dL
+	Noise float64
+	// DropoutChance is the chance per reading of a signal loss of 15 to 60 minutes
+	DropoutChance float64
+	// SensorSession is how long each sensor lasts, Warmup is how long a new sensor takes to produce readings
+	SensorSession time.Duration
+	Warmup        time.Duration
+	// CalibrationsPerDay is the number of meter calibrations entered each day
+	CalibrationsPerDay int
+	Model              string
+}
+
+// DefaultGeneratorConfig returns a config for a fairly well controlled type 1 patient on a G6
+func DefaultGeneratorConfig(seed int64, start time.Time, duration time.Duration) GeneratorConfig {
+	return GeneratorConfig{
+		Seed:               seed,
+		Start:              start,
+		Duration:           duration,
+		Location:           time.UTC,
+		Baseline:           110,
+		Meals:              []Meal{Meal{Hour: 7.5, Carbs: 45}, Meal{Hour: 12.5, Carbs: 60}, Meal{Hour: 18.5, Carbs: 75}},
+		CarbSensitivity:    4,
+		InsulinSensitivity: 40,
+		CarbRatio:          10,
+		BolusError:         0.25,
+		Dawn:               30,
+		ExerciseChance:     0.3,
+		ExerciseDrop:       50,
+		Noise:              4,
+		DropoutChance:      0.002,
+		SensorSession:      10 * 24 * time.Hour,
+		Warmup:             2 * time.Hour,
+		CalibrationsPerDay: 0,
+		Model:              "G6 Mobile App",
+	}
+}
+
+// effect is a glucose change spread over time.  It adds amount times the cumulative absorption at t.
+type effect struct {
+	start  time.Time
+	amount float64
+	tau    time.Duration
+}
+
+func (e effect) at(t time.Time) float64 {
+	if t.Before(e.start) {
+		return 0
+	}
+	x := float64(t.Sub(e.start)) / float64(e.tau)
+	return e.amount * (1 - (1+x)*math.Exp(-x))
+}
+
+// exercise lowers glucose while it lasts and recovers over the following hours
+type exercise struct {
+	start    time.Time
+	duration time.Duration
+	drop     float64
+}
+
+func (e exercise) at(t time.Time) float64 {
+	if t.Before(e.start) {
+		return 0
+	}
+	x := float64(t.Sub(e.start)) / float64(e.duration)
+	return -e.drop * x * math.Exp(1-x)
+}
+
+// Generate produces a physiologically plausible CGM trace with matching carb, insulin and exercise events
+func Generate(cfg GeneratorConfig) UserData {
+	r := rand.New(rand.NewSource(cfg.Seed))
+	loc := cfg.Location
+	if loc == nil {
+		loc = time.UTC
+	}
+	start := cfg.Start.Truncate(readingInterval)
+	end := start.Add(cfg.Duration)
+
+	ret := UserData{Unit: "mg/dL"}
+	var effects []effect
+	var workouts []exercise
+
+	// plan the days up front so every event exists before the readings that depend on it
+	for day := time.Date(start.In(loc).Year(), start.In(loc).Month(), start.In(loc).Day(), 0, 0, 0, 0, loc); day.Before(end); day = day.AddDate(0, 0, 1) {
+		for _, meal := range cfg.Meals {
+			at := day.Add(time.Duration(meal.Hour*float64(time.Hour)) + time.Duration(r.Intn(30)-15)*time.Minute)
+			carbs := math.Round(meal.Carbs * (0.7 + 0.6*r.Float64()))
+			insulin := math.Round(carbs/cfg.CarbRatio*(1+cfg.BolusError*(2*r.Float64()-1))*10) / 10
+			effects = append(effects,
+				effect{start: at, amount: carbs * cfg.CarbSensitivity, tau: 40 * time.Minute},
+				effect{start: at, amount: -insulin * cfg.InsulinSensitivity, tau: 55 * time.Minute},
+			)
+			if !at.Before(start) && at.Before(end) {
+				ret.Events = append(ret.Events,
+					event(at, loc, "carbs", "", carbs, "grams"),
+					event(at, loc, "insulin", "fastActing", insulin, "units"),
+				)
+			}
+		}
+		if r.Float64() < cfg.ExerciseChance {
+			at := day.Add(17*time.Hour + time.Duration(r.Intn(120))*time.Minute)
+			minutes := 30 + r.Intn(46)
+			intensity := []string{"light", "medium", "heavy"}[r.Intn(3)]
+			scale := map[string]float64{"light": 0.6, "medium": 1, "heavy": 1.4}[intensity]
+			workouts = append(workouts, exercise{start: at, duration: time.Duration(minutes) * time.Minute, drop: cfg.ExerciseDrop * scale * float64(minutes) / 60})
+			if !at.Before(start) && at.Before(end) {
+				ret.Events = append(ret.Events, event(at, loc, "exercise", intensity, float64(minutes), "minutes"))
+			}
+		}
+		for i := 0; i < cfg.CalibrationsPerDay; i++ {
+			at := day.Add(time.Duration(7+i*12/cfg.CalibrationsPerDay) * time.Hour)
+			if !at.Before(start) && at.Before(end) {
+				ret.Calibrations = append(ret.Calibrations, dexcom.Calibration{
+					SystemTime:  dexcom.FormatTime(at),
+					DisplayTime: at.In(loc).Format(timeformat),
+					Unit:        "mg/dL",
+				})
+			}
+		}
+	}
+
+	noise := 0.0
+	run := 0
+	var dropoutUntil time.Time
+	var history []float64
+	for t := start; t.Before(end); t = t.Add(readingInterval) {
+		glucose := cfg.Baseline + dawn(t.In(loc), cfg.Dawn)
+		for _, e := range effects {
+			glucose += e.at(t)
+		}
+		for _, w := range workouts {
+			glucose += w.at(t)
+		}
+		// sensor noise is correlated from one reading to the next
+		noise = 0.7*noise + r.NormFloat64()*cfg.Noise
+		value := math.Round(glucose + noise)
+		history = append(history, value)
+
+		sessionStart := start
+		if cfg.SensorSession > 0 {
+			sessionStart = start.Add(t.Sub(start) / cfg.SensorSession * cfg.SensorSession)
+		}
+		if t.Sub(sessionStart) < cfg.Warmup || t.Before(dropoutUntil) {
+			run = 0
+			continue
+		}
+		if r.Float64() < cfg.DropoutChance {
+			dropoutUntil = t.Add(time.Duration(15+r.Intn(46)) * time.Minute)
+			run = 0
+			continue
+		}
+		run++
+		ret.EGVs = append(ret.EGVs, reading(t, loc, value, history, run))
+	}
+	sort.SliceStable(ret.Events, func(i, j int) bool { return ret.Events[i].SystemTime < ret.Events[j].SystemTime })
+
+	for i := range ret.Calibrations {
+		at, _ := dexcom.ParseTime(ret.Calibrations[i].SystemTime)
+		idx := int(at.Sub(start) / readingInterval)
+		if idx >= 0 && idx < len(history) {
+			// meters are only accurate to a few percent
+			ret.Calibrations[i].Value = math.Round(history[idx] * (1 + 0.05*r.NormFloat64()))
+		}
+	}
+
+	ret.Devices = []dexcom.Device{dexcom.Device{Model: cfg.Model, LastUploadDate: dexcom.FormatTime(end.Add(-readingInterval))}}
+	return ret
+}
+
+// dawn is the early morning rise caused by overnight hormones, peaking around 5:30am
+func dawn(local time.Time, amplitude float64) float64 {
+	hour := float64(local.Hour()) + float64(local.Minute())/60
+	if hour < 3 || hour > 8 {
+		return 0
+	}
+	return amplitude * math.Sin(math.Pi*(hour-3)/5)
+}
+
+// reading builds the egv for value, run is the number of consecutive readings without a gap including this one
+func reading(t time.Time, loc *time.Location, value float64, history []float64, run int) dexcom.EGV {
+	egv := dexcom.EGV{
+		SystemTime:  dexcom.FormatTime(t),
+		DisplayTime: t.In(loc).Format(timeformat),
+		Value:       math.Min(math.Max(value, sensorMin), sensorMax),
+	}
+	switch {
+	case value < sensorMin:
+		status := dexcom.StatusLow
+		egv.Status = &status
+	case value > sensorMax:
+		status := dexcom.StatusHigh
+		egv.Status = &status
+	}
+
+	// dexcom needs 15 minutes of history to compute a trend
+	trend := dexcom.TrendNotComputable
+	if run >= 4 {
+		rate := math.Round((history[len(history)-1]-history[len(history)-4])/15*10) / 10
+		egv.TrendRate = &rate
+		trend = dexcom.TrendForRate(rate)
+	}
+	egv.Trend = &trend
+	return egv
+}
+
+func event(t time.Time, loc *time.Location, eventType, eventSubType string, value float64, unit string) dexcom.Event {
+	return dexcom.Event{
+		SystemTime:   dexcom.FormatTime(t),
+		DisplayTime:  t.In(loc).Format(timeformat),
+		EventType:    eventType,
+		EventSubType: eventSubType,
+		Value:        value,
+		Unit:         unit,
+	}
+}
@@ -0,0 +1,48 @@
+package dexcomtest
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/healthimation/go-dexcom/dexcom"
+)
+
+func TestUnit_Generate(t *testing.T) {
+	start := time.Date(2017, 6, 1, 0, 0, 0, 0, time.UTC)
+	cfg := DefaultGeneratorConfig(42, start, 14*24*time.Hour)
+	cfg.DropoutChance = 0
+
+	data := Generate(cfg)
+	if !reflect.DeepEqual(data, Generate(cfg)) {
+		t.Fatalf("Expected the same seed to produce the same data")
+	}
+
+	// two sensor warmups of 2 hours each, 24 readings apiece
+	expected := 14*288 - 2*24
+	if len(data.EGVs) != expected {
+		t.Fatalf("Actual egv count (%d) did not match expected (%d)", len(data.EGVs), expected)
+	}
+	if data.EGVs[0].SystemTime != "2017-06-01T02:00:00" {
+		t.Fatalf("Expected first reading after warmup, got %s", data.EGVs[0].SystemTime)
+	}
+	for _, egv := range data.EGVs {
+		if egv.Value < 40 || egv.Value > 400 {
+			t.Fatalf("Reading %#v is outside the sensor range", egv)
+		}
+		if egv.Trend == nil {
+			t.Fatalf("Reading %#v has no trend", egv)
+		}
+	}
+	if *data.EGVs[0].Trend != dexcom.TrendNotComputable || *data.EGVs[10].Trend == dexcom.TrendNotComputable {
+		t.Fatalf("Expected trends only once there is 15 minutes of history")
+	}
+
+	counts := map[string]int{}
+	for _, event := range data.Events {
+		counts[event.EventType]++
+	}
+	if counts["carbs"] != 14*3 || counts["insulin"] != 14*3 || counts["exercise"] == 0 {
+		t.Fatalf("Actual event counts (%v) did not match expected", counts)
+	}
+}
@@ -0,0 +1,412 @@
+// Package dexcomtest provides a stateful fake of the dexcom api for integration tests.
+package dexcomtest
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/healthimation/go-dexcom/dexcom"
+)
+
+const (
+	timeformat = "2006-01-02T15:04:05"
+
+	// DefaultTokenLifetime is how long issued access tokens last, matching dexcom
+	DefaultTokenLifetime = 2 * time.Hour
+)
+
+// Fault makes requests matching Path fail.  An empty Path matches every request.  Times is the number of requests to
+// fail, or every request when 0.
+type Fault struct {
+	Path   string
+	Status int
+	Body   string
+	Delay  time.Duration
+	Times  int
+}
+
+type accessToken struct {
+	userID  string
+	expires time.Time
+}
+
+type rateWindow struct {
+	start time.Time
+	count int
+}
+
+// Server is a fake dexcom api.  Create one with NewServer, seed it with users, then point a client at URL.
+type Server struct {
+	*httptest.Server
+
+	// Now is the server clock, override it to control token expiry and rate limit windows
+	Now func() time.Time
+	// TokenLifetime is the lifetime of issued access tokens
+	TokenLifetime time.Duration
+
+	clientID     string
+	clientSecret string
+
+	mu            sync.Mutex
+	users         map[string]*UserData
+	authCodes     map[string]string
+	accessTokens  map[string]accessToken
+	refreshTokens map[string]string
+	faults        []*Fault
+	rateLimit     int
+	ratePer       time.Duration
+	rateWindows   map[string]*rateWindow
+	requests      map[string]int
+}
+
+// NewServer starts a fake dexcom api that accepts the given client credentials
+func NewServer(clientID, clientSecret string) *Server {
+	s := &Server{
+		Now:           time.Now,
+		TokenLifetime: DefaultTokenLifetime,
+		clientID:      clientID,
+		clientSecret:  clientSecret,
+		users:         make(map[string]*UserData),
+		authCodes:     make(map[string]string),
+		accessTokens:  make(map[string]accessToken),
+		refreshTokens: make(map[string]string),
+		rateWindows:   make(map[string]*rateWindow),
+		requests:      make(map[string]int),
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/v1/oauth2/token", s.handleToken)
+	mux.HandleFunc("/v1/users/self/egvs", s.dataHandler(s.egvs))
+	mux.HandleFunc("/v1/users/self/events", s.dataHandler(s.events))
+	mux.HandleFunc("/v1/users/self/devices", s.dataHandler(s.devices))
+	mux.HandleFunc("/v1/users/self/calibrations", s.dataHandler(s.calibrations))
+	mux.HandleFunc("/v1/users/self/statistics", s.dataHandler(s.statistics))
+	s.Server = httptest.NewServer(s.middleware(mux))
+	return s
+}
+
+// Client returns a dexcom.Client pointed at the server using its client credentials
+func (s *Server) Client(timeout time.Duration) dexcom.Client {
+	return dexcom.NewClientWithBaseURL(s.URL, s.clientID, s.clientSecret, timeout)
+}
+
+// AuthorizationCode returns a single use authorization code for userID, as if the user had just logged in
+func (s *Server) AuthorizationCode(userID string) string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.users[userID]; !ok {
+		s.users[userID] = &UserData{}
+	}
+	code := randomToken()
+	s.authCodes[code] = userID
+	return code
+}
+
+// RevokeUser invalidates every token issued to userID, so refreshes fail with invalid_grant
+func (s *Server) RevokeUser(userID string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for token, t := range s.accessTokens {
+		if t.userID == userID {
+			delete(s.accessTokens, token)
+		}
+	}
+	for token, id := range s.refreshTokens {
+		if id == userID {
+			delete(s.refreshTokens, token)
+		}
+	}
+}
+
+// SetRateLimit allows at most n data requests per user every per.  n of 0 disables rate limiting.
+func (s *Server) SetRateLimit(n int, per time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.rateLimit = n
+	s.ratePer = per
+	s.rateWindows = make(map[string]*rateWindow)
+}
+
+// InjectFault adds a fault, faults are checked in the order they were added
+func (s *Server) InjectFault(f Fault) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.faults = append(s.faults, &f)
+}
+
+// ClearFaults removes every injected fault
+func (s *Server) ClearFaults() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.faults = nil
+}
+
+// Requests returns how many requests have been made to path, including failed ones
+func (s *Server) Requests(path string) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.requests[path]
+}
+
+func (s *Server) middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.mu.Lock()
+		s.requests[r.URL.Path]++
+		var fault *Fault
+		for _, f := range s.faults {
+			if f.Path != "" && f.Path != r.URL.Path {
+				continue
+			}
+			// -1 marks a fault that has been used up
+			if f.Times < 0 {
+				continue
+			}
+			if f.Times > 0 {
+				f.Times--
+				if f.Times == 0 {
+					f.Times = -1
+				}
+			}
+			fault = f
+			break
+		}
+		s.mu.Unlock()
+
+		if fault == nil {
+			next.ServeHTTP(w, r)
+			return
+		}
+		if fault.Delay > 0 {
+			select {
+			case <-time.After(fault.Delay):
+			case <-r.Context().Done():
+				return
+			}
+		}
+		if fault.Status == 0 {
+			next.ServeHTTP(w, r)
+			return
+		}
+		w.WriteHeader(fault.Status)
+		fmt.Fprint(w, fault.Body)
+	})
+}
+
+func (s *Server) handleToken(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeError(w, http.StatusMethodNotAllowed, "invalid_request", "token requests must be POSTed")
+		return
+	}
+	if err := r.ParseForm(); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid_request", err.Error())
+		return
+	}
+	if r.PostForm.Get("client_id") != s.clientID || r.PostForm.Get("client_secret") != s.clientSecret {
+		writeError(w, http.StatusUnauthorized, "invalid_client", "unknown client credentials")
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var userID string
+	switch r.PostForm.Get("grant_type") {
+	case "authorization_code":
+		id, ok := s.authCodes[r.PostForm.Get("code")]
+		if !ok {
+			writeError(w, http.StatusBadRequest, "invalid_grant", "unknown or used authorization code")
+			return
+		}
+		delete(s.authCodes, r.PostForm.Get("code"))
+		userID = id
+	case "refresh_token":
+		id, ok := s.refreshTokens[r.PostForm.Get("refresh_token")]
+		if !ok {
+			writeError(w, http.StatusBadRequest, "invalid_grant", "unknown, rotated or revoked refresh token")
+			return
+		}
+		// refresh tokens are single use, the old one stops working as soon as it is exchanged
+		delete(s.refreshTokens, r.PostForm.Get("refresh_token"))
+		userID = id
+	default:
+		writeError(w, http.StatusBadRequest, "unsupported_grant_type", "grant_type must be authorization_code or refresh_token")
+		return
+	}
+
+	access, refresh := randomToken(), randomToken()
+	s.accessTokens[access] = accessToken{userID: userID, expires: s.Now().Add(s.TokenLifetime)}
+	s.refreshTokens[refresh] = userID
+	writeJSON(w, dexcom.UserToken{
+		AccessToken:  access,
+		RefreshToken: refresh,
+		ExpiresIn:    int64(s.TokenLifetime / time.Second),
+		TokenType:    "Bearer",
+	})
+}
+
+type dataFunc func(w http.ResponseWriter, r *http.Request, user *UserData, start, end time.Time)
+
+// dataHandler authenticates, rate limits and validates the date range before calling fn
+func (s *Server) dataHandler(fn dataFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		auth := r.Header.Get("Authorization")
+		if !strings.HasPrefix(auth, "Bearer ") {
+			writeError(w, http.StatusUnauthorized, "invalid_token", "missing bearer token")
+			return
+		}
+
+		s.mu.Lock()
+		token, ok := s.accessTokens[strings.TrimPrefix(auth, "Bearer ")]
+		if !ok || !s.Now().Before(token.expires) {
+			s.mu.Unlock()
+			writeError(w, http.StatusUnauthorized, "invalid_token", "unknown or expired access token")
+			return
+		}
+		if retryAfter, limited := s.limited(token.userID); limited {
+			s.mu.Unlock()
+			w.Header().Set("Retry-After", strconv.Itoa(int(retryAfter/time.Second)+1))
+			writeError(w, http.StatusTooManyRequests, "rate_limited", "too many requests")
+			return
+		}
+		user := s.users[token.userID].clone()
+		s.mu.Unlock()
+
+		start, err := time.Parse(timeformat, r.URL.Query().Get("startDate"))
+		if err != nil {
+			writeError(w, http.StatusBadRequest, "invalid_request", "startDate is missing or malformed")
+			return
+		}
+		end, err := time.Parse(timeformat, r.URL.Query().Get("endDate"))
+		if err != nil {
+			writeError(w, http.StatusBadRequest, "invalid_request", "endDate is missing or malformed")
+			return
+		}
+		if end.Before(start) {
+			writeError(w, http.StatusBadRequest, "invalid_request", "endDate is before startDate")
+			return
+		}
+		if end.Sub(start) > dexcom.MaxRange {
+			writeError(w, http.StatusBadRequest, "invalid_request", "date range exceeds the maximum of 90 days")
+			return
+		}
+		fn(w, r, user, start, end)
+	}
+}
+
+// limited reports whether userID is over the rate limit, must be called with s.mu held
+func (s *Server) limited(userID string) (time.Duration, bool) {
+	if s.rateLimit <= 0 {
+		return 0, false
+	}
+	now := s.Now()
+	win, ok := s.rateWindows[userID]
+	if !ok || !now.Before(win.start.Add(s.ratePer)) {
+		win = &rateWindow{start: now}
+		s.rateWindows[userID] = win
+	}
+	if win.count >= s.rateLimit {
+		return win.start.Add(s.ratePer).Sub(now), true
+	}
+	win.count++
+	return 0, false
+}
+
+func (s *Server) egvs(w http.ResponseWriter, r *http.Request, user *UserData, start, end time.Time) {
+	ret := dexcom.EGVResponse{Unit: user.unit(), RateUnit: user.unit() + "/min", EGVs: []dexcom.EGV{}}
+	for _, egv := range user.EGVs {
+		if inRange(egv.SystemTime, start, end) {
+			ret.EGVs = append(ret.EGVs, egv)
+		}
+	}
+	writeJSON(w, ret)
+}
+
+func (s *Server) events(w http.ResponseWriter, r *http.Request, user *UserData, start, end time.Time) {
+	ret := dexcom.EventResponse{Events: []dexcom.Event{}}
+	for _, event := range user.Events {
+		if inRange(event.SystemTime, start, end) {
+			ret.Events = append(ret.Events, event)
+		}
+	}
+	writeJSON(w, ret)
+}
+
+func (s *Server) devices(w http.ResponseWriter, r *http.Request, user *UserData, start, end time.Time) {
+	ret := dexcom.DeviceResponse{Devices: []dexcom.Device{}}
+	ret.Devices = append(ret.Devices, user.Devices...)
+	writeJSON(w, ret)
+}
+
+func (s *Server) calibrations(w http.ResponseWriter, r *http.Request, user *UserData, start, end time.Time) {
+	ret := dexcom.CalibrationResponse{Calibrations: []dexcom.Calibration{}}
+	for _, calibration := range user.Calibrations {
+		if inRange(calibration.SystemTime, start, end) {
+			ret.Calibrations = append(ret.Calibrations, calibration)
+		}
+	}
+	writeJSON(w, ret)
+}
+
+func (s *Server) statistics(w http.ResponseWriter, r *http.Request, user *UserData, start, end time.Time) {
+	if r.Method != http.MethodPost {
+		writeError(w, http.StatusMethodNotAllowed, "invalid_request", "statistics must be POSTed")
+		return
+	}
+	req := map[string][]dexcom.StatRequest{}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid_request", "could not decode statistics request")
+		return
+	}
+	target := dexcom.MinMax{Min: 70, Max: 180}
+	for _, stats := range req {
+		if len(stats) > 0 && stats[0].EGVRange.Max > 0 {
+			target = stats[0].EGVRange
+			break
+		}
+	}
+
+	var values []float64
+	for _, egv := range user.EGVs {
+		if inRange(egv.SystemTime, start, end) {
+			values = append(values, egv.Value)
+		}
+	}
+	calibrations := 0
+	for _, calibration := range user.Calibrations {
+		if inRange(calibration.SystemTime, start, end) {
+			calibrations++
+		}
+	}
+	writeJSON(w, computeStatistics(values, calibrations, target, start, end))
+}
+
+func inRange(systemTime string, start, end time.Time) bool {
+	t, err := dexcom.ParseTime(systemTime)
+	if err != nil {
+		return false
+	}
+	return !t.Before(start) && t.Before(end)
+}
+
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(v)
+}
+
+func writeError(w http.ResponseWriter, status int, code, description string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]string{"error": code, "error_description": description})
+}
+
+func randomToken() string {
+	by := make([]byte, 16)
+	rand.Read(by)
+	return hex.EncodeToString(by)
+}
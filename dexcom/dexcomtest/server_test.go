@@ -0,0 +1,126 @@
+package dexcomtest
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/healthimation/go-dexcom/dexcom"
+)
+
+const testFixture = `{"users": {"patient": {"egvs": [
+	{"systemTime": "2017-06-16T15:40:00", "displayTime": "2017-06-16T07:40:00", "value": 119},
+	{"systemTime": "2017-06-16T15:45:00", "displayTime": "2017-06-16T07:45:00", "value": 60},
+	{"systemTime": "2017-06-18T15:45:00", "displayTime": "2017-06-18T07:45:00", "value": 200}
+]}}}`
+
+func TestUnit_ServerOAuthFlow(t *testing.T) {
+	s := NewServer("id", "secret")
+	defer s.Close()
+	if err := s.LoadFixture(strings.NewReader(testFixture)); err != nil {
+		t.Fatalf("Unexpected error occurred (%#v)", err)
+	}
+	c := s.Client(5 * time.Second)
+	ctx := context.Background()
+	start := time.Date(2017, 6, 16, 0, 0, 0, 0, time.UTC)
+	end := time.Date(2017, 6, 17, 0, 0, 0, 0, time.UTC)
+
+	token, err := c.GetUser(ctx, s.AuthorizationCode("patient"), "uri")
+	if err != nil {
+		t.Fatalf("Unexpected error occurred (%#v)", err)
+	}
+	egvs, err := c.GetEGVs(ctx, token.AccessToken, start, end)
+	if err != nil {
+		t.Fatalf("Unexpected error occurred (%#v)", err)
+	}
+	if len(egvs.EGVs) != 2 || egvs.Unit != "mg/dL" {
+		t.Fatalf("Actual response (%#v) did not contain the 2 seeded egvs in range", egvs)
+	}
+
+	stats, err := c.GetStatistics(ctx, token.AccessToken, start, end, map[string][]dexcom.StatRequest{})
+	if err != nil {
+		t.Fatalf("Unexpected error occurred (%#v)", err)
+	}
+	if stats.NValues != 2 || stats.NBelowRange != 1 || stats.Min != 60 || stats.Max != 119 {
+		t.Fatalf("Actual statistics (%#v) did not match expected", stats)
+	}
+
+	refreshed, err := c.RefreshUser(ctx, token.RefreshToken, "uri")
+	if err != nil {
+		t.Fatalf("Unexpected error occurred (%#v)", err)
+	}
+	if _, err := c.RefreshUser(ctx, token.RefreshToken, "uri"); err == nil || err.Code() != dexcom.ErrorInvalidGrant {
+		t.Fatalf("Expected rotated refresh token to fail with invalid_grant, got (%#v)", err)
+	}
+	s.RevokeUser("patient")
+	if _, err := c.RefreshUser(ctx, refreshed.RefreshToken, "uri"); err == nil || err.Code() != dexcom.ErrorInvalidGrant {
+		t.Fatalf("Expected revoked refresh token to fail with invalid_grant, got (%#v)", err)
+	}
+}
+
+func TestUnit_ServerLimits(t *testing.T) {
+	s := NewServer("id", "secret")
+	defer s.Close()
+	c := s.Client(5 * time.Second)
+	ctx := context.Background()
+	token, err := c.GetUser(ctx, s.AuthorizationCode("patient"), "uri")
+	if err != nil {
+		t.Fatalf("Unexpected error occurred (%#v)", err)
+	}
+	now := time.Date(2017, 6, 17, 0, 0, 0, 0, time.UTC)
+
+	type testcase struct {
+		name            string
+		setup           func()
+		start           time.Time
+		expectedErrCode string
+	}
+
+	testcases := []testcase{
+		{
+			name:  "base path",
+			start: now.Add(-time.Hour),
+		},
+		{
+			name:            "exceptional path - range too long",
+			start:           now.Add(-dexcom.MaxRange - time.Hour),
+			expectedErrCode: dexcom.ErrorAPI,
+		},
+		{
+			name: "exceptional path - fault",
+			setup: func() {
+				s.InjectFault(Fault{Path: "/v1/users/self/events", Status: http.StatusInternalServerError, Times: 1})
+			},
+			start:           now.Add(-time.Hour),
+			expectedErrCode: dexcom.ErrorAPI,
+		},
+		{
+			name:            "exceptional path - rate limited",
+			setup:           func() { s.SetRateLimit(1, time.Hour); c.GetEvents(ctx, token.AccessToken, now, now) },
+			start:           now.Add(-time.Hour),
+			expectedErrCode: dexcom.ErrorAPI,
+		},
+	}
+
+	for _, tc := range testcases {
+		t.Run(tc.name, func(t *testing.T) {
+			if tc.setup != nil {
+				tc.setup()
+			}
+			_, err := c.GetEvents(ctx, token.AccessToken, tc.start, now)
+			if tc.expectedErrCode != "" || err != nil {
+				if tc.expectedErrCode == "" {
+					t.Fatalf("Unexpected error occurred (%#v)", err)
+				}
+				if err == nil {
+					t.Fatalf("Expected error did not occur")
+				}
+				if err.Code() != tc.expectedErrCode {
+					t.Fatalf("Actual error (%#v) did not match expected (%#v)", err.Code(), tc.expectedErrCode)
+				}
+			}
+		})
+	}
+}
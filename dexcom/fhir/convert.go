@@ -0,0 +1,204 @@
+package fhir
+
+import (
+	"math"
+	"time"
+
+	"github.com/healthimation/go-dexcom/dexcom"
+	"github.com/healthimation/go-glitch/glitch"
+)
+
+const (
+	resourceObservation = "Observation"
+	resourceDevice      = "Device"
+	statusFinal         = "final"
+	manufacturer        = "Dexcom"
+)
+
+// NewBundle returns an empty collection bundle
+func NewBundle() *Bundle {
+	return &Bundle{ResourceType: "Bundle", Type: "collection", Entry: []Entry{}}
+}
+
+// Add appends resources to the bundle
+func Add[T Resource](b *Bundle, resources ...T) {
+	for _, r := range resources {
+		b.Entry = append(b.Entry, Entry{FullURL: fullURL(r), Resource: r})
+	}
+}
+
+// ReferenceTo returns a reference to a resource in the same bundle
+func ReferenceTo(r Resource) *Reference {
+	return &Reference{Reference: fullURL(r)}
+}
+
+// EGVObservations converts egvs to glucose in interstitial fluid observations.  Values are always reported in mg/dL
+// since the LOINC code is a mass concentration.  Readings outside the sensor's range are reported with a < or >
+// comparator.
+func EGVObservations(resp *dexcom.EGVResponse, subject, device *Reference) ([]Observation, glitch.DataError) {
+	if resp == nil {
+		return nil, nil
+	}
+	ret := make([]Observation, 0, len(resp.EGVs))
+	for _, e := range resp.EGVs {
+		effective, err := dateTime(e.SystemTime)
+		if err != nil {
+			return nil, err
+		}
+		o := observation(subject, "egv", dexcom.RecordKey(e.RecordID, e.SystemTime), LOINCGlucoseInterstitial, "Glucose [Mass/volume] in Interstitial fluid")
+		o.EffectiveDateTime = effective
+		o.Device = device
+		o.ValueQuantity = mgdl(e.Value, resp.Unit)
+		if e.Status != nil {
+			switch *e.Status {
+			case dexcom.StatusLow:
+				o.ValueQuantity.Comparator = "<"
+				o.Interpretation = []CodeableConcept{interpretation("LL", "Critical low")}
+			case dexcom.StatusHigh:
+				o.ValueQuantity.Comparator = ">"
+				o.Interpretation = []CodeableConcept{interpretation("HH", "Critical high")}
+			}
+		}
+		ret = append(ret, o)
+	}
+	return ret, nil
+}
+
+// CalibrationObservations converts calibrations to glucose in blood observations, in mg/dL
+func CalibrationObservations(resp *dexcom.CalibrationResponse, subject, device *Reference) ([]Observation, glitch.DataError) {
+	if resp == nil {
+		return nil, nil
+	}
+	ret := make([]Observation, 0, len(resp.Calibrations))
+	for _, c := range resp.Calibrations {
+		effective, err := dateTime(c.SystemTime)
+		if err != nil {
+			return nil, err
+		}
+		o := observation(subject, "calibration", dexcom.RecordKey(c.RecordID, c.SystemTime), LOINCGlucoseBlood, "Glucose [Mass/volume] in Blood")
+		o.EffectiveDateTime = effective
+		o.Device = device
+		o.ValueQuantity = mgdl(c.Value, c.Unit)
+		ret = append(ret, o)
+	}
+	return ret, nil
+}
+
+// SummaryObservations converts statistics for start to end into the observations of the HL7 CGM implementation guide:
+// mean glucose, glucose management indicator, time in target, coefficient of variation and sensor active percentage,
+// preceded by the cgm-summary observation that groups them.  unit is the unit the statistics were computed in.  Time
+// in target is relative to the target range the statistics were requested with.  The guide reports time below and
+// above target in very low, low, high and very high bands that the statistics' single target range doesn't give, so
+// those are left out.  The coefficient of variation is left out when the mean is zero.
+func SummaryObservations(stats *dexcom.Statistics, unit string, start, end time.Time, subject *Reference) []Observation {
+	if stats == nil {
+		return nil
+	}
+	period := &Period{Start: start.UTC().Format(time.RFC3339), End: end.UTC().Format(time.RFC3339)}
+	periodKey := period.Start + "/" + period.End
+
+	mean := observation(subject, "mean", periodKey, LOINCMeanGlucose, "Average glucose [Mass/volume] in Interstitial fluid during reporting period")
+	mean.ValueQuantity = mgdl(stats.Mean, unit)
+
+	gmi := observation(subject, "gmi", periodKey, LOINCGMI, "Glucose management indicator")
+	gmi.ValueQuantity = percent(3.31 + 0.02392*mean.ValueQuantity.Value)
+
+	tir := observation(subject, "tir", periodKey, LOINCTimeInTarget, "Glucose measurements in range out of Total glucose measurements during reporting period")
+	tir.ValueQuantity = percent(stats.PercentWithinRange)
+
+	active := cgmObservation(subject, "active", periodKey, CodeSensorActivePercentage, "Sensor active percentage")
+	active.ValueQuantity = percent(stats.UtilizationPercent)
+
+	summary := Observation{
+		ResourceType:    resourceObservation,
+		ID:              id(subject, "summary", periodKey),
+		Status:          statusFinal,
+		Category:        laboratory(),
+		Code:            CodeableConcept{Coding: []Coding{Coding{System: SystemCGMSummary, Code: CodeCGMSummary, Display: "CGM Summary"}}},
+		Subject:         subject,
+		EffectivePeriod: period,
+	}
+	ret := []Observation{summary, mean, gmi, tir}
+	if stats.Mean != 0 {
+		cv := cgmObservation(subject, "cv", periodKey, CodeCoefficientOfVariation, "Coefficient of variation")
+		cv.ValueQuantity = percent(100 * stats.StdDev / stats.Mean)
+		ret = append(ret, cv)
+	}
+	ret = append(ret, active)
+	for i := 1; i < len(ret); i++ {
+		ret[i].EffectivePeriod = period
+		ret[0].HasMember = append(ret[0].HasMember, *ReferenceTo(ret[i]))
+	}
+	return ret
+}
+
+// DeviceResource converts a device
+func DeviceResource(d dexcom.Device, patient *Reference) Device {
+	return Device{
+		ResourceType: resourceDevice,
+		ID:           id(patient, "device", d.Model),
+		Manufacturer: manufacturer,
+		DeviceName:   []DeviceName{DeviceName{Name: d.Model, Type: "model-name"}},
+		Patient:      patient,
+	}
+}
+
+func observation(subject *Reference, kind, k, code, display string) Observation {
+	return Observation{
+		ResourceType: resourceObservation,
+		ID:           id(subject, kind, k),
+		Status:       statusFinal,
+		Category:     laboratory(),
+		Code:         CodeableConcept{Coding: []Coding{Coding{System: SystemLOINC, Code: code, Display: display}}},
+		Subject:      subject,
+	}
+}
+
+// cgmObservation is an observation coded in the CGM implementation guide's temporary code system
+func cgmObservation(subject *Reference, kind, k, code, display string) Observation {
+	o := observation(subject, kind, k, code, display)
+	o.Code.Coding[0].System = SystemCGMSummary
+	return o
+}
+
+func laboratory() []CodeableConcept {
+	return []CodeableConcept{CodeableConcept{Coding: []Coding{Coding{System: SystemObservationCategory, Code: "laboratory"}}}}
+}
+
+func interpretation(code, display string) CodeableConcept {
+	return CodeableConcept{Coding: []Coding{Coding{System: SystemObservationInterpret, Code: code, Display: display}}}
+}
+
+func mgdl(value float64, unit string) *Quantity {
+	if unit == "" {
+		unit = dexcom.UnitMgDL
+	}
+	value = math.Round(dexcom.ConvertGlucose(value, unit, dexcom.UnitMgDL)*10) / 10
+	return &Quantity{Value: value, Unit: dexcom.UnitMgDL, System: SystemUCUM, Code: "mg/dL"}
+}
+
+func percent(value float64) *Quantity {
+	return &Quantity{Value: math.Round(value*10) / 10, Unit: "%", System: SystemUCUM, Code: "%"}
+}
+
+// dateTime converts an api time to a FHIR dateTime
+func dateTime(systemTime string) (string, glitch.DataError) {
+	t, err := dexcom.ParseTime(systemTime)
+	if err != nil {
+		return "", err
+	}
+	return t.UTC().Format(time.RFC3339), nil
+}
+
+// id returns the subject's uuid for a record so converting the same record twice gives the same resource id
+func id(subject *Reference, kind, k string) string {
+	s := ""
+	if subject != nil {
+		s = subject.Reference
+	}
+	return dexcom.RecordUUID(s, kind, k)
+}
+
+func fullURL(r Resource) string {
+	return "urn:uuid:" + r.ResourceID()
+}
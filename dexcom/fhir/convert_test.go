@@ -0,0 +1,150 @@
+package fhir
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/healthimation/go-dexcom/dexcom"
+)
+
+func TestUnit_EGVObservations(t *testing.T) {
+	low := dexcom.StatusLow
+	patient := &Reference{Reference: "Patient/123"}
+
+	type testcase struct {
+		name            string
+		resp            *dexcom.EGVResponse
+		expectedErrCode string
+		expected        []Quantity
+	}
+
+	testcases := []testcase{
+		{
+			name: "base path",
+			resp: &dexcom.EGVResponse{Unit: "mg/dL", EGVs: []dexcom.EGV{dexcom.EGV{SystemTime: "2017-06-16T15:40:00", Value: 119}}},
+			expected: []Quantity{
+				Quantity{Value: 119, Unit: "mg/dL", System: SystemUCUM, Code: "mg/dL"},
+			},
+		},
+		{
+			name: "mmol and out of range",
+			resp: &dexcom.EGVResponse{Unit: "mmol/L", EGVs: []dexcom.EGV{
+				dexcom.EGV{SystemTime: "2017-06-16T15:40:00", Value: 6.6},
+				dexcom.EGV{SystemTime: "2017-06-16T15:45:00", Value: 2.2, Status: &low},
+			}},
+			expected: []Quantity{
+				Quantity{Value: 118.9, Unit: "mg/dL", System: SystemUCUM, Code: "mg/dL"},
+				Quantity{Value: 39.6, Comparator: "<", Unit: "mg/dL", System: SystemUCUM, Code: "mg/dL"},
+			},
+		},
+		{
+			name:            "exceptional path - bad time",
+			resp:            &dexcom.EGVResponse{EGVs: []dexcom.EGV{dexcom.EGV{SystemTime: "yesterday"}}},
+			expectedErrCode: dexcom.ErrorTime,
+		},
+	}
+
+	for _, tc := range testcases {
+		t.Run(tc.name, func(t *testing.T) {
+			obs, err := EGVObservations(tc.resp, patient, nil)
+			if tc.expectedErrCode != "" || err != nil {
+				if tc.expectedErrCode == "" {
+					t.Fatalf("Unexpected error occurred (%#v)", err)
+				}
+				if err == nil {
+					t.Fatalf("Expected error did not occur")
+				}
+				if err.Code() != tc.expectedErrCode {
+					t.Fatalf("Actual error (%#v) did not match expected (%#v)", err.Code(), tc.expectedErrCode)
+				}
+				return
+			}
+			var actual []Quantity
+			for _, o := range obs {
+				if o.Code.Coding[0].Code != LOINCGlucoseInterstitial || o.Subject != patient || !strings.HasSuffix(o.EffectiveDateTime, "Z") {
+					t.Fatalf("Unexpected observation (%#v)", o)
+				}
+				actual = append(actual, *o.ValueQuantity)
+			}
+			if !reflect.DeepEqual(actual, tc.expected) {
+				t.Fatalf("Actual (%#v) did not match expected (%#v)", actual, tc.expected)
+			}
+		})
+	}
+}
+
+func TestUnit_Bundle(t *testing.T) {
+	patient := &Reference{Reference: "Patient/123"}
+	device := DeviceResource(dexcom.Device{Model: "G6 Mobile App"}, patient)
+	egvs, err := EGVObservations(&dexcom.EGVResponse{EGVs: []dexcom.EGV{dexcom.EGV{RecordID: "abc", SystemTime: "2017-06-16T15:40:00", Value: 119}}}, patient, ReferenceTo(device))
+	if err != nil {
+		t.Fatalf("Unexpected error occurred (%#v)", err)
+	}
+	start := time.Date(2017, 6, 1, 0, 0, 0, 0, time.UTC)
+	stats := &dexcom.Statistics{Mean: 154, StdDev: 50.05, PercentWithinRange: 71.25, PercentBelowRange: 3.5, PercentAboveRange: 25.25, UtilizationPercent: 93.04}
+	summary := SummaryObservations(stats, "mg/dL", start, start.AddDate(0, 0, 14), patient)
+
+	b := NewBundle()
+	Add(b, device)
+	Add(b, egvs...)
+	Add(b, summary...)
+
+	by, jerr := json.Marshal(b)
+	if jerr != nil {
+		t.Fatalf("Unexpected error occurred (%#v)", jerr)
+	}
+	var decoded struct {
+		ResourceType string
+		Entry        []struct {
+			FullURL  string
+			Resource map[string]interface{}
+		}
+	}
+	if jerr := json.Unmarshal(by, &decoded); jerr != nil {
+		t.Fatalf("Unexpected error occurred (%#v)", jerr)
+	}
+	if decoded.ResourceType != "Bundle" || len(decoded.Entry) != 8 {
+		t.Fatalf("Unexpected bundle %s", by)
+	}
+	urls := map[string]bool{}
+	for _, e := range decoded.Entry {
+		urls[e.FullURL] = true
+	}
+	if len(urls) != 8 {
+		t.Fatalf("Expected unique fullUrls, got %v", urls)
+	}
+	if egvs[0].Device.Reference != decoded.Entry[0].FullURL {
+		t.Fatalf("Expected egv device reference to the device entry, got %s", egvs[0].Device.Reference)
+	}
+	if summary[0].Code.Coding[0].Code != CodeCGMSummary || len(summary[0].HasMember) != 5 {
+		t.Fatalf("Unexpected summary (%#v)", summary[0])
+	}
+	for _, m := range summary[0].HasMember {
+		if !urls[m.Reference] {
+			t.Fatalf("Summary member %s is not in the bundle", m.Reference)
+		}
+	}
+	values := map[string]float64{}
+	for _, o := range summary[1:] {
+		values[o.Code.Coding[0].Code] = o.ValueQuantity.Value
+	}
+	expected := map[string]float64{
+		LOINCMeanGlucose:           154,
+		LOINCGMI:                   7,
+		LOINCTimeInTarget:          71.3,
+		CodeCoefficientOfVariation: 32.5,
+		CodeSensorActivePercentage: 93,
+	}
+	if !reflect.DeepEqual(values, expected) {
+		t.Fatalf("Actual summary values (%v) did not match expected (%v)", values, expected)
+	}
+	if noMean := SummaryObservations(&dexcom.Statistics{}, "mg/dL", start, start.AddDate(0, 0, 14), patient); len(noMean) != 5 {
+		t.Fatalf("Actual observations without a mean (%d) did not match expected (5)", len(noMean))
+	}
+	if again, _ := EGVObservations(&dexcom.EGVResponse{EGVs: []dexcom.EGV{dexcom.EGV{RecordID: "abc", SystemTime: "2017-06-16T15:40:00"}}}, patient, nil); again[0].ID != egvs[0].ID {
+		t.Fatalf("Expected stable ids, got %s and %s", again[0].ID, egvs[0].ID)
+	}
+}
@@ -0,0 +1,130 @@
+// Package fhir converts dexcom data to HL7 FHIR R4 resources.  Only the parts of the resources the conversions use
+// are modelled.
+package fhir
+
+// Code systems
+const (
+	SystemLOINC                = "http://loinc.org"
+	SystemUCUM                 = "http://unitsofmeasure.org"
+	SystemObservationCategory  = "http://terminology.hl7.org/CodeSystem/observation-category"
+	SystemCGMSummary           = "http://hl7.org/uv/cgm/CodeSystem/cgm-summary-codes-temporary"
+	SystemDeviceNameType       = "http://hl7.org/fhir/device-nametype"
+	SystemObservationInterpret = "http://terminology.hl7.org/CodeSystem/v3-ObservationInterpretation"
+)
+
+// LOINC codes
+const (
+	// LOINCGlucoseInterstitial is glucose [Mass/volume] in interstitial fluid, the reading of a CGM
+	LOINCGlucoseInterstitial = "99504-3"
+	// LOINCGlucoseBlood is glucose [Mass/volume] in blood, the reading of a meter used to calibrate
+	LOINCGlucoseBlood = "2339-0"
+	// LOINCMeanGlucose is average glucose [Mass/volume] in interstitial fluid during the reporting period
+	LOINCMeanGlucose = "97507-8"
+	// LOINCGMI is the glucose management indicator
+	LOINCGMI = "97506-0"
+	// LOINCTimeInTarget is the percentage of readings in range during the reporting period
+	LOINCTimeInTarget = "97510-2"
+)
+
+// Codes of the HL7 CGM implementation guide's temporary code system
+const (
+	// CodeCGMSummary is the summary observation that groups the others
+	CodeCGMSummary = "cgm-summary"
+	// CodeCoefficientOfVariation is the standard deviation of glucose as a percentage of the mean
+	CodeCoefficientOfVariation = "cv"
+	// CodeSensorActivePercentage is the percentage of the reporting period the sensor was producing readings
+	CodeSensorActivePercentage = "sensor-active-percentage"
+)
+
+// Resource is a FHIR resource that can be put in a Bundle
+type Resource interface {
+	ResourceID() string
+}
+
+// Bundle is a collection of resources
+type Bundle struct {
+	ResourceType string  `json:"resourceType"`
+	Type         string  `json:"type"`
+	Entry        []Entry `json:"entry"`
+}
+
+// Entry is a resource in a Bundle
+type Entry struct {
+	FullURL  string   `json:"fullUrl"`
+	Resource Resource `json:"resource"`
+}
+
+// Coding is a code from a code system
+type Coding struct {
+	System  string `json:"system,omitempty"`
+	Code    string `json:"code"`
+	Display string `json:"display,omitempty"`
+}
+
+// CodeableConcept is a concept given by one or more codings
+type CodeableConcept struct {
+	Coding []Coding `json:"coding,omitempty"`
+	Text   string   `json:"text,omitempty"`
+}
+
+// Quantity is a measured amount
+type Quantity struct {
+	Value float64 `json:"value"`
+	// Comparator is < or > for values outside what the device can measure
+	Comparator string `json:"comparator,omitempty"`
+	Unit       string `json:"unit"`
+	System     string `json:"system"`
+	Code       string `json:"code"`
+}
+
+// Reference points at another resource, e.g. "Patient/123" or a bundle entry's fullUrl
+type Reference struct {
+	Reference string `json:"reference"`
+}
+
+// Period is a range of time
+type Period struct {
+	Start string `json:"start"`
+	End   string `json:"end"`
+}
+
+// Observation is a FHIR R4 Observation
+type Observation struct {
+	ResourceType      string            `json:"resourceType"`
+	ID                string            `json:"id"`
+	Status            string            `json:"status"`
+	Category          []CodeableConcept `json:"category,omitempty"`
+	Code              CodeableConcept   `json:"code"`
+	Subject           *Reference        `json:"subject,omitempty"`
+	EffectiveDateTime string            `json:"effectiveDateTime,omitempty"`
+	EffectivePeriod   *Period           `json:"effectivePeriod,omitempty"`
+	ValueQuantity     *Quantity         `json:"valueQuantity,omitempty"`
+	Interpretation    []CodeableConcept `json:"interpretation,omitempty"`
+	Device            *Reference        `json:"device,omitempty"`
+	HasMember         []Reference       `json:"hasMember,omitempty"`
+}
+
+// ResourceID returns the observation's id
+func (o Observation) ResourceID() string {
+	return o.ID
+}
+
+// DeviceName is a name of a Device
+type DeviceName struct {
+	Name string `json:"name"`
+	Type string `json:"type"`
+}
+
+// Device is a FHIR R4 Device
+type Device struct {
+	ResourceType string       `json:"resourceType"`
+	ID           string       `json:"id"`
+	Manufacturer string       `json:"manufacturer,omitempty"`
+	DeviceName   []DeviceName `json:"deviceName,omitempty"`
+	Patient      *Reference   `json:"patient,omitempty"`
+}
+
+// ResourceID returns the device's id
+func (d Device) ResourceID() string {
+	return d.ID
+}
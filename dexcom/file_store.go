@@ -0,0 +1,134 @@
+package dexcom
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/healthimation/go-glitch/glitch"
+)
+
+// jsonFile is a json object keyed by user id kept in a single file.  It is read on every call so that users added by
+// another process are picked up, and replaced via a temp file and rename on every write.
+type jsonFile[T any] struct {
+	path string
+	mu   sync.Mutex
+}
+
+func (f *jsonFile[T]) read() (map[string]T, glitch.DataError) {
+	ret := make(map[string]T)
+	by, err := os.ReadFile(f.path)
+	if os.IsNotExist(err) {
+		return ret, nil
+	}
+	if err != nil {
+		return nil, glitch.NewDataError(err, ErrorStorage, "Could not read "+f.path)
+	}
+	if err := json.Unmarshal(by, &ret); err != nil {
+		return nil, glitch.NewDataError(err, ErrorJSON, "Could not unmarshal "+f.path)
+	}
+	return ret, nil
+}
+
+func (f *jsonFile[T]) get(userID string) (T, glitch.DataError) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	var zero T
+	values, err := f.read()
+	if err != nil {
+		return zero, err
+	}
+	return values[userID], nil
+}
+
+func (f *jsonFile[T]) set(userID string, value T) glitch.DataError {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	values, err := f.read()
+	if err != nil {
+		return err
+	}
+	values[userID] = value
+	by, jerr := json.MarshalIndent(values, "", "  ")
+	if jerr != nil {
+		return glitch.NewDataError(jerr, ErrorJSON, "Could not marshal "+f.path)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(f.path), 0700); err != nil {
+		return glitch.NewDataError(err, ErrorStorage, "Could not create directory")
+	}
+	tmp, terr := os.CreateTemp(filepath.Dir(f.path), filepath.Base(f.path)+".*.tmp")
+	if terr != nil {
+		return glitch.NewDataError(terr, ErrorStorage, "Could not create temp file")
+	}
+	defer os.Remove(tmp.Name())
+	_, werr := tmp.Write(by)
+	if werr == nil {
+		werr = tmp.Sync()
+	}
+	if cerr := tmp.Close(); werr == nil {
+		werr = cerr
+	}
+	if werr == nil {
+		werr = os.Rename(tmp.Name(), f.path)
+	}
+	if werr != nil {
+		return glitch.NewDataError(werr, ErrorStorage, "Could not write "+f.path)
+	}
+	return nil
+}
+
+type fileTokenStore struct {
+	f jsonFile[*UserToken]
+}
+
+// NewFileTokenStore returns a TokenStore kept in a json file at path mapping user ids to tokens, as returned by the
+// token endpoint.  The file is created with owner only permissions since it holds refresh tokens.
+func NewFileTokenStore(path string) TokenStore {
+	return &fileTokenStore{f: jsonFile[*UserToken]{path: path}}
+}
+
+func (s *fileTokenStore) ListUsers(ctx context.Context) ([]string, glitch.DataError) {
+	s.f.mu.Lock()
+	defer s.f.mu.Unlock()
+	tokens, err := s.f.read()
+	if err != nil {
+		return nil, err
+	}
+	ret := make([]string, 0, len(tokens))
+	for userID := range tokens {
+		ret = append(ret, userID)
+	}
+	sort.Strings(ret)
+	return ret, nil
+}
+
+func (s *fileTokenStore) GetToken(ctx context.Context, userID string) (*UserToken, glitch.DataError) {
+	return s.f.get(userID)
+}
+
+func (s *fileTokenStore) SaveToken(ctx context.Context, userID string, token *UserToken) glitch.DataError {
+	return s.f.set(userID, token)
+}
+
+type fileCheckpointStore struct {
+	f jsonFile[time.Time]
+}
+
+// NewFileCheckpointStore returns a CheckpointStore kept in a json file at path, so syncs pick up where they left off
+// after a restart
+func NewFileCheckpointStore(path string) CheckpointStore {
+	return &fileCheckpointStore{f: jsonFile[time.Time]{path: path}}
+}
+
+func (s *fileCheckpointStore) GetCheckpoint(ctx context.Context, userID string) (time.Time, glitch.DataError) {
+	return s.f.get(userID)
+}
+
+func (s *fileCheckpointStore) SaveCheckpoint(ctx context.Context, userID string, checkpoint time.Time) glitch.DataError {
+	return s.f.set(userID, checkpoint)
+}
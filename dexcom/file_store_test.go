@@ -0,0 +1,73 @@
+package dexcom
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestUnit_FileTokenStore(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "state", "tokens.json")
+	expire := time.Date(2017, 6, 16, 15, 40, 0, 0, time.UTC)
+
+	s := NewFileTokenStore(path)
+	users, err := s.ListUsers(ctx)
+	if err != nil || len(users) != 0 {
+		t.Fatalf("Actual users (%v, %v) did not match expected ([])", users, err)
+	}
+	if err := s.SaveToken(ctx, "b", &UserToken{AccessToken: "access", RefreshToken: "refresh", ExpireTime: &expire}); err != nil {
+		t.Fatalf("Unexpected error occurred (%#v)", err)
+	}
+	if err := s.SaveToken(ctx, "a", &UserToken{AccessToken: "other"}); err != nil {
+		t.Fatalf("Unexpected error occurred (%#v)", err)
+	}
+
+	// a new store sees what the first one saved
+	s = NewFileTokenStore(path)
+	users, err = s.ListUsers(ctx)
+	if err != nil || !reflect.DeepEqual(users, []string{"a", "b"}) {
+		t.Fatalf("Actual users (%v, %v) did not match expected ([a b])", users, err)
+	}
+	token, err := s.GetToken(ctx, "b")
+	if err != nil || token.RefreshToken != "refresh" || !token.ExpireTime.Equal(expire) {
+		t.Fatalf("Actual token (%#v, %v) did not match expected", token, err)
+	}
+	if token, err := s.GetToken(ctx, "missing"); err != nil || token != nil {
+		t.Fatalf("Actual token (%#v, %v) did not match expected (nil)", token, err)
+	}
+
+	info, serr := os.Stat(path)
+	if serr != nil || info.Mode().Perm() != 0600 {
+		t.Fatalf("Actual mode (%v, %v) did not match expected (0600)", info, serr)
+	}
+
+	if err := os.WriteFile(path, []byte("{"), 0600); err != nil {
+		t.Fatalf("Unexpected error occurred (%v)", err)
+	}
+	if _, err := s.ListUsers(ctx); err == nil || err.Code() != ErrorJSON {
+		t.Fatalf("Actual error (%v) did not match expected (%s)", err, ErrorJSON)
+	}
+}
+
+func TestUnit_FileCheckpointStore(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "checkpoints.json")
+	checkpoint := time.Date(2017, 6, 16, 15, 40, 0, 0, time.UTC)
+
+	if err := NewFileCheckpointStore(path).SaveCheckpoint(ctx, "user", checkpoint); err != nil {
+		t.Fatalf("Unexpected error occurred (%#v)", err)
+	}
+	s := NewFileCheckpointStore(path)
+	actual, err := s.GetCheckpoint(ctx, "user")
+	if err != nil || !actual.Equal(checkpoint) {
+		t.Fatalf("Actual checkpoint (%v, %v) did not match expected (%v)", actual, err, checkpoint)
+	}
+	actual, err = s.GetCheckpoint(ctx, "new")
+	if err != nil || !actual.IsZero() {
+		t.Fatalf("Actual checkpoint (%v, %v) did not match expected (zero)", actual, err)
+	}
+}
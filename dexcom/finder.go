@@ -2,11 +2,18 @@ package dexcom
 
 import (
 	"net/url"
+	"strings"
+)
+
+// Base urls of the dexcom apis
+const (
+	BaseURL        = "https://api.dexcom.com/"
+	SandboxBaseURL = "https://sandbox-api.dexcom.com/"
 )
 
 // Finder to use with base client
 func findDexcom(serviceName string, useTLS bool) (url.URL, error) {
-	ret, err := url.Parse("https://api.dexcom.com/")
+	ret, err := url.Parse(BaseURL)
 	if err != nil || ret == nil {
 		return url.URL{}, err
 	}
@@ -14,9 +21,31 @@ func findDexcom(serviceName string, useTLS bool) (url.URL, error) {
 }
 
 func findDexcomSandbox(serviceName string, useTLS bool) (url.URL, error) {
-	ret, err := url.Parse("https://sandbox-api.dexcom.com/")
+	ret, err := url.Parse(SandboxBaseURL)
 	if err != nil || ret == nil {
 		return url.URL{}, err
 	}
 	return *ret, err
 }
+
+func staticFinder(baseURL string) func(serviceName string, useTLS bool) (url.URL, error) {
+	return func(serviceName string, useTLS bool) (url.URL, error) {
+		ret, err := url.Parse(baseURL)
+		if err != nil || ret == nil {
+			return url.URL{}, err
+		}
+		return *ret, err
+	}
+}
+
+// LoginURL returns the dexcom page at baseURL, e.g. BaseURL, where a user authorizes clientID.  Dexcom redirects the
+// browser back to redirectURI with the authorization code and state as query params.
+func LoginURL(baseURL, clientID, redirectURI, state string) string {
+	q := url.Values{}
+	q.Set(paramClientID, clientID)
+	q.Set(paramRedirectURI, redirectURI)
+	q.Set("response_type", "code")
+	q.Set("scope", "offline_access")
+	q.Set("state", state)
+	return strings.TrimSuffix(baseURL, "/") + "/v1/oauth2/login?" + q.Encode()
+}
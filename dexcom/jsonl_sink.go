@@ -0,0 +1,199 @@
+package dexcom
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/healthimation/go-glitch/glitch"
+)
+
+// file names used by the jsonl sink
+const (
+	jsonlEGVs         = "egvs.jsonl"
+	jsonlEvents       = "events.jsonl"
+	jsonlDevices      = "devices.jsonl"
+	jsonlCalibrations = "calibrations.jsonl"
+	jsonlStatistics   = "statistics.jsonl"
+)
+
+// statisticsRecord is a Statistics along with the window it was calculated for
+type statisticsRecord struct {
+	StartDate string `json:"startDate"`
+	EndDate   string `json:"endDate"`
+	Statistics
+}
+
+type jsonlSink struct {
+	dir string
+	mu  sync.Mutex
+}
+
+// NewJSONLSink returns a Sink that keeps one JSON lines file per user and record type under dir, e.g.
+// dir/<user>/egvs.jsonl.  Each batch is merged with the existing file, which is then atomically replaced, so the
+// files never contain duplicates and are always sorted by time.
+func NewJSONLSink(dir string) Sink {
+	return &jsonlSink{dir: dir}
+}
+
+func (j *jsonlSink) UpsertEGVs(ctx context.Context, userID string, egvs []EGV) glitch.DataError {
+	return upsertJSONL(j, userID, jsonlEGVs, egvs, egvKey, func(a, b EGV) bool {
+		return compareTimes(a.SystemTime, b.SystemTime) < 0
+	})
+}
+
+func (j *jsonlSink) UpsertEvents(ctx context.Context, userID string, events []Event) glitch.DataError {
+	return upsertJSONL(j, userID, jsonlEvents, events, eventKey, func(a, b Event) bool {
+		return compareTimes(a.SystemTime, b.SystemTime) < 0
+	})
+}
+
+func (j *jsonlSink) UpsertDevices(ctx context.Context, userID string, devices []Device) glitch.DataError {
+	return upsertJSONL(j, userID, jsonlDevices, devices, deviceKey, func(a, b Device) bool {
+		return a.Model < b.Model
+	})
+}
+
+func (j *jsonlSink) UpsertCalibrations(ctx context.Context, userID string, calibrations []Calibration) glitch.DataError {
+	return upsertJSONL(j, userID, jsonlCalibrations, calibrations, calibrationKey, func(a, b Calibration) bool {
+		return compareTimes(a.SystemTime, b.SystemTime) < 0
+	})
+}
+
+func (j *jsonlSink) UpsertStatistics(ctx context.Context, userID string, startDate, endDate time.Time, stats *Statistics) glitch.DataError {
+	if stats == nil {
+		return nil
+	}
+	record := statisticsRecord{StartDate: FormatTime(startDate), EndDate: FormatTime(endDate), Statistics: *stats}
+	return upsertJSONL(j, userID, jsonlStatistics, []statisticsRecord{record}, statisticsKey, func(a, b statisticsRecord) bool {
+		return statisticsKey(a) < statisticsKey(b)
+	})
+}
+
+// userDir returns the user's directory.  User ids are path escaped, and ids that would escape to "." or ".." are
+// refused so one user's records can't land outside the sink's directory.
+func (j *jsonlSink) userDir(userID string) (string, glitch.DataError) {
+	name := url.PathEscape(userID)
+	if name == "" || name == "." || name == ".." {
+		return "", glitch.NewDataError(nil, ErrorMissingParam, fmt.Sprintf("Invalid user id %q", userID))
+	}
+	return filepath.Join(j.dir, name), nil
+}
+
+func upsertJSONL[T any](j *jsonlSink, userID, name string, records []T, key func(T) string, less func(a, b T) bool) glitch.DataError {
+	if len(records) == 0 {
+		return nil
+	}
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	dir, derr := j.userDir(userID)
+	if derr != nil {
+		return derr
+	}
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return glitch.NewDataError(err, ErrorStorage, "Could not create user directory")
+	}
+	path := filepath.Join(dir, name)
+
+	existing, derr := readJSONL[T](path)
+	if derr != nil {
+		return derr
+	}
+	index := make(map[string]int, len(existing))
+	for i, r := range existing {
+		index[key(r)] = i
+	}
+	for _, r := range records {
+		if i, ok := index[key(r)]; ok {
+			existing[i] = r
+			continue
+		}
+		index[key(r)] = len(existing)
+		existing = append(existing, r)
+	}
+	sort.SliceStable(existing, func(a, b int) bool { return less(existing[a], existing[b]) })
+
+	return writeJSONL(path, existing)
+}
+
+func readJSONL[T any](path string) ([]T, glitch.DataError) {
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, glitch.NewDataError(err, ErrorStorage, "Could not open jsonl file")
+	}
+	defer f.Close()
+
+	var ret []T
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for line := 1; scanner.Scan(); line++ {
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+		var r T
+		if err := json.Unmarshal(scanner.Bytes(), &r); err != nil {
+			return nil, glitch.NewDataError(err, ErrorJSON, fmt.Sprintf("Could not unmarshal line %d of %s", line, path))
+		}
+		ret = append(ret, r)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, glitch.NewDataError(err, ErrorStorage, "Could not read jsonl file")
+	}
+	return ret, nil
+}
+
+// writeJSONL replaces path via a temp file and rename so a crash never leaves a partial file behind
+func writeJSONL[T any](path string, records []T) glitch.DataError {
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return glitch.NewDataError(err, ErrorStorage, "Could not create temp file")
+	}
+	defer os.Remove(tmp.Name())
+
+	w := bufio.NewWriter(tmp)
+	enc := json.NewEncoder(w)
+	for _, r := range records {
+		if err := enc.Encode(r); err != nil {
+			tmp.Close()
+			return glitch.NewDataError(err, ErrorJSON, "Could not marshal record")
+		}
+	}
+	if err := w.Flush(); err != nil {
+		tmp.Close()
+		return glitch.NewDataError(err, ErrorStorage, "Could not write jsonl file")
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return glitch.NewDataError(err, ErrorStorage, "Could not sync jsonl file")
+	}
+	if err := tmp.Close(); err != nil {
+		return glitch.NewDataError(err, ErrorStorage, "Could not close jsonl file")
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return glitch.NewDataError(err, ErrorStorage, "Could not replace jsonl file")
+	}
+	return nil
+}
+
+func deviceKey(device Device) string {
+	return device.Model
+}
+
+func calibrationKey(calibration Calibration) string {
+	return normalizeTime(calibration.SystemTime)
+}
+
+func statisticsKey(record statisticsRecord) string {
+	return record.StartDate + "|" + record.EndDate
+}
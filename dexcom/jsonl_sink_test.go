@@ -0,0 +1,78 @@
+package dexcom
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestUnit_JSONLSink(t *testing.T) {
+	dir := t.TempDir()
+	s := NewJSONLSink(dir)
+	ctx := context.Background()
+
+	batches := [][]EGV{
+		[]EGV{EGV{SystemTime: "2017-06-16T15:45:00", Value: 120}, EGV{SystemTime: "2017-06-16T15:40:00", Value: 119}},
+		[]EGV{EGV{SystemTime: "2017-06-16T15:45:00", Value: 121}},
+	}
+	for _, batch := range batches {
+		if err := s.UpsertEGVs(ctx, "user/1", batch); err != nil {
+			t.Fatalf("Unexpected error occurred (%#v)", err)
+		}
+	}
+	if err := s.UpsertStatistics(ctx, "user/1", time.Date(2017, 6, 1, 0, 0, 0, 0, time.UTC), time.Date(2017, 6, 2, 0, 0, 0, 0, time.UTC), &Statistics{Mean: 120}); err != nil {
+		t.Fatalf("Unexpected error occurred (%#v)", err)
+	}
+
+	ret, err := readJSONL[EGV](filepath.Join(dir, "user%2F1", jsonlEGVs))
+	if err != nil {
+		t.Fatalf("Unexpected error occurred (%#v)", err)
+	}
+	expected := []EGV{EGV{SystemTime: "2017-06-16T15:40:00", Value: 119}, EGV{SystemTime: "2017-06-16T15:45:00", Value: 121}}
+	if !reflect.DeepEqual(expected, ret) {
+		t.Fatalf("Actual records (%#v) did not match expected (%#v)", ret, expected)
+	}
+
+	stats, err := readJSONL[statisticsRecord](filepath.Join(dir, "user%2F1", jsonlStatistics))
+	if err != nil {
+		t.Fatalf("Unexpected error occurred (%#v)", err)
+	}
+	if len(stats) != 1 || stats[0].Mean != 120 || stats[0].StartDate != "2017-06-01T00:00:00" {
+		t.Fatalf("Actual statistics (%#v) did not match expected", stats)
+	}
+
+	entries, _ := os.ReadDir(filepath.Join(dir, "user%2F1"))
+	if len(entries) != 2 {
+		t.Fatalf("Expected only the jsonl files to remain, found %d entries", len(entries))
+	}
+}
+
+func TestUnit_JSONLSinkUserID(t *testing.T) {
+	dir := t.TempDir()
+	s := NewJSONLSink(filepath.Join(dir, "data"))
+	egvs := []EGV{EGV{SystemTime: "2017-06-16T15:45:00", Value: 120}}
+
+	for _, userID := range []string{"", ".", "..", "../data"} {
+		err := s.UpsertEGVs(context.Background(), userID, egvs)
+		if userID == "../data" {
+			if err != nil {
+				t.Fatalf("[%s] Unexpected error occurred (%#v)", userID, err)
+			}
+			continue
+		}
+		if err == nil || err.Code() != ErrorMissingParam {
+			t.Fatalf("[%s] Actual error (%v) did not match expected (%s)", userID, err, ErrorMissingParam)
+		}
+	}
+	// only the escaped "../data" directory was written, inside the sink's directory
+	entries, _ := os.ReadDir(dir)
+	if len(entries) != 1 {
+		t.Fatalf("Actual entries (%d) outside the sink did not match expected (1)", len(entries))
+	}
+	if _, err := os.Stat(filepath.Join(dir, "data", "..%2Fdata", jsonlEGVs)); err != nil {
+		t.Fatalf("Unexpected error occurred (%#v)", err)
+	}
+}
@@ -0,0 +1,199 @@
+package dexcom
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/healthimation/go-glitch/glitch"
+)
+
+// redactedKeys are the body fields whose values are replaced when logging.  They cover credentials and every field
+// that holds a glucose value or rate.
+var redactedKeys = map[string]bool{
+	paramClientSecret:      true,
+	paramAuthorizationCode: true,
+	paramRefreshToken:      true,
+	"access_token":         true,
+	"value":                true,
+	"realtimeValue":        true,
+	"smoothedValue":        true,
+	"trendRate":            true,
+	"min":                  true,
+	"max":                  true,
+	"mean":                 true,
+	"median":               true,
+	"variance":             true,
+	"stdDev":               true,
+	"sum":                  true,
+	"q1":                   true,
+	"q2":                   true,
+	"q3":                   true,
+}
+
+// LogOptions controls what is logged for each request
+type LogOptions struct {
+	// Bodies adds the request headers and the request and response bodies
+	Bodies bool
+	// Unredacted turns off redaction of tokens, secrets, Authorization headers and glucose values, and adds the text of
+	// errors.  Only use it in development, with test accounts.
+	Unredacted bool
+}
+
+type requestLogger struct {
+	logger *slog.Logger
+	opts   LogOptions
+}
+
+// WithLogger returns a context whose requests are logged to logger.  Successful requests are logged at debug level,
+// error statuses at warn and requests without a response at error.  Credentials and glucose values are redacted
+// unless opts.Unredacted is set.
+func WithLogger(ctx context.Context, logger *slog.Logger, opts LogOptions) context.Context {
+	return context.WithValue(ctx, contextKeyLogger, &requestLogger{logger: logger, opts: opts})
+}
+
+// WithRequestID sets the id logged with the requests made with ctx.  Without one each request gets a random id.
+func WithRequestID(ctx context.Context, requestID string) context.Context {
+	return context.WithValue(ctx, contextKeyRequestID, requestID)
+}
+
+func loggerFromContext(ctx context.Context) *requestLogger {
+	if ctx == nil {
+		return nil
+	}
+	l, _ := ctx.Value(contextKeyLogger).(*requestLogger)
+	return l
+}
+
+func requestID(ctx context.Context) string {
+	if id, ok := ctx.Value(contextKeyRequestID).(string); ok && id != "" {
+		return id
+	}
+	b := make([]byte, 8)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// captureBody reads body so it can be logged, returning a reader over the same bytes for the request
+func (l *requestLogger) captureBody(body io.Reader) ([]byte, io.Reader) {
+	if l == nil || !l.opts.Bodies || body == nil {
+		return nil, body
+	}
+	by, err := io.ReadAll(body)
+	if err != nil {
+		return nil, bytes.NewReader(by)
+	}
+	return by, bytes.NewReader(by)
+}
+
+func (l *requestLogger) log(ctx context.Context, endpoint, method, slug string, query url.Values, headers http.Header, reqBody []byte, status int, respBody []byte, respSize int, latency time.Duration, err glitch.DataError) {
+	if l == nil {
+		return
+	}
+	level := slog.LevelDebug
+	switch {
+	case err != nil || status == 0:
+		level = slog.LevelError
+	case status < 200 || status >= 300:
+		level = slog.LevelWarn
+	}
+	if !l.logger.Enabled(ctx, level) {
+		return
+	}
+
+	attrs := []slog.Attr{
+		slog.String("request_id", requestID(ctx)),
+		slog.String("endpoint", endpoint),
+		slog.String("method", method),
+		slog.String("path", slug),
+	}
+	if query.Has(paramStartDate) {
+		attrs = append(attrs, slog.String("start_date", query.Get(paramStartDate)), slog.String("end_date", query.Get(paramEndDate)))
+	}
+	attrs = append(attrs, slog.Int("status", status), slog.Duration("latency", latency), slog.Int("response_bytes", respSize))
+	if err != nil {
+		attrs = append(attrs, slog.String("error_code", err.Code()))
+		// the error text can hold a response body, so redacted logs only get the code and status
+		if l.opts.Unredacted {
+			attrs = append(attrs, slog.String("error", err.Error()))
+		}
+	}
+	if l.opts.Bodies {
+		attrs = append(attrs,
+			slog.Any("headers", l.headers(headers)),
+			slog.String("request_body", l.body(reqBody)),
+			slog.String("response_body", l.body(respBody)),
+		)
+	}
+	l.logger.LogAttrs(ctx, level, "dexcom request", attrs...)
+}
+
+func (l *requestLogger) headers(headers http.Header) map[string]string {
+	ret := make(map[string]string, len(headers))
+	for k, v := range headers {
+		value := strings.Join(v, ", ")
+		if !l.opts.Unredacted && strings.EqualFold(k, "authorization") {
+			value = redacted
+		}
+		ret[k] = value
+	}
+	return ret
+}
+
+func (l *requestLogger) body(body []byte) string {
+	if l.opts.Unredacted || len(body) == 0 {
+		return string(body)
+	}
+	return redactLogBody(body)
+}
+
+// redactLogBody replaces secrets and glucose values anywhere in a json or form encoded body.  Anything else is
+// replaced whole since it can't be inspected.
+func redactLogBody(body []byte) string {
+	dec := json.NewDecoder(bytes.NewReader(body))
+	dec.UseNumber()
+	var v interface{}
+	if dec.Decode(&v) == nil {
+		by, err := json.Marshal(redactJSON(v))
+		if err != nil {
+			return redacted
+		}
+		return string(by)
+	}
+	values, err := url.ParseQuery(string(body))
+	if err != nil || len(values) == 0 || strings.ContainsAny(string(body), " \n{<") {
+		return redacted
+	}
+	for k := range values {
+		if redactedKeys[k] {
+			values.Set(k, redacted)
+		}
+	}
+	return values.Encode()
+}
+
+func redactJSON(v interface{}) interface{} {
+	switch t := v.(type) {
+	case map[string]interface{}:
+		for k, child := range t {
+			if redactedKeys[k] {
+				t[k] = redacted
+				continue
+			}
+			t[k] = redactJSON(child)
+		}
+	case []interface{}:
+		for i, child := range t {
+			t[i] = redactJSON(child)
+		}
+	}
+	return v
+}
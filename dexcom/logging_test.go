@@ -0,0 +1,110 @@
+package dexcom
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestUnit_Logging(t *testing.T) {
+	c, ts := testClient(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case strings.HasSuffix(r.URL.Path, "token"):
+			fmt.Fprint(w, `{"access_token": "secret-access", "refresh_token": "secret-refresh", "expires_in": 600, "token_type": "Bearer"}`)
+		case strings.HasSuffix(r.URL.Path, "events"):
+			w.WriteHeader(http.StatusUnauthorized)
+			fmt.Fprint(w, `{"fault": {"faultstring": "Invalid Access Token"}}`)
+		default:
+			fmt.Fprint(w, `{"unit": "mg/dL", "egvs": [{"systemTime": "2017-06-16T15:40:00", "value": 119, "trendRate": -1.7}]}`)
+		}
+	}), 5*time.Second)
+	defer ts.Close()
+	start := time.Date(2017, 6, 16, 0, 0, 0, 0, time.UTC)
+
+	type testcase struct {
+		name             string
+		call             func(ctx context.Context)
+		opts             LogOptions
+		level            slog.Level
+		expectedLog      []string
+		expectedRedacted []string
+	}
+
+	// glucose values are matched with the comma that follows them in the body, so digits in the latency never match
+	testcases := []testcase{
+		{
+			name:             "summary only",
+			call:             func(ctx context.Context) { c.GetEGVs(ctx, "secret-access", start, start.Add(time.Hour)) },
+			level:            slog.LevelDebug,
+			expectedLog:      []string{"level=DEBUG", "request_id=req-1", "endpoint=GetEGVs", "start_date=2017-06-16T00:00:00", "status=200"},
+			expectedRedacted: []string{"secret-access", "119,", "response_body"},
+		},
+		{
+			name:             "redacted bodies",
+			call:             func(ctx context.Context) { c.GetEGVs(ctx, "secret-access", start, start.Add(time.Hour)) },
+			opts:             LogOptions{Bodies: true},
+			level:            slog.LevelDebug,
+			expectedLog:      []string{"Authorization:REDACTED", `\"value\":\"REDACTED\"`, `\"systemTime\":\"2017-06-16T15:40:00\"`},
+			expectedRedacted: []string{"secret-access", "119,", "-1.7"},
+		},
+		{
+			name:             "redacted token request",
+			call:             func(ctx context.Context) { c.RefreshUser(ctx, "secret-refresh", "uri") },
+			opts:             LogOptions{Bodies: true},
+			level:            slog.LevelDebug,
+			expectedLog:      []string{"endpoint=RefreshUser", "client_secret=REDACTED", "refresh_token=REDACTED", `\"access_token\":\"REDACTED\"`},
+			expectedRedacted: []string{"secret-access", "secret-refresh", "client_secret=abc"},
+		},
+		{
+			name:        "unredacted",
+			call:        func(ctx context.Context) { c.GetEGVs(ctx, "secret-access", start, start.Add(time.Hour)) },
+			opts:        LogOptions{Bodies: true, Unredacted: true},
+			level:       slog.LevelDebug,
+			expectedLog: []string{"Bearer secret-access", `\"value\": 119`},
+		},
+		{
+			name:        "error status",
+			call:        func(ctx context.Context) { c.GetEvents(ctx, "secret-access", start, start.Add(time.Hour)) },
+			level:       slog.LevelWarn,
+			expectedLog: []string{"level=WARN", "endpoint=GetEvents", "status=401"},
+		},
+		{
+			name: "request error",
+			call: func(ctx context.Context) {
+				ctx, cancel := context.WithCancel(ctx)
+				cancel()
+				c.GetEGVs(ctx, "secret-access", start, start.Add(time.Hour))
+			},
+			level:            slog.LevelDebug,
+			expectedLog:      []string{"level=ERROR", "endpoint=GetEGVs", "error_code="},
+			expectedRedacted: []string{"error=", "context canceled"},
+		},
+		{
+			name:             "below level",
+			call:             func(ctx context.Context) { c.GetEGVs(ctx, "secret-access", start, start.Add(time.Hour)) },
+			level:            slog.LevelInfo,
+			expectedRedacted: []string{"dexcom request"},
+		},
+	}
+
+	for _, test := range testcases {
+		buf := &bytes.Buffer{}
+		logger := slog.New(slog.NewTextHandler(buf, &slog.HandlerOptions{Level: test.level}))
+		test.call(WithRequestID(WithLogger(context.Background(), logger, test.opts), "req-1"))
+		for _, s := range test.expectedLog {
+			if !strings.Contains(buf.String(), s) {
+				t.Fatalf("[%s] Actual log did not contain (%s) | %s", test.name, s, buf)
+			}
+		}
+		for _, s := range test.expectedRedacted {
+			if strings.Contains(buf.String(), s) {
+				t.Fatalf("[%s] Actual log contained (%s) | %s", test.name, s, buf)
+			}
+		}
+	}
+}
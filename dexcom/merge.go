@@ -0,0 +1,174 @@
+package dexcom
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/healthimation/go-glitch/glitch"
+)
+
+// MergeEGVs combines several egv responses into one, keeping one copy of each record.  Copies are matched by recordId
+// when they have one, so a record whose systemTime was corrected replaces the earlier copy, and by systemTime
+// otherwise.  When two copies match, one with a recordId wins over one without, and otherwise the one from the later
+// response wins, so responses should be passed oldest fetch first.  The merged records are sorted by systemTime and the
+// records that were replaced are returned.
+func MergeEGVs(responses ...*EGVResponse) (*EGVResponse, []EGV, glitch.DataError) {
+	result := new(EGVResponse)
+	m := newMerger(func(egv EGV) string { return egv.RecordID }, egvKey, nil)
+	for _, resp := range responses {
+		if resp == nil {
+			continue
+		}
+		if err := mergeUnit(&result.Unit, resp.Unit); err != nil {
+			return nil, nil, err
+		}
+		if err := mergeUnit(&result.RateUnit, resp.RateUnit); err != nil {
+			return nil, nil, err
+		}
+		for _, egv := range resp.EGVs {
+			m.add(egv)
+		}
+	}
+
+	result.EGVs = m.merged()
+	sort.SliceStable(result.EGVs, func(i, j int) bool {
+		return compareTimes(result.EGVs[i].SystemTime, result.EGVs[j].SystemTime) < 0
+	})
+	return result, m.dropped, nil
+}
+
+// MergeEvents combines several event responses into one like MergeEGVs.  Events without a recordId are matched by
+// systemTime, eventType and eventSubType, since different kinds of events can be logged at the same time.  Copies of an
+// event in different units are an error.
+func MergeEvents(responses ...*EventResponse) (*EventResponse, []Event, glitch.DataError) {
+	result := new(EventResponse)
+	m := newMerger(func(event Event) string { return event.RecordID }, eventKey, func(existing, event Event) glitch.DataError {
+		unit := existing.Unit
+		return mergeUnit(&unit, event.Unit)
+	})
+	for _, resp := range responses {
+		if resp == nil {
+			continue
+		}
+		for _, event := range resp.Events {
+			if err := m.add(event); err != nil {
+				return nil, nil, err
+			}
+		}
+	}
+
+	result.Events = m.merged()
+	sort.SliceStable(result.Events, func(i, j int) bool {
+		if c := compareTimes(result.Events[i].SystemTime, result.Events[j].SystemTime); c != 0 {
+			return c < 0
+		}
+		return eventKey(result.Events[i]) < eventKey(result.Events[j])
+	})
+	return result, m.dropped, nil
+}
+
+// merger keeps one copy of each record, indexed by record id and by key
+type merger[T any] struct {
+	records  []T
+	removed  []bool
+	dropped  []T
+	byID     map[string]int
+	byKey    map[string]int
+	recordID func(T) string
+	key      func(T) string
+	// check, if set, fails the merge of two copies of a record
+	check func(existing, next T) glitch.DataError
+}
+
+func newMerger[T any](recordID, key func(T) string, check func(existing, next T) glitch.DataError) *merger[T] {
+	return &merger[T]{byID: make(map[string]int), byKey: make(map[string]int), recordID: recordID, key: key, check: check}
+}
+
+func (m *merger[T]) add(r T) glitch.DataError {
+	id, key := m.recordID(r), m.key(r)
+	i, ok := m.byID[id]
+	if id == "" || !ok {
+		i, ok = m.byKey[key]
+	}
+	if !ok {
+		m.set(len(m.records), r)
+		return nil
+	}
+
+	existing := m.records[i]
+	if m.check != nil {
+		if err := m.check(existing, r); err != nil {
+			return err
+		}
+	}
+	if m.recordID(existing) != "" && id == "" {
+		m.dropped = append(m.dropped, r)
+		return nil
+	}
+	m.dropped = append(m.dropped, existing)
+	if m.byKey[m.key(existing)] == i {
+		delete(m.byKey, m.key(existing))
+	}
+	if existingID := m.recordID(existing); existingID != id {
+		delete(m.byID, existingID)
+	}
+	// a record whose time was corrected can land on another record's key, which it replaces too
+	if j, ok := m.byKey[key]; ok && j != i {
+		m.dropped = append(m.dropped, m.records[j])
+		m.removed[j] = true
+		delete(m.byID, m.recordID(m.records[j]))
+	}
+	m.set(i, r)
+	return nil
+}
+
+func (m *merger[T]) set(i int, r T) {
+	if i == len(m.records) {
+		m.records = append(m.records, r)
+		m.removed = append(m.removed, false)
+	}
+	m.records[i] = r
+	m.byKey[m.key(r)] = i
+	if id := m.recordID(r); id != "" {
+		m.byID[id] = i
+	}
+}
+
+// merged returns the records that were kept, in the order they were first added
+func (m *merger[T]) merged() []T {
+	var ret []T
+	for i, r := range m.records {
+		if !m.removed[i] {
+			ret = append(ret, r)
+		}
+	}
+	return ret
+}
+
+func egvKey(egv EGV) string {
+	return normalizeTime(egv.SystemTime)
+}
+
+func eventKey(event Event) string {
+	return fmt.Sprintf("%s|%s|%s", normalizeTime(event.SystemTime), event.EventType, event.EventSubType)
+}
+
+// normalizeTime makes equal instants written in different layouts produce the same key
+func normalizeTime(value string) string {
+	t, err := ParseTime(value)
+	if err != nil {
+		return value
+	}
+	return FormatTime(t)
+}
+
+func mergeUnit(dst *string, unit string) glitch.DataError {
+	if unit == "" {
+		return nil
+	}
+	if *dst != "" && *dst != unit {
+		return glitch.NewDataError(fmt.Errorf("%s != %s", *dst, unit), ErrorUnitMismatch, "Cannot merge responses with different units")
+	}
+	*dst = unit
+	return nil
+}
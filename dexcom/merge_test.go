@@ -0,0 +1,160 @@
+package dexcom
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestUnit_MergeEGVs(t *testing.T) {
+
+	type testcase struct {
+		name             string
+		responses        []*EGVResponse
+		expectedErrCode  string
+		expectedResponse *EGVResponse
+		expectedDropped  []EGV
+	}
+
+	testcases := []testcase{
+		{
+			name: "base path",
+			responses: []*EGVResponse{
+				&EGVResponse{Unit: "mg/dL", RateUnit: "mg/dL/min", EGVs: []EGV{EGV{SystemTime: "2017-06-16T15:45:00", Value: 120}, EGV{SystemTime: "2017-06-16T15:40:00", Value: 119}}},
+				&EGVResponse{Unit: "mg/dL", RateUnit: "mg/dL/min", EGVs: []EGV{EGV{SystemTime: "2017-06-16T15:45:00", Value: 121}, EGV{SystemTime: "2017-06-16T15:50:00", Value: 122}}},
+			},
+			expectedResponse: &EGVResponse{Unit: "mg/dL", RateUnit: "mg/dL/min", EGVs: []EGV{EGV{SystemTime: "2017-06-16T15:40:00", Value: 119}, EGV{SystemTime: "2017-06-16T15:45:00", Value: 121}, EGV{SystemTime: "2017-06-16T15:50:00", Value: 122}}},
+			expectedDropped:  []EGV{EGV{SystemTime: "2017-06-16T15:45:00", Value: 120}},
+		},
+		{
+			name: "record id wins",
+			responses: []*EGVResponse{
+				&EGVResponse{EGVs: []EGV{EGV{RecordID: "a", SystemTime: "2017-06-16T15:45:00", Value: 120}}},
+				nil,
+				&EGVResponse{EGVs: []EGV{EGV{SystemTime: "2017-06-16T15:45:00Z", Value: 121}, EGV{SystemTime: "2017-06-16T15:50:00", Value: 130}}},
+				&EGVResponse{EGVs: []EGV{EGV{RecordID: "b", SystemTime: "2017-06-16T15:50:00", Value: 131}}},
+			},
+			expectedResponse: &EGVResponse{EGVs: []EGV{EGV{RecordID: "a", SystemTime: "2017-06-16T15:45:00", Value: 120}, EGV{RecordID: "b", SystemTime: "2017-06-16T15:50:00", Value: 131}}},
+			expectedDropped:  []EGV{EGV{SystemTime: "2017-06-16T15:45:00Z", Value: 121}, EGV{SystemTime: "2017-06-16T15:50:00", Value: 130}},
+		},
+		{
+			name: "corrected time",
+			responses: []*EGVResponse{
+				&EGVResponse{EGVs: []EGV{EGV{RecordID: "a", SystemTime: "2017-06-16T15:45:00", Value: 120}, EGV{SystemTime: "2017-06-16T15:50:00", Value: 125}}},
+				&EGVResponse{EGVs: []EGV{EGV{RecordID: "a", SystemTime: "2017-06-16T15:50:00", Value: 121}}},
+			},
+			expectedResponse: &EGVResponse{EGVs: []EGV{EGV{RecordID: "a", SystemTime: "2017-06-16T15:50:00", Value: 121}}},
+			expectedDropped:  []EGV{EGV{RecordID: "a", SystemTime: "2017-06-16T15:45:00", Value: 120}, EGV{SystemTime: "2017-06-16T15:50:00", Value: 125}},
+		},
+		{
+			name: "exceptional path - unit mismatch",
+			responses: []*EGVResponse{
+				&EGVResponse{Unit: "mg/dL"},
+				&EGVResponse{Unit: "mmol/L"},
+			},
+			expectedErrCode: ErrorUnitMismatch,
+		},
+	}
+
+	for _, tc := range testcases {
+		t.Run(tc.name, func(t *testing.T) {
+			ret, dropped, err := MergeEGVs(tc.responses...)
+			if tc.expectedErrCode != "" || err != nil {
+				if tc.expectedErrCode == "" {
+					t.Fatalf("Unexpected error occurred (%#v)", err)
+				}
+				if err == nil {
+					t.Fatalf("Expected error did not occur")
+				}
+				if err.Code() != tc.expectedErrCode {
+					t.Fatalf("Actual error (%#v) did not match expected (%#v)", err.Code(), tc.expectedErrCode)
+				}
+			}
+			if !reflect.DeepEqual(tc.expectedResponse, ret) {
+				t.Fatalf("Actual response (%#v) did not match expected (%#v)", ret, tc.expectedResponse)
+			}
+			if !reflect.DeepEqual(tc.expectedDropped, dropped) {
+				t.Fatalf("Actual dropped (%#v) did not match expected (%#v)", dropped, tc.expectedDropped)
+			}
+		})
+	}
+}
+
+func TestUnit_MergeEvents(t *testing.T) {
+
+	type testcase struct {
+		name             string
+		responses        []*EventResponse
+		expectedErrCode  string
+		expectedResponse *EventResponse
+		expectedDropped  []Event
+	}
+
+	testcases := []testcase{
+		{
+			name: "base path",
+			responses: []*EventResponse{
+				&EventResponse{Events: []Event{Event{SystemTime: "2017-06-16T19:45:00", EventType: "carbs", Value: 40}, Event{SystemTime: "2017-06-16T19:45:00", EventType: "insulin", EventSubType: "fastActing", Value: 4}}},
+				&EventResponse{Events: []Event{Event{SystemTime: "2017-06-16T19:45:00", EventType: "carbs", Value: 45}, Event{SystemTime: "2017-06-16T18:00:00", EventType: "exercise", EventSubType: "light", Value: 30}}},
+			},
+			expectedResponse: &EventResponse{Events: []Event{
+				Event{SystemTime: "2017-06-16T18:00:00", EventType: "exercise", EventSubType: "light", Value: 30},
+				Event{SystemTime: "2017-06-16T19:45:00", EventType: "carbs", Value: 45},
+				Event{SystemTime: "2017-06-16T19:45:00", EventType: "insulin", EventSubType: "fastActing", Value: 4},
+			}},
+			expectedDropped: []Event{Event{SystemTime: "2017-06-16T19:45:00", EventType: "carbs", Value: 40}},
+		},
+		{
+			name: "record id wins",
+			responses: []*EventResponse{
+				&EventResponse{Events: []Event{Event{RecordID: "a", SystemTime: "2017-06-16T19:45:00", EventType: "carbs", Value: 40, Unit: "grams"}}},
+				&EventResponse{Events: []Event{Event{SystemTime: "2017-06-16T19:45:00", EventType: "carbs", Value: 45, Unit: "grams"}}},
+			},
+			expectedResponse: &EventResponse{Events: []Event{Event{RecordID: "a", SystemTime: "2017-06-16T19:45:00", EventType: "carbs", Value: 40, Unit: "grams"}}},
+			expectedDropped:  []Event{Event{SystemTime: "2017-06-16T19:45:00", EventType: "carbs", Value: 45, Unit: "grams"}},
+		},
+		{
+			name: "corrected event",
+			responses: []*EventResponse{
+				&EventResponse{Events: []Event{Event{RecordID: "a", SystemTime: "2017-06-16T19:45:00", EventType: "carbs", Value: 40, Unit: "grams"}}},
+				&EventResponse{Events: []Event{Event{RecordID: "a", SystemTime: "2017-06-16T19:30:00", EventType: "carbs", Value: 40, Unit: "grams"}}},
+			},
+			expectedResponse: &EventResponse{Events: []Event{Event{RecordID: "a", SystemTime: "2017-06-16T19:30:00", EventType: "carbs", Value: 40, Unit: "grams"}}},
+			expectedDropped:  []Event{Event{RecordID: "a", SystemTime: "2017-06-16T19:45:00", EventType: "carbs", Value: 40, Unit: "grams"}},
+		},
+		{
+			name:             "empty",
+			expectedResponse: &EventResponse{},
+		},
+		{
+			name: "exceptional path - unit mismatch",
+			responses: []*EventResponse{
+				&EventResponse{Events: []Event{Event{SystemTime: "2017-06-16T19:45:00", EventType: "insulin", Value: 4, Unit: "units"}}},
+				&EventResponse{Events: []Event{Event{SystemTime: "2017-06-16T19:45:00", EventType: "insulin", Value: 4, Unit: "mL"}}},
+			},
+			expectedErrCode: ErrorUnitMismatch,
+		},
+	}
+
+	for _, tc := range testcases {
+		t.Run(tc.name, func(t *testing.T) {
+			ret, dropped, err := MergeEvents(tc.responses...)
+			if tc.expectedErrCode != "" || err != nil {
+				if tc.expectedErrCode == "" {
+					t.Fatalf("Unexpected error occurred (%#v)", err)
+				}
+				if err == nil {
+					t.Fatalf("Expected error did not occur")
+				}
+				if err.Code() != tc.expectedErrCode {
+					t.Fatalf("Actual error (%#v) did not match expected (%#v)", err.Code(), tc.expectedErrCode)
+				}
+			}
+			if !reflect.DeepEqual(tc.expectedResponse, ret) {
+				t.Fatalf("Actual response (%#v) did not match expected (%#v)", ret, tc.expectedResponse)
+			}
+			if !reflect.DeepEqual(tc.expectedDropped, dropped) {
+				t.Fatalf("Actual dropped (%#v) did not match expected (%#v)", dropped, tc.expectedDropped)
+			}
+		})
+	}
+}
@@ -0,0 +1,60 @@
+package dexcom
+
+import (
+	"context"
+	"time"
+)
+
+// Endpoints reported to Metrics, named after the Client methods that call them
+const (
+	EndpointGetUser         = "GetUser"
+	EndpointRefreshUser     = "RefreshUser"
+	EndpointGetDevices      = "GetDevices"
+	EndpointGetEGVs         = "GetEGVs"
+	EndpointGetEvents       = "GetEvents"
+	EndpointGetCalibrations = "GetCalibrations"
+	EndpointGetStatistics   = "GetStatistics"
+)
+
+// OperationSync is reported to ObserveRetry when a whole sync is repeated, since it spans several endpoints
+const OperationSync = "Sync"
+
+// Metrics collects measurements of how clients behave, e.g. for Prometheus.  Implementations must be safe for
+// concurrent use.
+type Metrics interface {
+	// ObserveRequest records one api request.  status is 0 when no response was received.
+	ObserveRequest(endpoint string, status int, latency time.Duration)
+	// ObserveTokenRefresh records a RefreshUser call
+	ObserveTokenRefresh(ok bool)
+	// ObserveRetry records a request, or with OperationSync a sync, being retried, e.g. with a refreshed token after the
+	// api rejected the access token
+	ObserveRetry(endpoint string)
+	// ObserveRateLimitWait records time a rate limited client spent waiting before a request
+	ObserveRateLimitWait(endpoint string, wait time.Duration)
+	// ObserveCacheLookup records a lookup by a caching client, once per day for egvs, events and calibrations
+	ObserveCacheLookup(endpoint string, hit bool)
+}
+
+// WithMetrics returns a context that reports the requests made with it to m.  Metrics are carried by the context,
+// like the user id, so they reach every layer of wrapped clients, syncers and schedulers.
+func WithMetrics(ctx context.Context, m Metrics) context.Context {
+	return context.WithValue(ctx, contextKeyMetrics, m)
+}
+
+// MetricsFromContext returns the metrics set by WithMetrics, or metrics that discard everything
+func MetricsFromContext(ctx context.Context) Metrics {
+	if ctx != nil {
+		if m, ok := ctx.Value(contextKeyMetrics).(Metrics); ok && m != nil {
+			return m
+		}
+	}
+	return noopMetrics{}
+}
+
+type noopMetrics struct{}
+
+func (noopMetrics) ObserveRequest(endpoint string, status int, latency time.Duration) {}
+func (noopMetrics) ObserveTokenRefresh(ok bool)                                       {}
+func (noopMetrics) ObserveRetry(endpoint string)                                      {}
+func (noopMetrics) ObserveRateLimitWait(endpoint string, wait time.Duration)          {}
+func (noopMetrics) ObserveCacheLookup(endpoint string, hit bool)                      {}
@@ -0,0 +1,213 @@
+// Package metrics collects dexcom.Metrics in memory and exposes them in the Prometheus text format, for services that
+// don't already use a Prometheus client library.  Those that do can implement dexcom.Metrics on their own registry.
+package metrics
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/healthimation/go-dexcom/dexcom"
+)
+
+// DefaultBuckets are the upper bounds in seconds of the request latency histogram
+var DefaultBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+
+type histogram struct {
+	counts []int64
+	count  int64
+	sum    float64
+}
+
+func (h *histogram) observe(buckets []float64, v float64) {
+	if h.counts == nil {
+		h.counts = make([]int64, len(buckets))
+	}
+	for i, b := range buckets {
+		if v <= b {
+			h.counts[i]++
+		}
+	}
+	h.count++
+	h.sum += v
+}
+
+// Prometheus is a dexcom.Metrics that serves what it has collected on ServeHTTP, e.g. at /metrics
+type Prometheus struct {
+	namespace string
+	buckets   []float64
+
+	mu        sync.Mutex
+	requests  map[[2]string]int64
+	latency   map[string]*histogram
+	refreshes map[string]int64
+	retries   map[string]int64
+	waits     map[string]*histogram
+	cache     map[[2]string]int64
+}
+
+// NewPrometheus returns collected metrics named <namespace>_..., e.g. dexcom_requests_total
+func NewPrometheus(namespace string) *Prometheus {
+	return &Prometheus{
+		namespace: namespace,
+		buckets:   DefaultBuckets,
+		requests:  make(map[[2]string]int64),
+		latency:   make(map[string]*histogram),
+		refreshes: map[string]int64{"success": 0, "failure": 0},
+		retries:   make(map[string]int64),
+		waits:     make(map[string]*histogram),
+		cache:     make(map[[2]string]int64),
+	}
+}
+
+func (p *Prometheus) ObserveRequest(endpoint string, status int, latency time.Duration) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.requests[[2]string{endpoint, strconv.Itoa(status)}]++
+	h, ok := p.latency[endpoint]
+	if !ok {
+		h = &histogram{}
+		p.latency[endpoint] = h
+	}
+	h.observe(p.buckets, latency.Seconds())
+}
+
+func (p *Prometheus) ObserveTokenRefresh(ok bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if ok {
+		p.refreshes["success"]++
+	} else {
+		p.refreshes["failure"]++
+	}
+}
+
+func (p *Prometheus) ObserveRetry(endpoint string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.retries[endpoint]++
+}
+
+func (p *Prometheus) ObserveRateLimitWait(endpoint string, wait time.Duration) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	h, ok := p.waits[endpoint]
+	if !ok {
+		h = &histogram{}
+		p.waits[endpoint] = h
+	}
+	// only the count and sum are exposed
+	h.count++
+	h.sum += wait.Seconds()
+}
+
+func (p *Prometheus) ObserveCacheLookup(endpoint string, hit bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	result := "miss"
+	if hit {
+		result = "hit"
+	}
+	p.cache[[2]string{endpoint, result}]++
+}
+
+func (p *Prometheus) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+	p.WriteTo(w)
+}
+
+// WriteTo writes every metric in the Prometheus text format
+func (p *Prometheus) WriteTo(w io.Writer) (int64, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	out := &countingWriter{w: bufio.NewWriter(w)}
+
+	name := p.namespace + "_requests_total"
+	header(out, name, "counter", "Dexcom api requests by endpoint and http status, 0 when there was no response.")
+	for _, k := range sortedKeys(p.requests) {
+		fmt.Fprintf(out, "%s{endpoint=%q,code=%q} %d\n", name, k[0], k[1], p.requests[k])
+	}
+
+	name = p.namespace + "_request_duration_seconds"
+	header(out, name, "histogram", "Dexcom api request latency by endpoint.")
+	for _, endpoint := range sortedKeys(p.latency) {
+		h := p.latency[endpoint]
+		for i, b := range p.buckets {
+			fmt.Fprintf(out, "%s_bucket{endpoint=%q,le=%q} %d\n", name, endpoint, strconv.FormatFloat(b, 'g', -1, 64), h.counts[i])
+		}
+		fmt.Fprintf(out, "%s_bucket{endpoint=%q,le=\"+Inf\"} %d\n", name, endpoint, h.count)
+		fmt.Fprintf(out, "%s_sum{endpoint=%q} %g\n%s_count{endpoint=%q} %d\n", name, endpoint, h.sum, name, endpoint, h.count)
+	}
+
+	name = p.namespace + "_token_refreshes_total"
+	header(out, name, "counter", "Token refreshes by result.")
+	for _, result := range sortedKeys(p.refreshes) {
+		fmt.Fprintf(out, "%s{result=%q} %d\n", name, result, p.refreshes[result])
+	}
+
+	name = p.namespace + "_retries_total"
+	header(out, name, "counter", "Requests retried by endpoint.")
+	for _, endpoint := range sortedKeys(p.retries) {
+		fmt.Fprintf(out, "%s{endpoint=%q} %d\n", name, endpoint, p.retries[endpoint])
+	}
+
+	name = p.namespace + "_rate_limit_wait_seconds"
+	header(out, name, "summary", "Time spent waiting on the rate limiter by endpoint.")
+	for _, endpoint := range sortedKeys(p.waits) {
+		h := p.waits[endpoint]
+		fmt.Fprintf(out, "%s_sum{endpoint=%q} %g\n%s_count{endpoint=%q} %d\n", name, endpoint, h.sum, name, endpoint, h.count)
+	}
+
+	name = p.namespace + "_cache_lookups_total"
+	header(out, name, "counter", "Cache lookups by endpoint and result.")
+	for _, k := range sortedKeys(p.cache) {
+		fmt.Fprintf(out, "%s{endpoint=%q,result=%q} %d\n", name, k[0], k[1], p.cache[k])
+	}
+
+	if err := out.w.Flush(); err != nil {
+		return out.n, err
+	}
+	return out.n, nil
+}
+
+func header(w io.Writer, name, metricType, help string) {
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, metricType)
+}
+
+type countingWriter struct {
+	w *bufio.Writer
+	n int64
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.n += int64(n)
+	return n, err
+}
+
+func sortedKeys[K string | [2]string, V any](m map[K]V) []K {
+	ret := make([]K, 0, len(m))
+	for k := range m {
+		ret = append(ret, k)
+	}
+	sort.Slice(ret, func(i, j int) bool { return key(ret[i]) < key(ret[j]) })
+	return ret
+}
+
+func key[K string | [2]string](k K) string {
+	switch v := any(k).(type) {
+	case [2]string:
+		return strings.Join(v[:], "\x00")
+	case string:
+		return v
+	}
+	return ""
+}
+
+var _ dexcom.Metrics = (*Prometheus)(nil)
@@ -0,0 +1,55 @@
+package metrics
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/healthimation/go-dexcom/dexcom"
+)
+
+func TestUnit_Prometheus(t *testing.T) {
+	p := NewPrometheus("dexcom")
+	p.ObserveRequest(dexcom.EndpointGetEGVs, 200, 30*time.Millisecond)
+	p.ObserveRequest(dexcom.EndpointGetEGVs, 200, 2*time.Second)
+	p.ObserveRequest(dexcom.EndpointGetEGVs, 429, time.Millisecond)
+	p.ObserveTokenRefresh(true)
+	p.ObserveTokenRefresh(false)
+	p.ObserveRetry(dexcom.EndpointGetEGVs)
+	p.ObserveRateLimitWait(dexcom.EndpointGetEvents, 1500*time.Millisecond)
+	p.ObserveCacheLookup(dexcom.EndpointGetEGVs, true)
+	p.ObserveCacheLookup(dexcom.EndpointGetEGVs, false)
+
+	w := httptest.NewRecorder()
+	p.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	body := w.Body.String()
+
+	expected := []string{
+		"# TYPE dexcom_requests_total counter",
+		`dexcom_requests_total{endpoint="GetEGVs",code="200"} 2`,
+		`dexcom_requests_total{endpoint="GetEGVs",code="429"} 1`,
+		"# TYPE dexcom_request_duration_seconds histogram",
+		`dexcom_request_duration_seconds_bucket{endpoint="GetEGVs",le="0.005"} 1`,
+		`dexcom_request_duration_seconds_bucket{endpoint="GetEGVs",le="0.05"} 2`,
+		`dexcom_request_duration_seconds_bucket{endpoint="GetEGVs",le="2.5"} 3`,
+		`dexcom_request_duration_seconds_bucket{endpoint="GetEGVs",le="+Inf"} 3`,
+		`dexcom_request_duration_seconds_count{endpoint="GetEGVs"} 3`,
+		`dexcom_token_refreshes_total{result="failure"} 1`,
+		`dexcom_token_refreshes_total{result="success"} 1`,
+		`dexcom_retries_total{endpoint="GetEGVs"} 1`,
+		`dexcom_rate_limit_wait_seconds_sum{endpoint="GetEvents"} 1.5`,
+		`dexcom_rate_limit_wait_seconds_count{endpoint="GetEvents"} 1`,
+		`dexcom_cache_lookups_total{endpoint="GetEGVs",result="hit"} 1`,
+		`dexcom_cache_lookups_total{endpoint="GetEGVs",result="miss"} 1`,
+	}
+	for _, line := range expected {
+		if !strings.Contains(body, line+"\n") {
+			t.Fatalf("Actual metrics did not contain (%s) | %s", line, body)
+		}
+	}
+	if ct := w.Header().Get("Content-Type"); !strings.HasPrefix(ct, "text/plain") {
+		t.Fatalf("Actual content type (%s) did not match expected (text/plain)", ct)
+	}
+}
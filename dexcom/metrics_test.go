@@ -0,0 +1,114 @@
+package dexcom
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// testMetrics records observations as strings
+type testMetrics struct {
+	mu           sync.Mutex
+	observations []string
+}
+
+func (m *testMetrics) add(format string, args ...interface{}) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.observations = append(m.observations, fmt.Sprintf(format, args...))
+}
+
+// count returns how many times observation was recorded
+func (m *testMetrics) count(observation string) int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	n := 0
+	for _, o := range m.observations {
+		if o == observation {
+			n++
+		}
+	}
+	return n
+}
+
+func (m *testMetrics) ObserveRequest(endpoint string, status int, latency time.Duration) {
+	m.add("request %s %d", endpoint, status)
+}
+
+func (m *testMetrics) ObserveTokenRefresh(ok bool) {
+	m.add("refresh %t", ok)
+}
+
+func (m *testMetrics) ObserveRetry(endpoint string) {
+	m.add("retry %s", endpoint)
+}
+
+func (m *testMetrics) ObserveRateLimitWait(endpoint string, wait time.Duration) {
+	m.add("wait %s", endpoint)
+}
+
+func (m *testMetrics) ObserveCacheLookup(endpoint string, hit bool) {
+	m.add("cache %s %t", endpoint, hit)
+}
+
+func TestUnit_Metrics(t *testing.T) {
+	c, ts := testClient(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasSuffix(r.URL.Path, "token") {
+			w.WriteHeader(http.StatusBadRequest)
+			fmt.Fprint(w, `{"error": "invalid_grant"}`)
+			return
+		}
+		fmt.Fprint(w, `{"unit": "mg/dL", "egvs": [], "devices": []}`)
+	}), 5*time.Second)
+	defer ts.Close()
+	cc := NewCachingClient(c, NewLRUCache(100), DefaultCacheTTLs()).(*cachingClient)
+	cc.now = func() time.Time { return time.Date(2017, 6, 18, 0, 0, 0, 0, time.UTC) }
+	start := time.Date(2017, 6, 16, 0, 0, 0, 0, time.UTC)
+
+	type testcase struct {
+		name     string
+		call     func(ctx context.Context)
+		expected []string
+	}
+
+	testcases := []testcase{
+		{
+			name:     "request",
+			call:     func(ctx context.Context) { c.GetDevices(ctx, "token", start, start.Add(time.Hour)) },
+			expected: []string{"request GetDevices 200"},
+		},
+		{
+			name:     "failed refresh",
+			call:     func(ctx context.Context) { c.RefreshUser(ctx, "refresh", "uri") },
+			expected: []string{"request RefreshUser 400", "refresh false"},
+		},
+		{
+			name:     "cache miss",
+			call:     func(ctx context.Context) { cc.GetEGVs(ctx, "token", start, start.Add(24*time.Hour)) },
+			expected: []string{"cache GetEGVs false", "request GetEGVs 200"},
+		},
+		{
+			name:     "cache hit",
+			call:     func(ctx context.Context) { cc.GetEGVs(ctx, "token", start, start.Add(24*time.Hour)) },
+			expected: []string{"cache GetEGVs true"},
+		},
+	}
+
+	for _, test := range testcases {
+		m := &testMetrics{}
+		test.call(WithMetrics(context.Background(), m))
+		if !reflect.DeepEqual(m.observations, test.expected) {
+			t.Fatalf("[%s] Actual observations (%v) did not match expected (%v)", test.name, m.observations, test.expected)
+		}
+	}
+
+	// without metrics in the context nothing is recorded and nothing breaks
+	if _, err := c.GetDevices(context.Background(), "token", start, start.Add(time.Hour)); err != nil {
+		t.Fatalf("Unexpected error occurred (%#v)", err)
+	}
+}
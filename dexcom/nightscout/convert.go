@@ -0,0 +1,212 @@
+// Package nightscout converts dexcom data to Nightscout entries and treatments and uploads them to a Nightscout site.
+package nightscout
+
+import (
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/healthimation/go-dexcom/dexcom"
+	"github.com/healthimation/go-glitch/glitch"
+)
+
+// Nightscout entry types
+const (
+	TypeSGV = "sgv"
+	TypeMBG = "mbg"
+)
+
+// Nightscout treatment event types
+const (
+	EventTypeCarbs    = "Carb Correction"
+	EventTypeBolus    = "Bolus"
+	EventTypeExercise = "Exercise"
+	EventTypeNote     = "Note"
+)
+
+// dexcom insulin event subtypes
+const (
+	insulinFastActing = "fastActing"
+	insulinLongActing = "longActing"
+)
+
+// DefaultDevice is the device entries are attributed to when none is given
+const DefaultDevice = "go-dexcom"
+
+// directions maps dexcom trends to nightscout directions, the index is the nightscout trend number
+var directions = []struct {
+	trend     string
+	direction string
+}{
+	{dexcom.TrendNone, "NONE"},
+	{dexcom.TrendDoubleUp, "DoubleUp"},
+	{dexcom.TrendSingleUp, "SingleUp"},
+	{dexcom.TrendFortyFiveUp, "FortyFiveUp"},
+	{dexcom.TrendFlat, "Flat"},
+	{dexcom.TrendFortyFiveDown, "FortyFiveDown"},
+	{dexcom.TrendSingleDown, "SingleDown"},
+	{dexcom.TrendDoubleDown, "DoubleDown"},
+	{dexcom.TrendNotComputable, "NOT COMPUTABLE"},
+	{dexcom.TrendRateOutOfRange, "RATE OUT OF RANGE"},
+}
+
+// Entry is a nightscout entry, a sensor or meter glucose reading in mg/dL
+type Entry struct {
+	Type       string `json:"type"`
+	SGV        int    `json:"sgv,omitempty"`
+	MBG        int    `json:"mbg,omitempty"`
+	Direction  string `json:"direction,omitempty"`
+	Trend      int    `json:"trend,omitempty"`
+	Date       int64  `json:"date"`
+	DateString string `json:"dateString"`
+	SysTime    string `json:"sysTime"`
+	// UTCOffset is the offset of the device clock from UTC in minutes
+	UTCOffset int    `json:"utcOffset"`
+	Device    string `json:"device"`
+	// Identifier is derived from the dexcom record, so uploading the record again replaces the earlier copy
+	Identifier string `json:"identifier,omitempty"`
+}
+
+// Treatment is a nightscout treatment
+type Treatment struct {
+	EventType string  `json:"eventType"`
+	CreatedAt string  `json:"created_at"`
+	Carbs     float64 `json:"carbs,omitempty"`
+	Insulin   float64 `json:"insulin,omitempty"`
+	// Duration is in minutes
+	Duration  float64 `json:"duration,omitempty"`
+	Notes     string  `json:"notes,omitempty"`
+	UTCOffset int     `json:"utcOffset"`
+	EnteredBy string  `json:"enteredBy,omitempty"`
+	// Identifier is derived from the dexcom record, so uploading the record again replaces the earlier copy
+	Identifier string `json:"identifier,omitempty"`
+}
+
+// Direction returns the nightscout direction and trend number for a dexcom trend
+func Direction(trend string) (string, int) {
+	for i, d := range directions {
+		if d.trend == trend {
+			return d.direction, i
+		}
+	}
+	return "", 0
+}
+
+// Entries converts egvs in unit to sgv entries.  Nightscout stores glucose in mg/dL so mmol/L values are converted.
+func Entries(egvs []dexcom.EGV, unit, device string) ([]Entry, glitch.DataError) {
+	ret := make([]Entry, 0, len(egvs))
+	for _, e := range egvs {
+		entry, err := entry(e.SystemTime, e.DisplayTime, device)
+		if err != nil {
+			return nil, err
+		}
+		entry.Type = TypeSGV
+		entry.Identifier = identifier(TypeSGV, e.RecordID, e.SystemTime)
+		entry.SGV = mgdl(e.Value, unit)
+		if e.Trend != nil {
+			entry.Direction, entry.Trend = Direction(*e.Trend)
+		}
+		ret = append(ret, entry)
+	}
+	return ret, nil
+}
+
+// CalibrationEntries converts meter calibrations to mbg entries
+func CalibrationEntries(calibrations []dexcom.Calibration, device string) ([]Entry, glitch.DataError) {
+	ret := make([]Entry, 0, len(calibrations))
+	for _, c := range calibrations {
+		entry, err := entry(c.SystemTime, c.DisplayTime, device)
+		if err != nil {
+			return nil, err
+		}
+		entry.Type = TypeMBG
+		entry.Identifier = identifier(TypeMBG, c.RecordID, c.SystemTime)
+		entry.MBG = mgdl(c.Value, c.Unit)
+		ret = append(ret, entry)
+	}
+	return ret, nil
+}
+
+// Treatments converts carbs, insulin and exercise events to treatments.  Fast-acting insulin becomes a bolus.
+// Long-acting insulin becomes a note, since nightscout would count its insulin as a bolus.  Health events also become
+// notes.
+func Treatments(events []dexcom.Event, enteredBy string) ([]Treatment, glitch.DataError) {
+	ret := make([]Treatment, 0, len(events))
+	for _, e := range events {
+		t, err := dexcom.ParseTime(e.SystemTime)
+		if err != nil {
+			return nil, err
+		}
+		treatment := Treatment{
+			CreatedAt: t.UTC().Format(time.RFC3339),
+			UTCOffset: utcOffset(t, e.DisplayTime),
+			EnteredBy: enteredBy,
+			// the subtype is part of the fallback so a carbs and an insulin event at the same time stay apart
+			Identifier: identifier("treatment", e.RecordID, e.SystemTime+"|"+e.EventType+"|"+e.EventSubType),
+		}
+		switch e.EventType {
+		case "carbs":
+			treatment.EventType = EventTypeCarbs
+			treatment.Carbs = e.Value
+		case "insulin":
+			if e.EventSubType == insulinLongActing {
+				treatment.EventType = EventTypeNote
+				treatment.Notes = fmt.Sprintf("Long-acting insulin %g %s", e.Value, e.Unit)
+				break
+			}
+			treatment.EventType = EventTypeBolus
+			treatment.Insulin = e.Value
+			if e.EventSubType == insulinFastActing {
+				treatment.Notes = "Fast-acting insulin"
+			}
+		case "exercise":
+			treatment.EventType = EventTypeExercise
+			treatment.Duration = e.Value
+			treatment.Notes = e.EventSubType
+		default:
+			treatment.EventType = EventTypeNote
+			treatment.Notes = e.EventSubType
+		}
+		ret = append(ret, treatment)
+	}
+	return ret, nil
+}
+
+// identifier returns a uuid shaped id for a record of kind, from its record id or, for records without one, its key
+func identifier(kind, recordID, key string) string {
+	return dexcom.RecordUUID("dexcom", kind, dexcom.RecordKey(recordID, key))
+}
+
+func entry(systemTime, displayTime, device string) (Entry, glitch.DataError) {
+	t, err := dexcom.ParseTime(systemTime)
+	if err != nil {
+		return Entry{}, err
+	}
+	if device == "" {
+		device = DefaultDevice
+	}
+	return Entry{
+		Date:       t.UnixMilli(),
+		DateString: t.UTC().Format(time.RFC3339),
+		SysTime:    t.UTC().Format(time.RFC3339),
+		UTCOffset:  utcOffset(t, displayTime),
+		Device:     device,
+	}, nil
+}
+
+// utcOffset returns the difference between the display and system time in minutes, rounded to the nearest quarter hour
+// since device clocks drift
+func utcOffset(systemTime time.Time, displayTime string) int {
+	display, err := dexcom.ParseTime(displayTime)
+	if err != nil {
+		return 0
+	}
+	return int(display.Sub(systemTime).Round(15*time.Minute) / time.Minute)
+}
+
+func mgdl(value float64, unit string) int {
+	if unit == "" {
+		unit = dexcom.UnitMgDL
+	}
+	return int(math.Round(dexcom.ConvertGlucose(value, unit, dexcom.UnitMgDL)))
+}
@@ -0,0 +1,175 @@
+package nightscout
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/healthimation/go-dexcom/dexcom"
+)
+
+func TestUnit_Entries(t *testing.T) {
+	flat := dexcom.TrendFlat
+	down := dexcom.TrendSingleDown
+
+	type testcase struct {
+		name            string
+		egvs            []dexcom.EGV
+		unit            string
+		expectedErrCode string
+		expected        []Entry
+	}
+
+	testcases := []testcase{
+		{
+			name: "base path",
+			egvs: []dexcom.EGV{dexcom.EGV{SystemTime: "2017-06-16T15:40:00", DisplayTime: "2017-06-16T08:40:00", Value: 119, Trend: &flat}},
+			unit: "mg/dL",
+			expected: []Entry{
+				Entry{Type: TypeSGV, SGV: 119, Direction: "Flat", Trend: 4, Date: 1497627600000, DateString: "2017-06-16T15:40:00Z", SysTime: "2017-06-16T15:40:00Z", UTCOffset: -420, Device: DefaultDevice, Identifier: identifier(TypeSGV, "", "2017-06-16T15:40:00")},
+			},
+		},
+		{
+			name: "mmol",
+			egvs: []dexcom.EGV{dexcom.EGV{SystemTime: "2017-06-16T15:40:00", DisplayTime: "2017-06-16T17:40:00", Value: 6.6, Trend: &down}},
+			unit: "mmol/L",
+			expected: []Entry{
+				Entry{Type: TypeSGV, SGV: 119, Direction: "SingleDown", Trend: 6, Date: 1497627600000, DateString: "2017-06-16T15:40:00Z", SysTime: "2017-06-16T15:40:00Z", UTCOffset: 120, Device: DefaultDevice, Identifier: identifier(TypeSGV, "", "2017-06-16T15:40:00")},
+			},
+		},
+		{
+			name:            "exceptional path - bad time",
+			egvs:            []dexcom.EGV{dexcom.EGV{SystemTime: "yesterday"}},
+			expectedErrCode: dexcom.ErrorTime,
+		},
+	}
+
+	for _, tc := range testcases {
+		t.Run(tc.name, func(t *testing.T) {
+			actual, err := Entries(tc.egvs, tc.unit, "")
+			if tc.expectedErrCode != "" || err != nil {
+				if tc.expectedErrCode == "" {
+					t.Fatalf("Unexpected error occurred (%#v)", err)
+				}
+				if err == nil {
+					t.Fatalf("Expected error did not occur")
+				}
+				if err.Code() != tc.expectedErrCode {
+					t.Fatalf("Actual error (%#v) did not match expected (%#v)", err.Code(), tc.expectedErrCode)
+				}
+				return
+			}
+			if !reflect.DeepEqual(actual, tc.expected) {
+				t.Fatalf("Actual (%#v) did not match expected (%#v)", actual, tc.expected)
+			}
+		})
+	}
+}
+
+func TestUnit_Treatments(t *testing.T) {
+	type testcase struct {
+		name     string
+		event    dexcom.Event
+		expected Treatment
+	}
+
+	testcases := []testcase{
+		{
+			name:     "fast-acting insulin",
+			event:    dexcom.Event{RecordID: "a1", SystemTime: "2017-06-16T19:50:00", EventType: "insulin", EventSubType: "fastActing", Value: 4.5, Unit: "units"},
+			expected: Treatment{EventType: EventTypeBolus, CreatedAt: "2017-06-16T19:50:00Z", Insulin: 4.5, Notes: "Fast-acting insulin", Identifier: "c0cd76d2-b711-54c7-862a-49c06951c331"},
+		},
+		{
+			name:     "long-acting insulin",
+			event:    dexcom.Event{RecordID: "a2", SystemTime: "2017-06-16T22:00:00", EventType: "insulin", EventSubType: "longActing", Value: 20, Unit: "units"},
+			expected: Treatment{EventType: EventTypeNote, CreatedAt: "2017-06-16T22:00:00Z", Notes: "Long-acting insulin 20 units", Identifier: identifier("treatment", "a2", "")},
+		},
+		{
+			name:     "insulin without a subtype",
+			event:    dexcom.Event{RecordID: "a3", SystemTime: "2017-06-16T19:50:00", EventType: "insulin", Value: 2, Unit: "units"},
+			expected: Treatment{EventType: EventTypeBolus, CreatedAt: "2017-06-16T19:50:00Z", Insulin: 2, Identifier: identifier("treatment", "a3", "")},
+		},
+		{
+			name:     "exercise",
+			event:    dexcom.Event{RecordID: "a4", SystemTime: "2017-06-16T19:50:00", EventType: "exercise", EventSubType: "medium", Value: 30, Unit: "minutes"},
+			expected: Treatment{EventType: EventTypeExercise, CreatedAt: "2017-06-16T19:50:00Z", Duration: 30, Notes: "medium", Identifier: identifier("treatment", "a4", "")},
+		},
+	}
+
+	for _, tc := range testcases {
+		t.Run(tc.name, func(t *testing.T) {
+			actual, err := Treatments([]dexcom.Event{tc.event}, "")
+			if err != nil {
+				t.Fatalf("Unexpected error occurred (%#v)", err)
+			}
+			if !reflect.DeepEqual(actual, []Treatment{tc.expected}) {
+				t.Fatalf("Actual (%#v) did not match expected (%#v)", actual, tc.expected)
+			}
+			// the identifier follows the record id, not the event's contents, so an edited record replaces the old one
+			edited := tc.event
+			edited.Value++
+			again, _ := Treatments([]dexcom.Event{edited}, "")
+			if again[0].Identifier != actual[0].Identifier {
+				t.Fatalf("Actual identifier (%s) did not match expected (%s)", again[0].Identifier, actual[0].Identifier)
+			}
+		})
+	}
+}
+
+func TestUnit_Sink(t *testing.T) {
+	var treatments []Treatment
+	var paths []string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// sha1 of "secret"
+		if r.Header.Get("api-secret") != "e5e9fa1ba31ecd1ae84f75caaa474f3a663f05f4" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		paths = append(paths, r.URL.Path)
+		if r.URL.Path == "/ns/api/v1/treatments" {
+			json.NewDecoder(r.Body).Decode(&treatments)
+		}
+		w.Write([]byte(`{}`))
+	}))
+	defer ts.Close()
+
+	u, err := NewUploader(ts.URL+"/ns", "secret", 5*time.Second)
+	if err != nil {
+		t.Fatalf("Unexpected error occurred (%#v)", err)
+	}
+	s := NewSink(u, "")
+	ctx := context.Background()
+	if err := s.UpsertEGVs(ctx, "user", []dexcom.EGV{dexcom.EGV{SystemTime: "2017-06-16T15:40:00", Value: 119}}); err != nil {
+		t.Fatalf("Unexpected error occurred (%#v)", err)
+	}
+	events := []dexcom.Event{
+		dexcom.Event{SystemTime: "2017-06-16T19:45:00", EventType: "carbs", Value: 45, Unit: "grams"},
+		dexcom.Event{SystemTime: "2017-06-16T19:50:00", EventType: "insulin", EventSubType: "fastActing", Value: 4.5, Unit: "units"},
+	}
+	if err := s.UpsertEvents(ctx, "user", events); err != nil {
+		t.Fatalf("Unexpected error occurred (%#v)", err)
+	}
+	if err := s.UpsertDevices(ctx, "user", []dexcom.Device{dexcom.Device{Model: "G6"}}); err != nil {
+		t.Fatalf("Unexpected error occurred (%#v)", err)
+	}
+
+	if !reflect.DeepEqual(paths, []string{"/ns/api/v1/entries", "/ns/api/v1/treatments"}) {
+		t.Fatalf("Unexpected requests %v", paths)
+	}
+	expected := []Treatment{
+		Treatment{EventType: EventTypeCarbs, CreatedAt: "2017-06-16T19:45:00Z", Carbs: 45, EnteredBy: DefaultDevice, Identifier: identifier("treatment", "", "2017-06-16T19:45:00|carbs|")},
+		Treatment{EventType: EventTypeBolus, CreatedAt: "2017-06-16T19:50:00Z", Insulin: 4.5, Notes: "Fast-acting insulin", EnteredBy: DefaultDevice, Identifier: identifier("treatment", "", "2017-06-16T19:50:00|insulin|fastActing")},
+	}
+	if !reflect.DeepEqual(treatments, expected) {
+		t.Fatalf("Actual (%#v) did not match expected (%#v)", treatments, expected)
+	}
+
+	bad, _ := NewUploader(ts.URL, "wrong", 5*time.Second)
+	if err := bad.UploadTreatments(ctx, expected); err == nil || err.Code() != dexcom.ErrorAPI {
+		t.Fatalf("Expected an api error, got (%#v)", err)
+	}
+}
@@ -0,0 +1,127 @@
+package nightscout
+
+import (
+	"context"
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"net/url"
+	"path"
+	"time"
+
+	"github.com/healthimation/go-client/client"
+	"github.com/healthimation/go-dexcom/dexcom"
+	"github.com/healthimation/go-glitch/glitch"
+)
+
+// Uploader posts entries and treatments to a Nightscout site
+type Uploader interface {
+	UploadEntries(ctx context.Context, entries []Entry) glitch.DataError
+	UploadTreatments(ctx context.Context, treatments []Treatment) glitch.DataError
+}
+
+type uploader struct {
+	c          client.BaseClient
+	basePath   string
+	secretHash string
+}
+
+// NewUploader returns an uploader for the Nightscout site at siteURL, e.g. https://example.herokuapp.com.  apiSecret is
+// the site's API_SECRET, which is only ever sent hashed.
+func NewUploader(siteURL, apiSecret string, timeout time.Duration) (Uploader, glitch.DataError) {
+	u, err := url.Parse(siteURL)
+	if err != nil || u.Host == "" {
+		return nil, glitch.NewDataError(fmt.Errorf("invalid site url %q", siteURL), dexcom.ErrorMissingParam, "A Nightscout site url is required")
+	}
+	base := *u
+	base.Path = ""
+	finder := func(serviceName string, useTLS bool) (url.URL, error) {
+		return base, nil
+	}
+	sum := sha1.Sum([]byte(apiSecret))
+	return &uploader{
+		c:          client.NewBaseClient(finder, "nightscout", true, timeout),
+		basePath:   u.Path,
+		secretHash: hex.EncodeToString(sum[:]),
+	}, nil
+}
+
+func (u *uploader) UploadEntries(ctx context.Context, entries []Entry) glitch.DataError {
+	if len(entries) == 0 {
+		return nil
+	}
+	return u.post(ctx, "api/v1/entries", entries)
+}
+
+func (u *uploader) UploadTreatments(ctx context.Context, treatments []Treatment) glitch.DataError {
+	if len(treatments) == 0 {
+		return nil
+	}
+	return u.post(ctx, "api/v1/treatments", treatments)
+}
+
+func (u *uploader) post(ctx context.Context, slug string, body interface{}) glitch.DataError {
+	h := http.Header{}
+	h.Set("Content-type", "application/json")
+	h.Set("api-secret", u.secretHash)
+
+	r, err := client.ObjectToJSONReader(body)
+	if err != nil {
+		return glitch.NewDataError(err, dexcom.ErrorJSON, "Could not marshal request")
+	}
+	statusCode, ret, err := u.c.MakeRequest(ctx, http.MethodPost, path.Join("/", u.basePath, slug), nil, h, r)
+	if err != nil {
+		return err
+	}
+	if statusCode < 200 || statusCode >= 300 {
+		return glitch.NewDataError(fmt.Errorf("Error from API: %d - %s", statusCode, ret), dexcom.ErrorAPI, fmt.Sprintf("Status code was not in the 2xx range: %d", statusCode))
+	}
+	return nil
+}
+
+type sink struct {
+	u      Uploader
+	device string
+}
+
+// NewSink returns a dexcom.Sink that uploads to a single patient's Nightscout site, so a dexcom.Syncer can act as a
+// Dexcom to Nightscout bridge.  Devices and statistics have no Nightscout equivalent and are dropped.
+func NewSink(u Uploader, device string) dexcom.Sink {
+	if device == "" {
+		device = DefaultDevice
+	}
+	return &sink{u: u, device: device}
+}
+
+func (s *sink) UpsertEGVs(ctx context.Context, userID string, egvs []dexcom.EGV) glitch.DataError {
+	entries, err := Entries(egvs, dexcom.UnitMgDL, s.device)
+	if err != nil {
+		return err
+	}
+	return s.u.UploadEntries(ctx, entries)
+}
+
+func (s *sink) UpsertEvents(ctx context.Context, userID string, events []dexcom.Event) glitch.DataError {
+	treatments, err := Treatments(events, s.device)
+	if err != nil {
+		return err
+	}
+	return s.u.UploadTreatments(ctx, treatments)
+}
+
+func (s *sink) UpsertCalibrations(ctx context.Context, userID string, calibrations []dexcom.Calibration) glitch.DataError {
+	entries, err := CalibrationEntries(calibrations, s.device)
+	if err != nil {
+		return err
+	}
+	return s.u.UploadEntries(ctx, entries)
+}
+
+func (s *sink) UpsertDevices(ctx context.Context, userID string, devices []dexcom.Device) glitch.DataError {
+	return nil
+}
+
+func (s *sink) UpsertStatistics(ctx context.Context, userID string, startDate, endDate time.Time, stats *dexcom.Statistics) glitch.DataError {
+	return nil
+}
@@ -0,0 +1,199 @@
+// Package omh converts dexcom data to Open mHealth (IEEE 1752.1) data points.
+package omh
+
+import (
+	"time"
+
+	"github.com/healthimation/go-dexcom/dexcom"
+	"github.com/healthimation/go-glitch/glitch"
+)
+
+// Schemas data points are produced in
+var (
+	SchemaBloodGlucose     = SchemaID{Namespace: "omh", Name: "blood-glucose", Version: "3.0"}
+	SchemaPhysicalActivity = SchemaID{Namespace: "omh", Name: "physical-activity", Version: "1.2"}
+)
+
+// Specimen sources
+const (
+	SpecimenInterstitialFluid = "interstitial fluid"
+	SpecimenCapillaryBlood    = "capillary blood"
+)
+
+// Modalities
+const (
+	ModalitySensed       = "sensed"
+	ModalitySelfReported = "self-reported"
+)
+
+const (
+	unitMinutes      = "min"
+	activityExercise = "exercise"
+)
+
+// DataPoint is an Open mHealth data point
+type DataPoint struct {
+	Header Header      `json:"header"`
+	Body   interface{} `json:"body"`
+}
+
+// Header identifies a data point and where it came from
+type Header struct {
+	ID                    string      `json:"id"`
+	CreationDateTime      string      `json:"creation_date_time"`
+	SchemaID              SchemaID    `json:"schema_id"`
+	AcquisitionProvenance *Provenance `json:"acquisition_provenance,omitempty"`
+	UserID                string      `json:"user_id,omitempty"`
+}
+
+// SchemaID names the schema of a data point's body
+type SchemaID struct {
+	Namespace string `json:"namespace"`
+	Name      string `json:"name"`
+	Version   string `json:"version"`
+}
+
+// Provenance names the device that acquired a data point
+type Provenance struct {
+	SourceName             string `json:"source_name"`
+	SourceCreationDateTime string `json:"source_creation_date_time,omitempty"`
+	Modality               string `json:"modality,omitempty"`
+}
+
+// UnitValue is a value with a unit
+type UnitValue struct {
+	Value float64 `json:"value"`
+	Unit  string  `json:"unit"`
+}
+
+// TimeFrame is either a point in time or an interval
+type TimeFrame struct {
+	DateTime     string        `json:"date_time,omitempty"`
+	TimeInterval *TimeInterval `json:"time_interval,omitempty"`
+}
+
+// TimeInterval is a start and a duration
+type TimeInterval struct {
+	StartDateTime string    `json:"start_date_time"`
+	Duration      UnitValue `json:"duration"`
+}
+
+// BloodGlucose is the body of an omh:blood-glucose data point
+type BloodGlucose struct {
+	BloodGlucose       UnitValue `json:"blood_glucose"`
+	EffectiveTimeFrame TimeFrame `json:"effective_time_frame"`
+	SpecimenSource     string    `json:"specimen_source"`
+}
+
+// PhysicalActivity is the body of an omh:physical-activity data point
+type PhysicalActivity struct {
+	ActivityName              string    `json:"activity_name"`
+	EffectiveTimeFrame        TimeFrame `json:"effective_time_frame"`
+	ReportedActivityIntensity string    `json:"reported_activity_intensity,omitempty"`
+}
+
+// intensities maps dexcom exercise subtypes to omh activity intensities
+var intensities = map[string]string{
+	"light":  "light",
+	"medium": "moderate",
+	"heavy":  "vigorous",
+}
+
+// BloodGlucosePoints converts egvs to blood-glucose data points from interstitial fluid, attributed to device.
+// Readings outside the sensor's range carry the limit dexcom reports them at, since the schema has no way to mark them.
+func BloodGlucosePoints(resp *dexcom.EGVResponse, device dexcom.Device, userID string) ([]DataPoint, glitch.DataError) {
+	if resp == nil {
+		return nil, nil
+	}
+	ret := make([]DataPoint, 0, len(resp.EGVs))
+	for _, e := range resp.EGVs {
+		p, err := bloodGlucose(e.RecordID, e.SystemTime, e.Value, resp.Unit, SpecimenInterstitialFluid, ModalitySensed, device, userID)
+		if err != nil {
+			return nil, err
+		}
+		ret = append(ret, p)
+	}
+	return ret, nil
+}
+
+// CalibrationPoints converts meter calibrations to self-reported blood-glucose data points from capillary blood
+func CalibrationPoints(resp *dexcom.CalibrationResponse, device dexcom.Device, userID string) ([]DataPoint, glitch.DataError) {
+	if resp == nil {
+		return nil, nil
+	}
+	ret := make([]DataPoint, 0, len(resp.Calibrations))
+	for _, c := range resp.Calibrations {
+		p, err := bloodGlucose(c.RecordID, c.SystemTime, c.Value, c.Unit, SpecimenCapillaryBlood, ModalitySelfReported, device, userID)
+		if err != nil {
+			return nil, err
+		}
+		ret = append(ret, p)
+	}
+	return ret, nil
+}
+
+// EventPoints converts events to the matching omh schemas.  Exercise becomes physical-activity; carbs, insulin and
+// health events have no omh schema and are skipped.
+func EventPoints(resp *dexcom.EventResponse, device dexcom.Device, userID string) ([]DataPoint, glitch.DataError) {
+	if resp == nil {
+		return nil, nil
+	}
+	var ret []DataPoint
+	for _, e := range resp.Events {
+		if e.EventType != "exercise" {
+			continue
+		}
+		t, err := dexcom.ParseTime(e.SystemTime)
+		if err != nil {
+			return nil, err
+		}
+		ret = append(ret, DataPoint{
+			Header: header(SchemaPhysicalActivity, dexcom.RecordKey(e.RecordID, e.SystemTime), t, ModalitySelfReported, device, userID),
+			Body: PhysicalActivity{
+				ActivityName: activityExercise,
+				EffectiveTimeFrame: TimeFrame{TimeInterval: &TimeInterval{
+					StartDateTime: dateTime(t),
+					Duration:      UnitValue{Value: e.Value, Unit: unitMinutes},
+				}},
+				ReportedActivityIntensity: intensities[e.EventSubType],
+			},
+		})
+	}
+	return ret, nil
+}
+
+func bloodGlucose(recordID, systemTime string, value float64, unit, specimen, modality string, device dexcom.Device, userID string) (DataPoint, glitch.DataError) {
+	t, err := dexcom.ParseTime(systemTime)
+	if err != nil {
+		return DataPoint{}, err
+	}
+	if unit == "" {
+		unit = dexcom.UnitMgDL
+	}
+	return DataPoint{
+		Header: header(SchemaBloodGlucose, specimen+dexcom.RecordKey(recordID, systemTime), t, modality, device, userID),
+		Body: BloodGlucose{
+			BloodGlucose:       UnitValue{Value: value, Unit: unit},
+			EffectiveTimeFrame: TimeFrame{DateTime: dateTime(t)},
+			SpecimenSource:     specimen,
+		},
+	}, nil
+}
+
+func header(schema SchemaID, k string, t time.Time, modality string, device dexcom.Device, userID string) Header {
+	return Header{
+		ID:               dexcom.RecordUUID(userID, schema.Name, k),
+		CreationDateTime: dateTime(t),
+		SchemaID:         schema,
+		AcquisitionProvenance: &Provenance{
+			SourceName:             device.Model,
+			SourceCreationDateTime: dateTime(t),
+			Modality:               modality,
+		},
+		UserID: userID,
+	}
+}
+
+func dateTime(t time.Time) string {
+	return t.UTC().Format(time.RFC3339)
+}
@@ -0,0 +1,74 @@
+package omh
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/healthimation/go-dexcom/dexcom"
+	"github.com/healthimation/go-glitch/glitch"
+)
+
+func TestUnit_DataPoints(t *testing.T) {
+	device := dexcom.Device{Model: "G6 Mobile App"}
+	egvs := &dexcom.EGVResponse{Unit: "mmol/L", EGVs: []dexcom.EGV{dexcom.EGV{SystemTime: "2017-06-16T15:40:00", Value: 6.6}}}
+	events := &dexcom.EventResponse{Events: []dexcom.Event{
+		dexcom.Event{SystemTime: "2017-06-16T19:45:00", EventType: "carbs", Value: 45, Unit: "grams"},
+		dexcom.Event{SystemTime: "2017-06-16T19:50:00", EventType: "exercise", EventSubType: "medium", Value: 30, Unit: "minutes"},
+	}}
+
+	type testcase struct {
+		name            string
+		convert         func() ([]DataPoint, glitch.DataError)
+		expectedErrCode string
+		expected        string
+	}
+
+	testcases := []testcase{
+		{
+			name: "egvs",
+			convert: func() ([]DataPoint, glitch.DataError) {
+				return BloodGlucosePoints(egvs, device, "user")
+			},
+			expected: `[{"header":{"id":"$ID","creation_date_time":"2017-06-16T15:40:00Z","schema_id":{"namespace":"omh","name":"blood-glucose","version":"3.0"},"acquisition_provenance":{"source_name":"G6 Mobile App","source_creation_date_time":"2017-06-16T15:40:00Z","modality":"sensed"},"user_id":"user"},"body":{"blood_glucose":{"value":6.6,"unit":"mmol/L"},"effective_time_frame":{"date_time":"2017-06-16T15:40:00Z"},"specimen_source":"interstitial fluid"}}]`,
+		},
+		{
+			name: "events",
+			convert: func() ([]DataPoint, glitch.DataError) {
+				return EventPoints(events, device, "user")
+			},
+			expected: `[{"header":{"id":"$ID","creation_date_time":"2017-06-16T19:50:00Z","schema_id":{"namespace":"omh","name":"physical-activity","version":"1.2"},"acquisition_provenance":{"source_name":"G6 Mobile App","source_creation_date_time":"2017-06-16T19:50:00Z","modality":"self-reported"},"user_id":"user"},"body":{"activity_name":"exercise","effective_time_frame":{"time_interval":{"start_date_time":"2017-06-16T19:50:00Z","duration":{"value":30,"unit":"min"}}},"reported_activity_intensity":"moderate"}}]`,
+		},
+		{
+			name: "exceptional path - bad time",
+			convert: func() ([]DataPoint, glitch.DataError) {
+				return BloodGlucosePoints(&dexcom.EGVResponse{EGVs: []dexcom.EGV{dexcom.EGV{SystemTime: "yesterday"}}}, device, "user")
+			},
+			expectedErrCode: dexcom.ErrorTime,
+		},
+	}
+
+	for _, tc := range testcases {
+		t.Run(tc.name, func(t *testing.T) {
+			points, err := tc.convert()
+			if tc.expectedErrCode != "" || err != nil {
+				if tc.expectedErrCode == "" {
+					t.Fatalf("Unexpected error occurred (%#v)", err)
+				}
+				if err == nil {
+					t.Fatalf("Expected error did not occur")
+				}
+				if err.Code() != tc.expectedErrCode {
+					t.Fatalf("Actual error (%#v) did not match expected (%#v)", err.Code(), tc.expectedErrCode)
+				}
+				return
+			}
+			for i := range points {
+				points[i].Header.ID = "$ID"
+			}
+			by, _ := json.Marshal(points)
+			if string(by) != tc.expected {
+				t.Fatalf("Actual (%s) did not match expected (%s)", by, tc.expected)
+			}
+		})
+	}
+}
@@ -0,0 +1,65 @@
+// Package oteltrace adapts an OpenTelemetry trace.Tracer to dexcom.Tracer so a tracing client reports to the same
+// pipeline as the rest of a service.
+package oteltrace
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/healthimation/go-dexcom/dexcom"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+type tracer struct {
+	t trace.Tracer
+}
+
+// NewTracer returns a dexcom.Tracer that starts client spans on t, e.g. otel.Tracer("dexcom")
+func NewTracer(t trace.Tracer) dexcom.Tracer {
+	return &tracer{t: t}
+}
+
+func (o *tracer) Start(ctx context.Context, name string) (context.Context, dexcom.Span) {
+	ctx, s := o.t.Start(ctx, name, trace.WithSpanKind(trace.SpanKindClient))
+	return ctx, &span{s: s}
+}
+
+type span struct {
+	s trace.Span
+}
+
+func (o *span) SetAttributes(attributes ...dexcom.Attribute) {
+	kvs := make([]attribute.KeyValue, 0, len(attributes))
+	for _, a := range attributes {
+		kvs = append(kvs, keyValue(a))
+	}
+	o.s.SetAttributes(kvs...)
+}
+
+func (o *span) SetError(code string) {
+	o.s.SetStatus(codes.Error, code)
+}
+
+func (o *span) End() {
+	o.s.End()
+}
+
+// keyValue converts an attribute, falling back to its string form for types dexcom doesn't use today
+func keyValue(a dexcom.Attribute) attribute.KeyValue {
+	switch v := a.Value.(type) {
+	case string:
+		return attribute.String(a.Key, v)
+	case int64:
+		return attribute.Int64(a.Key, v)
+	case int:
+		return attribute.Int(a.Key, v)
+	case bool:
+		return attribute.Bool(a.Key, v)
+	case float64:
+		return attribute.Float64(a.Key, v)
+	default:
+		return attribute.String(a.Key, fmt.Sprint(v))
+	}
+}
@@ -0,0 +1,122 @@
+package oteltrace
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/healthimation/go-dexcom/dexcom"
+	"github.com/healthimation/go-dexcom/dexcom/dexcommock"
+	"github.com/healthimation/go-glitch/glitch"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+	"go.opentelemetry.io/otel/trace/embedded"
+)
+
+// recordingSpan keeps what the adapter sets, standing in for an sdk span
+type recordingSpan struct {
+	embedded.Span
+
+	name        string
+	kind        trace.SpanKind
+	attributes  map[attribute.Key]attribute.Value
+	status      codes.Code
+	description string
+	ended       bool
+}
+
+func (s *recordingSpan) End(options ...trace.SpanEndOption)                  { s.ended = true }
+func (s *recordingSpan) AddEvent(name string, options ...trace.EventOption)  {}
+func (s *recordingSpan) AddLink(link trace.Link)                             {}
+func (s *recordingSpan) IsRecording() bool                                   { return !s.ended }
+func (s *recordingSpan) RecordError(err error, options ...trace.EventOption) {}
+func (s *recordingSpan) SpanContext() trace.SpanContext                      { return trace.SpanContext{} }
+func (s *recordingSpan) SetName(name string)                                 { s.name = name }
+func (s *recordingSpan) TracerProvider() trace.TracerProvider                { return nil }
+
+func (s *recordingSpan) SetStatus(code codes.Code, description string) {
+	s.status = code
+	s.description = description
+}
+
+func (s *recordingSpan) SetAttributes(kv ...attribute.KeyValue) {
+	for _, a := range kv {
+		s.attributes[a.Key] = a.Value
+	}
+}
+
+type recordingTracer struct {
+	embedded.Tracer
+
+	spans []*recordingSpan
+}
+
+func (t *recordingTracer) Start(ctx context.Context, name string, options ...trace.SpanStartOption) (context.Context, trace.Span) {
+	cfg := trace.NewSpanStartConfig(options...)
+	s := &recordingSpan{name: name, kind: cfg.SpanKind(), attributes: map[attribute.Key]attribute.Value{}}
+	t.spans = append(t.spans, s)
+	return trace.ContextWithSpan(ctx, s), s
+}
+
+func TestUnit_Tracer(t *testing.T) {
+	m := &dexcommock.Client{}
+	m.ScriptGetEGVs(&dexcom.EGVResponse{EGVs: []dexcom.EGV{dexcom.EGV{Value: 119}, dexcom.EGV{Value: 121}}}, nil)
+	m.ScriptGetEvents(nil, glitch.NewDataError(nil, dexcom.ErrorUnauthorized, "unauthorized"))
+	ot := &recordingTracer{}
+	c := dexcom.NewTracingClient(m, NewTracer(ot))
+
+	start := time.Date(2017, 6, 16, 0, 0, 0, 0, time.UTC)
+	c.GetEGVs(context.Background(), "token", start, start.Add(time.Hour))
+	c.GetEvents(context.Background(), "token", start, start.Add(time.Hour))
+
+	if len(ot.spans) != 2 {
+		t.Fatalf("Actual spans (%d) did not match expected (2)", len(ot.spans))
+	}
+	egvs, events := ot.spans[0], ot.spans[1]
+
+	expectedEGVs := map[attribute.Key]attribute.Value{
+		dexcom.AttributeEndpoint:  attribute.StringValue(dexcom.EndpointGetEGVs),
+		dexcom.AttributeStartDate: attribute.StringValue("2017-06-16T00:00:00"),
+		dexcom.AttributeEndDate:   attribute.StringValue("2017-06-16T01:00:00"),
+		dexcom.AttributeStatus:    attribute.StringValue("ok"),
+		dexcom.AttributeRecords:   attribute.Int64Value(2),
+	}
+	if egvs.name != "dexcom.GetEGVs" || egvs.kind != trace.SpanKindClient || !egvs.ended || egvs.status != codes.Unset {
+		t.Fatalf("Actual span (%s, %v, %v, %v) did not match expected (dexcom.GetEGVs, client, true, unset)", egvs.name, egvs.kind, egvs.ended, egvs.status)
+	}
+	if !reflect.DeepEqual(egvs.attributes, expectedEGVs) {
+		t.Fatalf("Actual attributes (%v) did not match expected (%v)", egvs.attributes, expectedEGVs)
+	}
+
+	if events.status != codes.Error || events.description != dexcom.ErrorUnauthorized || !events.ended {
+		t.Fatalf("Actual status (%v, %s, %v) did not match expected (error, %s, true)", events.status, events.description, events.ended, dexcom.ErrorUnauthorized)
+	}
+	if status := events.attributes[dexcom.AttributeStatus]; status != attribute.StringValue(dexcom.ErrorUnauthorized) {
+		t.Fatalf("Actual status attribute (%v) did not match expected (%s)", status, dexcom.ErrorUnauthorized)
+	}
+}
+
+func TestUnit_KeyValue(t *testing.T) {
+	tests := []struct {
+		name     string
+		value    interface{}
+		expected attribute.Value
+	}{
+		{name: "string", value: "ok", expected: attribute.StringValue("ok")},
+		{name: "int64", value: int64(200), expected: attribute.Int64Value(200)},
+		{name: "int", value: 3, expected: attribute.IntValue(3)},
+		{name: "bool", value: true, expected: attribute.BoolValue(true)},
+		{name: "float64", value: 1.5, expected: attribute.Float64Value(1.5)},
+		{name: "other", value: time.Minute, expected: attribute.StringValue("1m0s")},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			actual := keyValue(dexcom.Attribute{Key: "key", Value: test.value})
+			if actual.Key != "key" || actual.Value != test.expected {
+				t.Fatalf("Actual (%v) did not match expected (%v)", actual.Value, test.expected)
+			}
+		})
+	}
+}
@@ -0,0 +1,365 @@
+package dexcom
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/healthimation/go-glitch/glitch"
+)
+
+const (
+	// invalid_grant backoff
+	minGrantBackoff = time.Hour
+	maxGrantBackoff = 7 * 24 * time.Hour
+)
+
+// TokenStore holds the tokens for the users a Scheduler syncs.  Refreshed tokens are saved back since dexcom rotates
+// the refresh token on every refresh.
+type TokenStore interface {
+	ListUsers(ctx context.Context) ([]string, glitch.DataError)
+	GetToken(ctx context.Context, userID string) (*UserToken, glitch.DataError)
+	SaveToken(ctx context.Context, userID string, token *UserToken) glitch.DataError
+}
+
+// UserStatus is the sync state of one user in a Scheduler
+type UserStatus struct {
+	UserID         string      `json:"userId"`
+	LastAttempt    time.Time   `json:"lastAttempt"`
+	LastSuccess    time.Time   `json:"lastSuccess"`
+	LastUploadDate time.Time   `json:"lastUploadDate"`
+	Checkpoint     time.Time   `json:"checkpoint"`
+	Result         *SyncResult `json:"result,omitempty"`
+	Error          string      `json:"error,omitempty"`
+	ErrorCode      string      `json:"errorCode,omitempty"`
+	// GrantFailures counts consecutive invalid_grant failures, the user is skipped until NextAttempt while backing off
+	GrantFailures int       `json:"grantFailures"`
+	NextAttempt   time.Time `json:"nextAttempt"`
+	Skipped       bool      `json:"skipped"`
+}
+
+// Scheduler syncs many users with bounded concurrency
+type Scheduler interface {
+	// Run syncs every user in the token store once, longest unsynced first.  progress, if not nil, is called as each user
+	// finishes, never concurrently.  Once the channel set by WithDrain is closed no more users are started.
+	Run(ctx context.Context, progress func(UserStatus)) ([]UserStatus, glitch.DataError)
+	// Status returns the latest status of every user seen so far
+	Status() []UserStatus
+}
+
+type scheduler struct {
+	c           Client
+	s           Syncer
+	tokens      TokenStore
+	checkpoints CheckpointStore
+	redirectURI string
+	concurrency int
+	now         func() time.Time
+
+	mu     sync.Mutex
+	status map[string]UserStatus
+}
+
+// NewScheduler returns a Scheduler that runs at most concurrency syncs at once.  Expired tokens are refreshed with c
+// using redirectURI before syncing, and a sync whose token is rejected is retried once with a refreshed token.
+// checkpoints should be the store s saves to, it is read to order users the scheduler has not synced yet, e.g. after a
+// restart.
+func NewScheduler(c Client, s Syncer, tokens TokenStore, checkpoints CheckpointStore, redirectURI string, concurrency int) Scheduler {
+	if concurrency < 1 {
+		concurrency = 1
+	}
+	return &scheduler{
+		c:           c,
+		s:           s,
+		tokens:      tokens,
+		checkpoints: checkpoints,
+		redirectURI: redirectURI,
+		concurrency: concurrency,
+		now:         time.Now,
+		status:      make(map[string]UserStatus),
+	}
+}
+
+func (s *scheduler) Run(ctx context.Context, progress func(UserStatus)) ([]UserStatus, glitch.DataError) {
+	users, err := s.tokens.ListUsers(ctx)
+	if err != nil {
+		return nil, err
+	}
+	users = s.prioritize(ctx, users)
+
+	results := make([]UserStatus, len(users))
+	sem := make(chan struct{}, s.concurrency)
+	wg := sync.WaitGroup{}
+	progressMu := sync.Mutex{}
+	drain := drainFromContext(ctx)
+	for i, userID := range users {
+		select {
+		case <-drain:
+			wg.Wait()
+			return results[:i], glitch.NewDataError(nil, ErrorCanceled, "Scheduler run was drained")
+		default:
+		}
+		select {
+		case sem <- struct{}{}:
+		case <-ctx.Done():
+			wg.Wait()
+			return results[:i], glitch.NewDataError(ctx.Err(), ErrorCanceled, "Scheduler run was canceled")
+		case <-drain:
+			wg.Wait()
+			return results[:i], glitch.NewDataError(nil, ErrorCanceled, "Scheduler run was drained")
+		}
+		wg.Add(1)
+		go func(i int, userID string) {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+			results[i] = s.syncUser(ctx, userID)
+			if progress != nil {
+				progressMu.Lock()
+				progress(results[i])
+				progressMu.Unlock()
+			}
+		}(i, userID)
+	}
+	wg.Wait()
+	return results, nil
+}
+
+func (s *scheduler) Status() []UserStatus {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	ret := make([]UserStatus, 0, len(s.status))
+	for _, status := range s.status {
+		ret = append(ret, status)
+	}
+	sort.Slice(ret, func(i, j int) bool { return ret[i].UserID < ret[j].UserID })
+	return ret
+}
+
+// prioritize orders users by how long it has been since their checkpoint, never synced first.  Ties go to the user
+// whose device uploaded most recently, or whose last upload isn't known.  Users the scheduler has not synced yet have
+// their checkpoint read from the checkpoint store.
+func (s *scheduler) prioritize(ctx context.Context, users []string) []string {
+	s.mu.Lock()
+	status := make(map[string]UserStatus, len(users))
+	for _, userID := range users {
+		status[userID] = s.status[userID]
+	}
+	s.mu.Unlock()
+
+	for _, userID := range users {
+		st := status[userID]
+		if !st.Checkpoint.IsZero() || s.checkpoints == nil {
+			continue
+		}
+		// an unreadable checkpoint leaves the user at the front, syncing will surface the error
+		if checkpoint, err := s.checkpoints.GetCheckpoint(ctx, userID); err == nil {
+			st.Checkpoint = checkpoint
+			status[userID] = st
+		}
+	}
+
+	now := s.now()
+	staleness := func(userID string) time.Duration {
+		checkpoint := status[userID].Checkpoint
+		if checkpoint.IsZero() {
+			return time.Duration(1<<63 - 1)
+		}
+		return now.Sub(checkpoint)
+	}
+
+	// users whose last upload isn't known yet might have uploaded just now
+	lastUpload := func(userID string) time.Time {
+		if t := status[userID].LastUploadDate; !t.IsZero() {
+			return t
+		}
+		return now
+	}
+
+	ret := append([]string(nil), users...)
+	sort.SliceStable(ret, func(i, j int) bool {
+		a, b := staleness(ret[i]), staleness(ret[j])
+		if a != b {
+			return a > b
+		}
+		return lastUpload(ret[i]).After(lastUpload(ret[j]))
+	})
+	return ret
+}
+
+func (s *scheduler) syncUser(ctx context.Context, userID string) UserStatus {
+	s.mu.Lock()
+	status := s.status[userID]
+	s.mu.Unlock()
+
+	now := s.now()
+	status.UserID = userID
+	status.Skipped = false
+	if now.Before(status.NextAttempt) {
+		status.Skipped = true
+		return s.setStatus(status)
+	}
+	status.LastAttempt = now
+
+	token, err := s.token(ctx, userID)
+	if err == nil {
+		var result *SyncResult
+		result, err = s.s.Sync(ctx, userID, token.AccessToken)
+		// a token revoked or replaced before it expired is refreshed once, the sinks upsert so the sync is repeated whole
+		if unauthorized(err) {
+			token, err = refreshToken(ctx, s.c, s.tokens, userID, s.redirectURI, token.AccessToken)
+			if err == nil {
+				MetricsFromContext(ctx).ObserveRetry(OperationSync)
+				result, err = s.s.Sync(ctx, userID, token.AccessToken)
+			}
+		}
+		if result != nil {
+			status.Result = result
+			status.Checkpoint = result.End
+			if !result.LastUploadDate.IsZero() {
+				status.LastUploadDate = result.LastUploadDate
+			}
+		}
+	}
+
+	status.Error = ""
+	status.ErrorCode = ""
+	if err != nil {
+		status.Error = err.Error()
+		status.ErrorCode = err.Code()
+		if err.Code() == ErrorInvalidGrant {
+			status.GrantFailures++
+			status.NextAttempt = now.Add(grantBackoff(status.GrantFailures))
+		}
+		return s.setStatus(status)
+	}
+	status.GrantFailures = 0
+	status.NextAttempt = time.Time{}
+	status.LastSuccess = now
+	return s.setStatus(status)
+}
+
+// token returns a usable token for the user, refreshing and saving it if it has expired
+func (s *scheduler) token(ctx context.Context, userID string) (*UserToken, glitch.DataError) {
+	return currentToken(ctx, s.c, s.tokens, userID, s.redirectURI, s.now())
+}
+
+// refreshLocks holds a mutex per user id so a process refreshes each user's token once at a time.  Refresh tokens are
+// single use, so a second refresh with the same one fails with invalid_grant.
+var refreshLocks sync.Map
+
+// currentToken returns the user's token from tokens, refreshing it with c and saving it back if it has expired by now
+func currentToken(ctx context.Context, c Client, tokens TokenStore, userID, redirectURI string, now time.Time) (*UserToken, glitch.DataError) {
+	token, err := storedToken(ctx, tokens, userID)
+	if err != nil {
+		return nil, err
+	}
+	if token.ExpireTime == nil || now.Before(*token.ExpireTime) {
+		return token, nil
+	}
+	return refreshToken(ctx, c, tokens, userID, redirectURI, token.AccessToken)
+}
+
+// refreshToken replaces the user's token whose access token is stale, because it expired or was rejected.  If the
+// stored token no longer has that access token it was refreshed in the meantime and is returned as is.  A refresh that
+// fails with invalid_grant because another process used the refresh token first returns the token that process saved.
+func refreshToken(ctx context.Context, c Client, tokens TokenStore, userID, redirectURI, stale string) (*UserToken, glitch.DataError) {
+	mu, _ := refreshLocks.LoadOrStore(userID, &sync.Mutex{})
+	mu.(*sync.Mutex).Lock()
+	defer mu.(*sync.Mutex).Unlock()
+
+	token, err := storedToken(ctx, tokens, userID)
+	if err != nil {
+		return nil, err
+	}
+	if token.AccessToken != stale {
+		return token, nil
+	}
+	refreshed, err := c.RefreshUser(ctx, token.RefreshToken, redirectURI)
+	if err != nil {
+		if err.Code() == ErrorInvalidGrant {
+			if latest, lerr := storedToken(ctx, tokens, userID); lerr == nil && latest.RefreshToken != token.RefreshToken {
+				return latest, nil
+			}
+		}
+		return nil, err
+	}
+	if err := tokens.SaveToken(ctx, userID, refreshed); err != nil {
+		return nil, err
+	}
+	return refreshed, nil
+}
+
+func storedToken(ctx context.Context, tokens TokenStore, userID string) (*UserToken, glitch.DataError) {
+	token, err := tokens.GetToken(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if token == nil {
+		return nil, glitch.NewDataError(nil, ErrorMissingParam, "No token for user")
+	}
+	return token, nil
+}
+
+// unauthorized reports whether err is a 401 from the api, i.e. the access token was rejected before it expired
+func unauthorized(err glitch.DataError) bool {
+	return err != nil && err.Code() == ErrorUnauthorized
+}
+
+func (s *scheduler) setStatus(status UserStatus) UserStatus {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.status[status.UserID] = status
+	return status
+}
+
+func grantBackoff(failures int) time.Duration {
+	backoff := minGrantBackoff
+	for i := 1; i < failures && backoff < maxGrantBackoff; i++ {
+		backoff *= 2
+	}
+	if backoff > maxGrantBackoff {
+		backoff = maxGrantBackoff
+	}
+	return backoff
+}
+
+type memoryTokenStore struct {
+	mu     sync.Mutex
+	tokens map[string]*UserToken
+}
+
+// NewMemoryTokenStore returns a TokenStore seeded with tokens keyed by user id
+func NewMemoryTokenStore(tokens map[string]*UserToken) TokenStore {
+	m := &memoryTokenStore{tokens: make(map[string]*UserToken)}
+	for userID, token := range tokens {
+		m.tokens[userID] = token
+	}
+	return m
+}
+
+func (m *memoryTokenStore) ListUsers(ctx context.Context) ([]string, glitch.DataError) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	ret := make([]string, 0, len(m.tokens))
+	for userID := range m.tokens {
+		ret = append(ret, userID)
+	}
+	sort.Strings(ret)
+	return ret, nil
+}
+
+func (m *memoryTokenStore) GetToken(ctx context.Context, userID string) (*UserToken, glitch.DataError) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.tokens[userID], nil
+}
+
+func (m *memoryTokenStore) SaveToken(ctx context.Context, userID string, token *UserToken) glitch.DataError {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.tokens[userID] = token
+	return nil
+}
@@ -0,0 +1,246 @@
+package dexcom
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/healthimation/go-glitch/glitch"
+)
+
+type testSyncer struct {
+	mu     sync.Mutex
+	synced []string
+}
+
+func (s *testSyncer) Sync(ctx context.Context, userID, accessToken string) (*SyncResult, glitch.DataError) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.synced = append(s.synced, userID)
+	return &SyncResult{UserID: userID, End: time.Date(2017, 6, 17, 0, 0, 0, 0, time.UTC)}, nil
+}
+
+func TestUnit_SchedulerRun(t *testing.T) {
+	now := time.Date(2017, 6, 17, 0, 0, 0, 0, time.UTC)
+	expired := now.Add(-time.Minute)
+	valid := now.Add(time.Hour)
+
+	c, ts := testClient(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprint(w, `{"error": "invalid_grant"}`)
+	}), 5*time.Second)
+	defer ts.Close()
+
+	tokens := NewMemoryTokenStore(map[string]*UserToken{
+		"good":    &UserToken{AccessToken: "a", ExpireTime: &valid},
+		"revoked": &UserToken{AccessToken: "b", RefreshToken: "r", ExpireTime: &expired},
+	})
+	syncer := &testSyncer{}
+	s := NewScheduler(c, syncer, tokens, NewMemoryCheckpointStore(), "uri", 2).(*scheduler)
+	s.now = func() time.Time { return now }
+
+	type testcase struct {
+		name            string
+		expectedSynced  int
+		expectedCode    string
+		expectedSkipped bool
+		expectedFails   int
+	}
+
+	testcases := []testcase{
+		{name: "first run", expectedSynced: 1, expectedCode: ErrorInvalidGrant, expectedFails: 1},
+		{name: "second run backs off", expectedSynced: 2, expectedCode: ErrorInvalidGrant, expectedSkipped: true, expectedFails: 1},
+	}
+
+	for _, tc := range testcases {
+		t.Run(tc.name, func(t *testing.T) {
+			var progressed int
+			statuses, err := s.Run(context.Background(), func(UserStatus) { progressed++ })
+			if err != nil {
+				t.Fatalf("Unexpected error occurred (%#v)", err)
+			}
+			if progressed != len(statuses) || len(statuses) != 2 {
+				t.Fatalf("Actual progress calls (%d) did not match statuses (%d)", progressed, len(statuses))
+			}
+			if len(syncer.synced) != tc.expectedSynced {
+				t.Fatalf("Actual syncs (%d) did not match expected (%d)", len(syncer.synced), tc.expectedSynced)
+			}
+			for _, status := range s.Status() {
+				if status.UserID != "revoked" {
+					continue
+				}
+				if status.ErrorCode != tc.expectedCode || status.Skipped != tc.expectedSkipped || status.GrantFailures != tc.expectedFails {
+					t.Fatalf("Actual status (%#v) did not match expected", status)
+				}
+				if !status.NextAttempt.Equal(now.Add(minGrantBackoff)) {
+					t.Fatalf("Actual next attempt (%s) did not match expected (%s)", status.NextAttempt, now.Add(minGrantBackoff))
+				}
+			}
+		})
+	}
+
+	// a drained run starts no syncs
+	drain := make(chan struct{})
+	close(drain)
+	statuses, err := s.Run(WithDrain(context.Background(), drain), nil)
+	if err == nil || err.Code() != ErrorCanceled || len(statuses) != 0 || len(syncer.synced) != 2 {
+		t.Fatalf("Actual drained run (%d statuses, %d syncs, %v) did not match expected (0, 2, %s)", len(statuses), len(syncer.synced), err, ErrorCanceled)
+	}
+}
+
+func TestUnit_SchedulerPrioritize(t *testing.T) {
+	now := time.Date(2017, 6, 17, 0, 0, 0, 0, time.UTC)
+	ctx := context.Background()
+
+	checkpoints := NewMemoryCheckpointStore()
+	// synced before a restart, only the checkpoint store knows about them
+	checkpoints.SaveCheckpoint(ctx, "week", now.Add(-7*24*time.Hour))
+	checkpoints.SaveCheckpoint(ctx, "hour", now.Add(-time.Hour))
+	s := NewScheduler(nil, &testSyncer{}, NewMemoryTokenStore(nil), checkpoints, "uri", 1).(*scheduler)
+	s.now = func() time.Time { return now }
+	// synced by this scheduler: a day ago, after the device's last upload, and an hour ago with an active and an idle
+	// device, which are ordered by last upload behind hour, whose last upload isn't known
+	s.setStatus(UserStatus{UserID: "day", Checkpoint: now.Add(-24 * time.Hour), LastUploadDate: now.Add(-25 * time.Hour)})
+	s.setStatus(UserStatus{UserID: "idle", Checkpoint: now.Add(-time.Hour), LastUploadDate: now.Add(-30 * 24 * time.Hour)})
+	s.setStatus(UserStatus{UserID: "active", Checkpoint: now.Add(-time.Hour), LastUploadDate: now.Add(-2 * time.Hour)})
+
+	expected := []string{"new", "week", "day", "hour", "active", "idle"}
+	actual := s.prioritize(ctx, []string{"idle", "hour", "active", "day", "week", "new"})
+	if !reflect.DeepEqual(actual, expected) {
+		t.Fatalf("Actual order (%v) did not match expected (%v)", actual, expected)
+	}
+}
+
+func TestUnit_RefreshToken(t *testing.T) {
+	now := time.Date(2017, 6, 17, 0, 0, 0, 0, time.UTC)
+	expired := now.Add(-time.Minute)
+
+	var mu sync.Mutex
+	var tokens TokenStore
+	refreshes := 0
+	c, ts := testClient(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		refreshes++
+		r.ParseForm()
+		switch r.PostForm.Get(paramRefreshToken) {
+		case "r1":
+			fmt.Fprint(w, `{"access_token": "fresh", "refresh_token": "r2", "expires_in": 7200}`)
+		case "used-elsewhere":
+			// another process refreshes first and saves its token before this request is answered
+			tokens.SaveToken(context.Background(), "user", &UserToken{AccessToken: "other", RefreshToken: "r3"})
+			w.WriteHeader(http.StatusBadRequest)
+			fmt.Fprint(w, `{"error": "invalid_grant"}`)
+		default:
+			w.WriteHeader(http.StatusBadRequest)
+			fmt.Fprint(w, `{"error": "invalid_grant"}`)
+		}
+	}), 5*time.Second)
+	defer ts.Close()
+
+	type testcase struct {
+		name              string
+		refreshToken      string
+		callers           int
+		expectedAccess    string
+		expectedRefreshes int
+		expectedErrCode   string
+	}
+
+	testcases := []testcase{
+		{name: "concurrent callers refresh once", refreshToken: "r1", callers: 5, expectedAccess: "fresh", expectedRefreshes: 1},
+		{name: "refreshed by another process", refreshToken: "used-elsewhere", callers: 1, expectedAccess: "other", expectedRefreshes: 1},
+		{name: "revoked", refreshToken: "revoked", callers: 1, expectedRefreshes: 1, expectedErrCode: ErrorInvalidGrant},
+	}
+
+	for _, tc := range testcases {
+		t.Run(tc.name, func(t *testing.T) {
+			refreshes = 0
+			tokens = NewMemoryTokenStore(map[string]*UserToken{"user": {AccessToken: "stale", RefreshToken: tc.refreshToken, ExpireTime: &expired}})
+			var wg sync.WaitGroup
+			results := make([]*UserToken, tc.callers)
+			errs := make([]glitch.DataError, tc.callers)
+			for i := 0; i < tc.callers; i++ {
+				wg.Add(1)
+				go func(i int) {
+					defer wg.Done()
+					results[i], errs[i] = currentToken(context.Background(), c, tokens, "user", "uri", now)
+				}(i)
+			}
+			wg.Wait()
+
+			if refreshes != tc.expectedRefreshes {
+				t.Fatalf("Actual refreshes (%d) did not match expected (%d)", refreshes, tc.expectedRefreshes)
+			}
+			for i := range results {
+				if tc.expectedErrCode != "" {
+					if errs[i] == nil || errs[i].Code() != tc.expectedErrCode {
+						t.Fatalf("Actual error (%v) did not match expected (%s)", errs[i], tc.expectedErrCode)
+					}
+					continue
+				}
+				if errs[i] != nil {
+					t.Fatalf("Unexpected error occurred (%#v)", errs[i])
+				}
+				if results[i].AccessToken != tc.expectedAccess {
+					t.Fatalf("Actual access token (%s) did not match expected (%s)", results[i].AccessToken, tc.expectedAccess)
+				}
+			}
+		})
+	}
+}
+
+// devicesSyncer syncs by fetching devices, so the api's answer to the access token decides the outcome
+type devicesSyncer struct {
+	c Client
+}
+
+func (s *devicesSyncer) Sync(ctx context.Context, userID, accessToken string) (*SyncResult, glitch.DataError) {
+	now := time.Date(2017, 6, 17, 0, 0, 0, 0, time.UTC)
+	if _, err := s.c.GetDevices(ctx, accessToken, now.Add(-time.Hour), now); err != nil {
+		return nil, err
+	}
+	return &SyncResult{UserID: userID, End: now}, nil
+}
+
+func TestUnit_SchedulerRetry(t *testing.T) {
+	now := time.Date(2017, 6, 17, 0, 0, 0, 0, time.UTC)
+	valid := now.Add(time.Hour)
+
+	c, ts := testClient(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasSuffix(r.URL.Path, "token") {
+			fmt.Fprint(w, `{"access_token": "fresh", "refresh_token": "rotated", "expires_in": 7200}`)
+			return
+		}
+		if r.Header.Get("authorization") != "Bearer fresh" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		fmt.Fprint(w, `{"devices": []}`)
+	}), 5*time.Second)
+	defer ts.Close()
+
+	// the token is rejected before it expires, so it is refreshed and the sync repeated once
+	tokens := NewMemoryTokenStore(map[string]*UserToken{"user": &UserToken{AccessToken: "revoked", RefreshToken: "r", ExpireTime: &valid}})
+	s := NewScheduler(c, &devicesSyncer{c: c}, tokens, nil, "uri", 1).(*scheduler)
+	s.now = func() time.Time { return now }
+	m := &testMetrics{}
+	statuses, err := s.Run(WithMetrics(context.Background(), m), nil)
+	if err != nil {
+		t.Fatalf("Unexpected error occurred (%#v)", err)
+	}
+	if len(statuses) != 1 || statuses[0].Error != "" {
+		t.Fatalf("Actual statuses (%#v) did not match expected (one success)", statuses)
+	}
+	if retries := m.count("retry " + OperationSync); retries != 1 {
+		t.Fatalf("Actual retries (%d) did not match expected (1)", retries)
+	}
+	if token, _ := tokens.GetToken(context.Background(), "user"); token.AccessToken != "fresh" {
+		t.Fatalf("Actual access token (%s) did not match expected (fresh)", token.AccessToken)
+	}
+}
@@ -0,0 +1,74 @@
+package dexcom
+
+import (
+	"context"
+	"iter"
+	"sort"
+	"time"
+
+	"github.com/healthimation/go-glitch/glitch"
+)
+
+// egvSeqWindow is the window EGVsSeq fetches, so sorting a window holds at most a day of egvs rather than MaxRange's
+const egvSeqWindow = 24 * time.Hour
+
+// EGVsSeq walks the egvs in [startDate, endDate), however long, fetching one day at a time as the loop reaches it.  The
+// api sends each window newest first, so the window is sorted and the sequence runs oldest first throughout.  Egvs are
+// streamed when c supports it, so the response body is never held, only the decoded day.  An error is yielded with a
+// zero EGV and ends the sequence.  Breaking out of the loop stops any further requests.
+func EGVsSeq(ctx context.Context, c Client, accessToken string, startDate, endDate time.Time) iter.Seq2[EGV, error] {
+	return windowSeq(startDate, endDate, egvSeqWindow, func(w timeWindow) ([]EGV, glitch.DataError) {
+		var egvs []EGV
+		err := StreamEGVs(ctx, c, accessToken, w.start, w.end, func(egv EGV) error {
+			egvs = append(egvs, egv)
+			return nil
+		})
+		return egvs, err
+	}, func(e EGV) string { return e.SystemTime })
+}
+
+// EventsSeq walks the events in [startDate, endDate) like EGVsSeq, oldest first.  Events are sparse, so it fetches
+// MaxRange at a time.
+func EventsSeq(ctx context.Context, c Client, accessToken string, startDate, endDate time.Time) iter.Seq2[Event, error] {
+	return windowSeq(startDate, endDate, MaxRange, func(w timeWindow) ([]Event, glitch.DataError) {
+		resp, err := c.GetEvents(ctx, accessToken, w.start, w.end)
+		if err != nil {
+			return nil, err
+		}
+		return resp.Events, nil
+	}, func(e Event) string { return e.SystemTime })
+}
+
+// CalibrationsSeq walks the calibrations in [startDate, endDate) like EventsSeq, oldest first
+func CalibrationsSeq(ctx context.Context, c Client, accessToken string, startDate, endDate time.Time) iter.Seq2[Calibration, error] {
+	return windowSeq(startDate, endDate, MaxRange, func(w timeWindow) ([]Calibration, glitch.DataError) {
+		resp, err := GetCalibrations(ctx, c, accessToken, w.start, w.end)
+		if err != nil {
+			return nil, err
+		}
+		return resp.Calibrations, nil
+	}, func(c Calibration) string { return c.SystemTime })
+}
+
+// windowSeq yields the records fetched for each window of the range sorted by systemTime, fetching a window only once
+// the previous one is used up
+func windowSeq[T any](startDate, endDate time.Time, window time.Duration, fetch func(w timeWindow) ([]T, glitch.DataError), systemTime func(T) string) iter.Seq2[T, error] {
+	return func(yield func(T, error) bool) {
+		for _, w := range splitRange(startDate, endDate, window) {
+			records, err := fetch(w)
+			if err != nil {
+				var zero T
+				yield(zero, err)
+				return
+			}
+			sort.SliceStable(records, func(i, j int) bool {
+				return compareTimes(systemTime(records[i]), systemTime(records[j])) < 0
+			})
+			for _, r := range records {
+				if !yield(r, nil) {
+					return
+				}
+			}
+		}
+	}
+}
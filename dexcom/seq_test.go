@@ -0,0 +1,123 @@
+package dexcom
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/healthimation/go-glitch/glitch"
+)
+
+func TestUnit_Seq(t *testing.T) {
+	var mu sync.Mutex
+	var requests []string
+	c, ts := testClient(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := r.URL.Query().Get(paramStartDate)
+		mu.Lock()
+		requests = append(requests, start)
+		mu.Unlock()
+		if start != "2017-01-01T00:00:00" && r.Header.Get("authorization") == "Bearer expired" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		// like the api, each window is sent newest first
+		later := strings.Replace(start, "T00:00:00", "T00:05:00", 1)
+		if strings.HasSuffix(r.URL.Path, "events") {
+			fmt.Fprintf(w, `{"events": [{"eventType": "carbs", "systemTime": "%s"}, {"eventType": "exercise", "systemTime": "%s"}]}`, later, start)
+			return
+		}
+		fmt.Fprintf(w, `{"unit": "mg/dL", "egvs": [{"systemTime": "%s", "value": 101}, {"systemTime": "%s", "value": 100}]}`, later, start)
+	}), 5*time.Second)
+	defer ts.Close()
+	start := time.Date(2017, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	type testcase struct {
+		name             string
+		token            string
+		days             int
+		limit            int
+		events           bool
+		expected         []string
+		expectedRequests []string
+		expectedErrCode  string
+	}
+
+	testcases := []testcase{
+		{
+			name:             "every window",
+			token:            "token",
+			days:             3,
+			expected:         []string{"2017-01-01T00:00:00/100", "2017-01-01T00:05:00/101", "2017-01-02T00:00:00/100", "2017-01-02T00:05:00/101", "2017-01-03T00:00:00/100", "2017-01-03T00:05:00/101"},
+			expectedRequests: []string{"2017-01-01T00:00:00", "2017-01-02T00:00:00", "2017-01-03T00:00:00"},
+		},
+		{
+			name:             "break",
+			token:            "token",
+			days:             200,
+			limit:            3,
+			expected:         []string{"2017-01-01T00:00:00/100", "2017-01-01T00:05:00/101", "2017-01-02T00:00:00/100"},
+			expectedRequests: []string{"2017-01-01T00:00:00", "2017-01-02T00:00:00"},
+		},
+		{
+			name:             "error ends the sequence",
+			token:            "expired",
+			days:             3,
+			expected:         []string{"2017-01-01T00:00:00/100", "2017-01-01T00:05:00/101"},
+			expectedRequests: []string{"2017-01-01T00:00:00", "2017-01-02T00:00:00"},
+			expectedErrCode:  ErrorUnauthorized,
+		},
+		{
+			name:             "events",
+			token:            "token",
+			days:             200,
+			limit:            3,
+			events:           true,
+			expected:         []string{"2017-01-01T00:00:00/exercise", "2017-01-01T00:05:00/carbs", "2017-04-01T00:00:00/exercise"},
+			expectedRequests: []string{"2017-01-01T00:00:00", "2017-04-01T00:00:00"},
+		},
+	}
+
+	for _, test := range testcases {
+		requests = nil
+		end := start.Add(time.Duration(test.days) * 24 * time.Hour)
+		var actual []string
+		errCode := ""
+		if test.events {
+			for event, err := range EventsSeq(context.Background(), c, test.token, start, end) {
+				if err != nil {
+					errCode = err.(glitch.DataError).Code()
+					break
+				}
+				actual = append(actual, event.SystemTime+"/"+event.EventType)
+				if len(actual) == test.limit {
+					break
+				}
+			}
+		} else {
+			for egv, err := range EGVsSeq(context.Background(), c, test.token, start, end) {
+				if err != nil {
+					errCode = err.(glitch.DataError).Code()
+					break
+				}
+				actual = append(actual, fmt.Sprintf("%s/%v", egv.SystemTime, egv.Value))
+				if len(actual) == test.limit {
+					break
+				}
+			}
+		}
+		if !reflect.DeepEqual(actual, test.expected) {
+			t.Fatalf("[%s] Actual records (%v) did not match expected (%v)", test.name, actual, test.expected)
+		}
+		if !reflect.DeepEqual(requests, test.expectedRequests) {
+			t.Fatalf("[%s] Actual requests (%v) did not match expected (%v)", test.name, requests, test.expectedRequests)
+		}
+		if errCode != test.expectedErrCode {
+			t.Fatalf("[%s] Actual error code (%s) did not match expected (%s)", test.name, errCode, test.expectedErrCode)
+		}
+	}
+}
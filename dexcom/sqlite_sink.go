@@ -0,0 +1,274 @@
+package dexcom
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/healthimation/go-glitch/glitch"
+)
+
+// sqliteMigrations are applied in order, each exactly once.  Never edit a migration that has shipped, append a new one.
+var sqliteMigrations = []string{
+	`CREATE TABLE egvs (
+		user_id      TEXT NOT NULL,
+		record_key   TEXT NOT NULL,
+		record_id    TEXT NOT NULL DEFAULT '',
+		system_time  TEXT NOT NULL,
+		display_time TEXT NOT NULL,
+		value        REAL NOT NULL,
+		status       TEXT,
+		trend        TEXT,
+		trend_rate   REAL,
+		PRIMARY KEY (user_id, record_key)
+	);
+	CREATE INDEX egvs_user_time ON egvs (user_id, system_time);
+
+	CREATE TABLE events (
+		user_id        TEXT NOT NULL,
+		record_key     TEXT NOT NULL,
+		record_id      TEXT NOT NULL DEFAULT '',
+		system_time    TEXT NOT NULL,
+		display_time   TEXT NOT NULL,
+		event_type     TEXT NOT NULL,
+		event_sub_type TEXT NOT NULL,
+		value          REAL NOT NULL,
+		unit           TEXT NOT NULL,
+		PRIMARY KEY (user_id, record_key)
+	);
+	CREATE INDEX events_user_time ON events (user_id, system_time);
+
+	CREATE TABLE devices (
+		user_id          TEXT NOT NULL,
+		model            TEXT NOT NULL,
+		last_upload_date TEXT NOT NULL,
+		PRIMARY KEY (user_id, model)
+	);
+
+	CREATE TABLE alert_settings (
+		user_id      TEXT NOT NULL,
+		model        TEXT NOT NULL,
+		alert_name   TEXT NOT NULL,
+		value        REAL NOT NULL,
+		unit         TEXT NOT NULL,
+		snooze       INTEGER NOT NULL,
+		delay        INTEGER NOT NULL,
+		enabled      INTEGER NOT NULL,
+		system_time  TEXT NOT NULL,
+		display_time TEXT NOT NULL,
+		PRIMARY KEY (user_id, model, alert_name),
+		FOREIGN KEY (user_id, model) REFERENCES devices (user_id, model) ON DELETE CASCADE
+	);
+
+	CREATE TABLE calibrations (
+		user_id      TEXT NOT NULL,
+		record_key   TEXT NOT NULL,
+		record_id    TEXT NOT NULL DEFAULT '',
+		system_time  TEXT NOT NULL,
+		display_time TEXT NOT NULL,
+		value        REAL NOT NULL,
+		unit         TEXT NOT NULL,
+		PRIMARY KEY (user_id, record_key)
+	);
+
+	CREATE TABLE statistics (
+		user_id                 TEXT NOT NULL,
+		start_date              TEXT NOT NULL,
+		end_date                TEXT NOT NULL,
+		hypoglycemia_risk       TEXT NOT NULL,
+		min                     REAL NOT NULL,
+		max                     REAL NOT NULL,
+		mean                    REAL NOT NULL,
+		median                  REAL NOT NULL,
+		variance                REAL NOT NULL,
+		std_dev                 REAL NOT NULL,
+		sum                     REAL NOT NULL,
+		q1                      REAL NOT NULL,
+		q2                      REAL NOT NULL,
+		q3                      REAL NOT NULL,
+		utilization_percent     REAL NOT NULL,
+		mean_daily_calibrations REAL NOT NULL,
+		n_days                  INTEGER NOT NULL,
+		n_values                INTEGER NOT NULL,
+		n_below_range           INTEGER NOT NULL,
+		n_within_range          INTEGER NOT NULL,
+		n_above_range           INTEGER NOT NULL,
+		percent_below_range     REAL NOT NULL,
+		percent_within_range    REAL NOT NULL,
+		percent_above_range     REAL NOT NULL,
+		PRIMARY KEY (user_id, start_date, end_date)
+	);`,
+}
+
+const (
+	sqliteUpsertEGV = `INSERT INTO egvs (user_id, record_key, record_id, system_time, display_time, value, status, trend, trend_rate)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)
+		ON CONFLICT (user_id, record_key) DO UPDATE SET record_id = excluded.record_id, system_time = excluded.system_time,
+			display_time = excluded.display_time, value = excluded.value, status = excluded.status, trend = excluded.trend,
+			trend_rate = excluded.trend_rate`
+
+	sqliteUpsertEvent = `INSERT INTO events (user_id, record_key, record_id, system_time, display_time, event_type, event_sub_type, value, unit)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)
+		ON CONFLICT (user_id, record_key) DO UPDATE SET record_id = excluded.record_id, system_time = excluded.system_time,
+			display_time = excluded.display_time, event_type = excluded.event_type, event_sub_type = excluded.event_sub_type,
+			value = excluded.value, unit = excluded.unit`
+
+	sqliteUpsertDevice = `INSERT INTO devices (user_id, model, last_upload_date) VALUES (?, ?, ?)
+		ON CONFLICT (user_id, model) DO UPDATE SET last_upload_date = excluded.last_upload_date`
+
+	sqliteDeleteAlertSettings = `DELETE FROM alert_settings WHERE user_id = ? AND model = ?`
+
+	sqliteInsertAlertSetting = `INSERT INTO alert_settings (user_id, model, alert_name, value, unit, snooze, delay, enabled, system_time, display_time)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`
+
+	sqliteUpsertCalibration = `INSERT INTO calibrations (user_id, record_key, record_id, system_time, display_time, value, unit)
+		VALUES (?, ?, ?, ?, ?, ?, ?)
+		ON CONFLICT (user_id, record_key) DO UPDATE SET record_id = excluded.record_id, system_time = excluded.system_time,
+			display_time = excluded.display_time, value = excluded.value, unit = excluded.unit`
+
+	sqliteUpsertStatistics = `INSERT OR REPLACE INTO statistics (user_id, start_date, end_date, hypoglycemia_risk, min, max, mean, median,
+			variance, std_dev, sum, q1, q2, q3, utilization_percent, mean_daily_calibrations, n_days, n_values, n_below_range,
+			n_within_range, n_above_range, percent_below_range, percent_within_range, percent_above_range)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`
+)
+
+type sqliteSink struct {
+	db *sql.DB
+}
+
+// NewSQLiteSink returns a Sink backed by db, which must have been opened with a sqlite driver registered by the
+// caller (e.g. github.com/mattn/go-sqlite3 or modernc.org/sqlite).  Pending schema migrations are applied first.
+func NewSQLiteSink(ctx context.Context, db *sql.DB) (Sink, glitch.DataError) {
+	if err := migrateSQLite(ctx, db); err != nil {
+		return nil, err
+	}
+	return &sqliteSink{db: db}, nil
+}
+
+func migrateSQLite(ctx context.Context, db *sql.DB) glitch.DataError {
+	if _, err := db.ExecContext(ctx, `CREATE TABLE IF NOT EXISTS schema_migrations (version INTEGER PRIMARY KEY, applied_at TEXT NOT NULL)`); err != nil {
+		return glitch.NewDataError(err, ErrorStorage, "Could not create schema_migrations")
+	}
+
+	var current int
+	if err := db.QueryRowContext(ctx, `SELECT COALESCE(MAX(version), 0) FROM schema_migrations`).Scan(&current); err != nil {
+		return glitch.NewDataError(err, ErrorStorage, "Could not read schema version")
+	}
+
+	for i := current; i < len(sqliteMigrations); i++ {
+		version := i + 1
+		err := withTx(ctx, db, func(tx *sql.Tx) error {
+			if _, err := tx.ExecContext(ctx, sqliteMigrations[i]); err != nil {
+				return err
+			}
+			_, err := tx.ExecContext(ctx, `INSERT INTO schema_migrations (version, applied_at) VALUES (?, ?)`, version, FormatTime(time.Now()))
+			return err
+		})
+		if err != nil {
+			return glitch.NewDataError(err, ErrorStorage, fmt.Sprintf("Could not apply migration %d", version))
+		}
+	}
+	return nil
+}
+
+func (s *sqliteSink) UpsertEGVs(ctx context.Context, userID string, egvs []EGV) glitch.DataError {
+	return s.batch(ctx, "egvs", sqliteUpsertEGV, len(egvs), func(stmt *sql.Stmt, i int) error {
+		e := egvs[i]
+		_, err := stmt.ExecContext(ctx, userID, egvKey(e), e.RecordID, e.SystemTime, e.DisplayTime, e.Value, e.Status, e.Trend, e.TrendRate)
+		return err
+	})
+}
+
+func (s *sqliteSink) UpsertEvents(ctx context.Context, userID string, events []Event) glitch.DataError {
+	return s.batch(ctx, "events", sqliteUpsertEvent, len(events), func(stmt *sql.Stmt, i int) error {
+		e := events[i]
+		_, err := stmt.ExecContext(ctx, userID, eventKey(e), e.RecordID, e.SystemTime, e.DisplayTime, e.EventType, e.EventSubType, e.Value, e.Unit)
+		return err
+	})
+}
+
+func (s *sqliteSink) UpsertDevices(ctx context.Context, userID string, devices []Device) glitch.DataError {
+	if len(devices) == 0 {
+		return nil
+	}
+	err := withTx(ctx, s.db, func(tx *sql.Tx) error {
+		for _, d := range devices {
+			if _, err := tx.ExecContext(ctx, sqliteUpsertDevice, userID, d.Model, d.LastUploadDate); err != nil {
+				return err
+			}
+			// alert settings are replaced wholesale so removed alerts do not linger
+			if _, err := tx.ExecContext(ctx, sqliteDeleteAlertSettings, userID, d.Model); err != nil {
+				return err
+			}
+			for _, a := range d.AlertSettings {
+				_, err := tx.ExecContext(ctx, sqliteInsertAlertSetting, userID, d.Model, a.AlertName, a.Value, a.Unit, a.Snooze, a.Delay, a.Enabled, a.SystemTime, a.DisplayTime)
+				if err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return glitch.NewDataError(err, ErrorStorage, "Could not upsert devices")
+	}
+	return nil
+}
+
+func (s *sqliteSink) UpsertCalibrations(ctx context.Context, userID string, calibrations []Calibration) glitch.DataError {
+	return s.batch(ctx, "calibrations", sqliteUpsertCalibration, len(calibrations), func(stmt *sql.Stmt, i int) error {
+		c := calibrations[i]
+		_, err := stmt.ExecContext(ctx, userID, calibrationKey(c), c.RecordID, c.SystemTime, c.DisplayTime, c.Value, c.Unit)
+		return err
+	})
+}
+
+func (s *sqliteSink) UpsertStatistics(ctx context.Context, userID string, startDate, endDate time.Time, stats *Statistics) glitch.DataError {
+	if stats == nil {
+		return nil
+	}
+	return s.batch(ctx, "statistics", sqliteUpsertStatistics, 1, func(stmt *sql.Stmt, i int) error {
+		_, err := stmt.ExecContext(ctx, userID, FormatTime(startDate), FormatTime(endDate), stats.HypoglycemiaRisk, stats.Min, stats.Max,
+			stats.Mean, stats.Median, stats.Variance, stats.StdDev, stats.Sum, stats.Q1, stats.Q2, stats.Q3, stats.UtilizationPercent,
+			stats.MeanDailyCalibrations, stats.NDays, stats.NValues, stats.NBelowRange, stats.NWithinRange, stats.NAboveRange,
+			stats.PercentBelowRange, stats.PercentWithinRange, stats.PercentAboveRange)
+		return err
+	})
+}
+
+// batch runs exec for each of n records using one prepared statement inside a single transaction
+func (s *sqliteSink) batch(ctx context.Context, table, query string, n int, exec func(stmt *sql.Stmt, i int) error) glitch.DataError {
+	if n == 0 {
+		return nil
+	}
+	err := withTx(ctx, s.db, func(tx *sql.Tx) error {
+		stmt, err := tx.PrepareContext(ctx, query)
+		if err != nil {
+			return err
+		}
+		defer stmt.Close()
+		for i := 0; i < n; i++ {
+			if err := exec(stmt, i); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return glitch.NewDataError(err, ErrorStorage, fmt.Sprintf("Could not upsert %s", table))
+	}
+	return nil
+}
+
+func withTx(ctx context.Context, db *sql.DB, fn func(tx *sql.Tx) error) error {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	if err := fn(tx); err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
@@ -0,0 +1,190 @@
+//go:build sqlite
+
+// The sqlite sink is tested against a real driver, which is not vendored.  Run with:
+//
+//	go get github.com/mattn/go-sqlite3
+//	go test -tags sqlite ./dexcom
+package dexcom
+
+import (
+	"context"
+	"database/sql"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	_ "github.com/mattn/go-sqlite3"
+)
+
+func openTestSQLite(t *testing.T) *sql.DB {
+	// a file rather than :memory: so every pooled connection sees the same database
+	db, err := sql.Open("sqlite3", filepath.Join(t.TempDir(), "dexcom.db")+"?_foreign_keys=on")
+	if err != nil {
+		t.Fatalf("Unexpected error occurred (%#v)", err)
+	}
+	t.Cleanup(func() { db.Close() })
+	return db
+}
+
+func TestUnit_SQLiteSinkMigrations(t *testing.T) {
+	db := openTestSQLite(t)
+	ctx := context.Background()
+
+	// a second sink on the same database must not re-apply the migrations
+	for i := 0; i < 2; i++ {
+		if _, err := NewSQLiteSink(ctx, db); err != nil {
+			t.Fatalf("Unexpected error occurred on open %d (%#v)", i, err)
+		}
+	}
+	var versions, latest int
+	if err := db.QueryRow(`SELECT COUNT(*), MAX(version) FROM schema_migrations`).Scan(&versions, &latest); err != nil {
+		t.Fatalf("Unexpected error occurred (%#v)", err)
+	}
+	if versions != len(sqliteMigrations) || latest != len(sqliteMigrations) {
+		t.Fatalf("Actual migrations (%d, latest %d) did not match expected (%d)", versions, latest, len(sqliteMigrations))
+	}
+}
+
+func TestUnit_SQLiteSink(t *testing.T) {
+	db := openTestSQLite(t)
+	ctx := context.Background()
+	s, derr := NewSQLiteSink(ctx, db)
+	if derr != nil {
+		t.Fatalf("Unexpected error occurred (%#v)", derr)
+	}
+
+	// the second batch re-sends the 15:45 reading, with a record id and a new value, and a reading for another user
+	egvBatches := []struct {
+		userID string
+		egvs   []EGV
+	}{
+		{userID: "user", egvs: []EGV{
+			EGV{SystemTime: "2017-06-16T15:40:00", DisplayTime: "2017-06-16T08:40:00", Value: 119, Trend: makeStrPtr("flat"), TrendRate: makeFloat64Ptr(-0.2)},
+			EGV{SystemTime: "2017-06-16T15:45:00", DisplayTime: "2017-06-16T08:45:00", Value: 40, Status: makeStrPtr(StatusLow)},
+		}},
+		{userID: "user", egvs: []EGV{EGV{RecordID: "r2", SystemTime: "2017-06-16T15:45:00", DisplayTime: "2017-06-16T08:45:00", Value: 42}}},
+		{userID: "other", egvs: []EGV{EGV{SystemTime: "2017-06-16T15:45:00", DisplayTime: "2017-06-16T08:45:00", Value: 200}}},
+	}
+	for _, batch := range egvBatches {
+		if err := s.UpsertEGVs(ctx, batch.userID, batch.egvs); err != nil {
+			t.Fatalf("Unexpected error occurred (%#v)", err)
+		}
+	}
+
+	type egvRow struct {
+		RecordID  string
+		Time      string
+		Value     float64
+		Status    sql.NullString
+		TrendRate sql.NullFloat64
+	}
+	rows, err := db.Query(`SELECT record_id, system_time, value, status, trend_rate FROM egvs WHERE user_id = ? ORDER BY system_time`, "user")
+	if err != nil {
+		t.Fatalf("Unexpected error occurred (%#v)", err)
+	}
+	var egvs []egvRow
+	for rows.Next() {
+		var r egvRow
+		if err := rows.Scan(&r.RecordID, &r.Time, &r.Value, &r.Status, &r.TrendRate); err != nil {
+			t.Fatalf("Unexpected error occurred (%#v)", err)
+		}
+		egvs = append(egvs, r)
+	}
+	rows.Close()
+	expectedEGVs := []egvRow{
+		{Time: "2017-06-16T15:40:00", Value: 119, TrendRate: sql.NullFloat64{Float64: -0.2, Valid: true}},
+		{RecordID: "r2", Time: "2017-06-16T15:45:00", Value: 42},
+	}
+	if !reflect.DeepEqual(egvs, expectedEGVs) {
+		t.Fatalf("Actual egvs (%#v) did not match expected (%#v)", egvs, expectedEGVs)
+	}
+
+	events := []Event{
+		Event{SystemTime: "2017-06-16T19:45:00", DisplayTime: "2017-06-16T12:45:00", EventType: "exercise", EventSubType: "medium", Value: 42, Unit: "minutes"},
+		Event{SystemTime: "2017-06-16T19:45:00", DisplayTime: "2017-06-16T12:45:00", EventType: "insulin", EventSubType: "fastActing", Value: 4.5, Unit: "units"},
+	}
+	for i := 0; i < 2; i++ {
+		if err := s.UpsertEvents(ctx, "user", events); err != nil {
+			t.Fatalf("Unexpected error occurred (%#v)", err)
+		}
+	}
+	assertSQLiteCount(t, db, "events", 2)
+
+	calibrations := []Calibration{Calibration{SystemTime: "2017-06-16T15:40:00", DisplayTime: "2017-06-16T08:40:00", Value: 120, Unit: "mg/dL"}}
+	for i := 0; i < 2; i++ {
+		if err := s.UpsertCalibrations(ctx, "user", calibrations); err != nil {
+			t.Fatalf("Unexpected error occurred (%#v)", err)
+		}
+	}
+	assertSQLiteCount(t, db, "calibrations", 1)
+
+	start := time.Date(2017, 6, 1, 0, 0, 0, 0, time.UTC)
+	for _, mean := range []float64{120, 130} {
+		if err := s.UpsertStatistics(ctx, "user", start, start.Add(24*time.Hour), &Statistics{Mean: mean, NValues: 288, HypoglycemiaRisk: "low"}); err != nil {
+			t.Fatalf("Unexpected error occurred (%#v)", err)
+		}
+	}
+	var mean float64
+	var nValues int
+	if err := db.QueryRow(`SELECT mean, n_values FROM statistics WHERE user_id = ? AND start_date = ?`, "user", "2017-06-01T00:00:00").Scan(&mean, &nValues); err != nil {
+		t.Fatalf("Unexpected error occurred (%#v)", err)
+	}
+	if mean != 130 || nValues != 288 {
+		t.Fatalf("Actual statistics (%v, %d) did not match expected (130, 288)", mean, nValues)
+	}
+	assertSQLiteCount(t, db, "statistics", 1)
+}
+
+func TestUnit_SQLiteSinkDevices(t *testing.T) {
+	db := openTestSQLite(t)
+	ctx := context.Background()
+	s, derr := NewSQLiteSink(ctx, db)
+	if derr != nil {
+		t.Fatalf("Unexpected error occurred (%#v)", derr)
+	}
+
+	alerts := []AlertSetting{
+		AlertSetting{AlertName: AlertHigh, Value: 250, Unit: "mg/dL", Snooze: 120, Enabled: true},
+		AlertSetting{AlertName: "fixedLow", Value: 55, Unit: "mg/dL", Snooze: 30, Enabled: true},
+	}
+	batches := [][]Device{
+		[]Device{Device{Model: "G6 Mobile App", LastUploadDate: "2017-06-16T20:00:00", AlertSettings: alerts}},
+		// the high alert was removed on the device
+		[]Device{Device{Model: "G6 Mobile App", LastUploadDate: "2017-06-17T20:00:00", AlertSettings: alerts[1:]}},
+	}
+	for _, batch := range batches {
+		if err := s.UpsertDevices(ctx, "user", batch); err != nil {
+			t.Fatalf("Unexpected error occurred (%#v)", err)
+		}
+	}
+
+	var lastUpload string
+	if err := db.QueryRow(`SELECT last_upload_date FROM devices WHERE user_id = ?`, "user").Scan(&lastUpload); err != nil {
+		t.Fatalf("Unexpected error occurred (%#v)", err)
+	}
+	if lastUpload != "2017-06-17T20:00:00" {
+		t.Fatalf("Actual last upload (%s) did not match expected (2017-06-17T20:00:00)", lastUpload)
+	}
+	var name string
+	var enabled bool
+	if err := db.QueryRow(`SELECT alert_name, enabled FROM alert_settings WHERE user_id = ?`, "user").Scan(&name, &enabled); err != nil {
+		t.Fatalf("Unexpected error occurred (%#v)", err)
+	}
+	if name != "fixedLow" || !enabled {
+		t.Fatalf("Actual alert (%s, %v) did not match expected (fixedLow, true)", name, enabled)
+	}
+	assertSQLiteCount(t, db, "devices", 1)
+	assertSQLiteCount(t, db, "alert_settings", 1)
+}
+
+func assertSQLiteCount(t *testing.T, db *sql.DB, table string, expected int) {
+	t.Helper()
+	var actual int
+	if err := db.QueryRow(`SELECT COUNT(*) FROM ` + table).Scan(&actual); err != nil {
+		t.Fatalf("Unexpected error occurred (%#v)", err)
+	}
+	if actual != expected {
+		t.Fatalf("Actual %s rows (%d) did not match expected (%d)", table, actual, expected)
+	}
+}
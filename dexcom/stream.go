@@ -0,0 +1,198 @@
+package dexcom
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/healthimation/go-client/client"
+	"github.com/healthimation/go-glitch/glitch"
+)
+
+// ErrorCallback is returned when a stream callback fails with an error that isn't a glitch.DataError
+const ErrorCallback = "ERROR_CALLBACK"
+
+// EGVStreamer is implemented by clients that can decode egvs as the response arrives
+type EGVStreamer interface {
+	StreamEGVs(ctx context.Context, accessToken string, startDate, endDate time.Time, fn func(EGV) error) glitch.DataError
+}
+
+// StreamEGVs calls fn with each egv in the range.  Clients that implement EGVStreamer decode them one by one from the
+// response, other clients fetch them with GetEGVs first.
+func StreamEGVs(ctx context.Context, c Client, accessToken string, startDate, endDate time.Time, fn func(EGV) error) glitch.DataError {
+	if s, ok := c.(EGVStreamer); ok {
+		return s.StreamEGVs(ctx, accessToken, startDate, endDate, fn)
+	}
+	resp, err := c.GetEGVs(ctx, accessToken, startDate, endDate)
+	if err != nil {
+		return err
+	}
+	for _, egv := range resp.EGVs {
+		if err := fn(egv); err != nil {
+			return callbackError(err)
+		}
+	}
+	return nil
+}
+
+// streamer makes requests whose response body is read by the caller, which client.BaseClient can't do
+type streamer struct {
+	finder client.ServiceFinder
+	http   *http.Client
+}
+
+func newStreamer(finder client.ServiceFinder, timeout time.Duration) *streamer {
+	return &streamer{finder: finder, http: &http.Client{Timeout: timeout}}
+}
+
+func (s *streamer) do(ctx context.Context, method, slug string, query url.Values, headers http.Header) (*http.Response, glitch.DataError) {
+	u, err := s.finder("dexcom", true)
+	if err != nil {
+		return nil, glitch.NewDataError(err, client.ErrorCantFind, "Error finding service")
+	}
+	u.Path = slug
+	u.RawQuery = query.Encode()
+	req, err := http.NewRequestWithContext(ctx, method, u.String(), nil)
+	if err != nil {
+		return nil, glitch.NewDataError(err, client.ErrorRequestCreation, "Error creating request object")
+	}
+	req.Header = headers
+	resp, err := s.http.Do(req)
+	if err != nil {
+		return nil, glitch.NewDataError(err, client.ErrorRequestError, "Could not make the request")
+	}
+	return resp, nil
+}
+
+// StreamEGVs calls fn with each egv in the range as it is decoded from the response body, so the response is never
+// held in memory.  It stops at the first error from fn and returns it.
+func (d *dexcomClient) StreamEGVs(ctx context.Context, accessToken string, startDate, endDate time.Time, fn func(EGV) error) glitch.DataError {
+	slug := "/v1/users/self/egvs"
+	h := http.Header{}
+	h.Add("authorization", fmt.Sprintf("Bearer %s", accessToken))
+
+	q := url.Values{}
+	q.Set(paramStartDate, startDate.UTC().Format(timeformat))
+	q.Set(paramEndDate, endDate.UTC().Format(timeformat))
+
+	// without a streamer, e.g. when recording or replaying a cassette, the response is read whole first
+	if d.stream == nil {
+		statusCode, ret, err := d.request(ctx, EndpointGetEGVs, http.MethodGet, slug, q, h, nil)
+		if err != nil {
+			return err
+		}
+		if statusCode < 200 || statusCode >= 300 {
+			return apiError(statusCode, ret)
+		}
+		return decodeEGVs(ctx, bytes.NewReader(ret), fn)
+	}
+
+	start := time.Now()
+	resp, err := d.stream.do(ctx, http.MethodGet, slug, q, h)
+	if err != nil {
+		observe(ctx, EndpointGetEGVs, http.MethodGet, slug, q, h, nil, 0, nil, 0, time.Since(start), err)
+		return err
+	}
+	defer func() {
+		io.Copy(io.Discard, resp.Body)
+		resp.Body.Close()
+	}()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		ret, _ := io.ReadAll(resp.Body)
+		observe(ctx, EndpointGetEGVs, http.MethodGet, slug, q, h, nil, resp.StatusCode, ret, len(ret), time.Since(start), nil)
+		return apiError(resp.StatusCode, ret)
+	}
+
+	body := &countingReader{r: resp.Body}
+	err = decodeEGVs(ctx, body, fn)
+	observe(ctx, EndpointGetEGVs, http.MethodGet, slug, q, h, nil, resp.StatusCode, nil, body.n, time.Since(start), nil)
+	return err
+}
+
+// decodeEGVs decodes an egvs response one record at a time, skipping the other fields
+func decodeEGVs(ctx context.Context, r io.Reader, fn func(EGV) error) glitch.DataError {
+	dec := json.NewDecoder(r)
+	if err := expectDelim(dec, '{'); err != nil {
+		return err
+	}
+	for dec.More() {
+		tok, err := dec.Token()
+		if err != nil {
+			return streamJSONError(ctx, err)
+		}
+		if tok != "egvs" {
+			var skip json.RawMessage
+			if err := dec.Decode(&skip); err != nil {
+				return streamJSONError(ctx, err)
+			}
+			continue
+		}
+		tok, err = dec.Token()
+		if err != nil {
+			return streamJSONError(ctx, err)
+		}
+		if tok == nil {
+			continue
+		}
+		if tok != json.Delim('[') {
+			return glitch.NewDataError(nil, ErrorJSON, fmt.Sprintf("Could not decode egvs, expected an array but got %v", tok))
+		}
+		for dec.More() {
+			var egv EGV
+			if err := dec.Decode(&egv); err != nil {
+				return streamJSONError(ctx, err)
+			}
+			if err := fn(egv); err != nil {
+				return callbackError(err)
+			}
+		}
+		if err := expectDelim(dec, ']'); err != nil {
+			return err
+		}
+	}
+	return expectDelim(dec, '}')
+}
+
+func expectDelim(dec *json.Decoder, delim json.Delim) glitch.DataError {
+	tok, err := dec.Token()
+	if err != nil {
+		return glitch.NewDataError(err, ErrorJSON, fmt.Sprintf("Could not decode response | %s", err.Error()))
+	}
+	if tok != delim {
+		return glitch.NewDataError(nil, ErrorJSON, fmt.Sprintf("Could not decode response, expected %v but got %v", delim, tok))
+	}
+	return nil
+}
+
+// streamJSONError reports a read cut short by ctx as canceled rather than as bad json
+func streamJSONError(ctx context.Context, err error) glitch.DataError {
+	if ctx.Err() != nil {
+		return glitch.NewDataError(ctx.Err(), ErrorCanceled, "The request was canceled while reading the response")
+	}
+	return glitch.NewDataError(err, ErrorJSON, fmt.Sprintf("Could not decode response | %s", err.Error()))
+}
+
+func callbackError(err error) glitch.DataError {
+	if gerr, ok := err.(glitch.DataError); ok {
+		return gerr
+	}
+	return glitch.NewDataError(err, ErrorCallback, "The callback returned an error")
+}
+
+// countingReader counts the bytes read through it
+type countingReader struct {
+	r io.Reader
+	n int
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += n
+	return n, err
+}
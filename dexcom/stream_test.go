@@ -0,0 +1,99 @@
+package dexcom
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/healthimation/go-glitch/glitch"
+)
+
+func TestUnit_StreamEGVs(t *testing.T) {
+	c, ts := testClient(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Query().Get(paramStartDate) {
+		case "2017-06-16T00:00:00":
+			fmt.Fprint(w, `{"unit": "mg/dL", "egvs": [`)
+			for i := 0; i < 1000; i++ {
+				if i > 0 {
+					fmt.Fprint(w, ",")
+				}
+				fmt.Fprintf(w, `{"systemTime": "2017-06-16T15:40:00", "value": %d, "trend": "flat"}`, i)
+			}
+			fmt.Fprint(w, `], "rateUnit": "mg/dL/min"}`)
+		case "2017-06-17T00:00:00":
+			fmt.Fprint(w, `{"unit": "mg/dL", "egvs": null}`)
+		case "2017-06-18T00:00:00":
+			fmt.Fprint(w, `{"unit": "mg/dL", "egvs": [{"value": 0}, {"value": `)
+		default:
+			w.WriteHeader(http.StatusUnauthorized)
+			fmt.Fprint(w, `{"fault": {"faultstring": "Invalid Access Token"}}`)
+		}
+	}), 5*time.Second)
+	defer ts.Close()
+	buffered := *c.(*dexcomClient)
+	buffered.stream = nil
+
+	type testcase struct {
+		name            string
+		client          Client
+		start           time.Time
+		fn              func(EGV) error
+		expectedCount   int
+		expectedErrCode string
+	}
+
+	stopAt := func(n int, err error) func(EGV) error {
+		return func(egv EGV) error {
+			if int(egv.Value) == n-1 {
+				return err
+			}
+			return nil
+		}
+	}
+
+	testcases := []testcase{
+		{name: "streamed", client: c, start: time.Date(2017, 6, 16, 0, 0, 0, 0, time.UTC), expectedCount: 1000},
+		{name: "buffered", client: &buffered, start: time.Date(2017, 6, 16, 0, 0, 0, 0, time.UTC), expectedCount: 1000},
+		{name: "not a streamer", client: struct{ Client }{c}, start: time.Date(2017, 6, 16, 0, 0, 0, 0, time.UTC), expectedCount: 1000},
+		{name: "traced", client: NewTracingClient(c, &testTracer{}), start: time.Date(2017, 6, 16, 0, 0, 0, 0, time.UTC), expectedCount: 1000},
+		{name: "cached", client: NewCachingClient(c, NewLRUCache(10), DefaultCacheTTLs()), start: time.Date(2017, 6, 16, 0, 0, 0, 0, time.UTC), expectedCount: 1000},
+		{name: "null egvs", client: c, start: time.Date(2017, 6, 17, 0, 0, 0, 0, time.UTC)},
+		{name: "stops on callback error", client: c, start: time.Date(2017, 6, 16, 0, 0, 0, 0, time.UTC), fn: stopAt(3, errors.New("full")), expectedCount: 3, expectedErrCode: ErrorCallback},
+		{name: "keeps callback error code", client: c, start: time.Date(2017, 6, 16, 0, 0, 0, 0, time.UTC), fn: stopAt(3, glitch.NewDataError(nil, ErrorStorage, "full")), expectedCount: 3, expectedErrCode: ErrorStorage},
+		{name: "truncated", client: c, start: time.Date(2017, 6, 18, 0, 0, 0, 0, time.UTC), expectedCount: 1, expectedErrCode: ErrorJSON},
+		{name: "unauthorized", client: c, start: time.Date(2017, 6, 19, 0, 0, 0, 0, time.UTC), expectedErrCode: ErrorUnauthorized},
+	}
+
+	for _, test := range testcases {
+		count := 0
+		err := StreamEGVs(context.Background(), test.client, "token", test.start, test.start.Add(24*time.Hour), func(egv EGV) error {
+			if int(egv.Value) != count {
+				t.Fatalf("[%s] Actual value (%v) did not match expected (%d)", test.name, egv.Value, count)
+			}
+			count++
+			if test.fn != nil {
+				return test.fn(egv)
+			}
+			return nil
+		})
+		if err != nil && err.Code() != test.expectedErrCode {
+			t.Fatalf("[%s] Actual error code (%s) did not match expected (%s) | %v", test.name, err.Code(), test.expectedErrCode, err)
+		}
+		if err == nil && test.expectedErrCode != "" {
+			t.Fatalf("[%s] Expected error code (%s) but got none", test.name, test.expectedErrCode)
+		}
+		if count != test.expectedCount {
+			t.Fatalf("[%s] Actual count (%d) did not match expected (%d)", test.name, count, test.expectedCount)
+		}
+	}
+
+	// streamed requests are reported like any other
+	m := &testMetrics{}
+	StreamEGVs(WithMetrics(context.Background(), m), c, "token", time.Date(2017, 6, 17, 0, 0, 0, 0, time.UTC), time.Date(2017, 6, 18, 0, 0, 0, 0, time.UTC), func(EGV) error { return nil })
+	if len(m.observations) != 1 || m.observations[0] != "request GetEGVs 200" {
+		t.Fatalf("Actual observations (%v) did not match expected ([request GetEGVs 200])", m.observations)
+	}
+}
@@ -0,0 +1,183 @@
+package dexcom
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/healthimation/go-glitch/glitch"
+)
+
+// Sink receives the records pulled by a Syncer.  Writes must be upserts so that re-synced records replace rather
+// than duplicate what is already stored.
+type Sink interface {
+	// UpsertEGVs stores egvs, whose values are always in mg/dL and trend rates in mg/dL/min
+	UpsertEGVs(ctx context.Context, userID string, egvs []EGV) glitch.DataError
+	UpsertEvents(ctx context.Context, userID string, events []Event) glitch.DataError
+	UpsertDevices(ctx context.Context, userID string, devices []Device) glitch.DataError
+	UpsertCalibrations(ctx context.Context, userID string, calibrations []Calibration) glitch.DataError
+	// UpsertStatistics stores the statistics calculated for [startDate, endDate)
+	UpsertStatistics(ctx context.Context, userID string, startDate, endDate time.Time, stats *Statistics) glitch.DataError
+}
+
+// CheckpointStore persists how far each user has been synced.  GetCheckpoint returns the zero time for users that
+// have never been synced.
+type CheckpointStore interface {
+	GetCheckpoint(ctx context.Context, userID string) (time.Time, glitch.DataError)
+	SaveCheckpoint(ctx context.Context, userID string, checkpoint time.Time) glitch.DataError
+}
+
+// SyncResult describes a single user sync
+type SyncResult struct {
+	UserID       string
+	Start        time.Time
+	End          time.Time
+	EGVs         int
+	Events       int
+	Devices      int
+	Calibrations int
+	// LastUploadDate is the most recent upload reported by any of the user's devices
+	LastUploadDate time.Time
+}
+
+// Syncer keeps a local copy of a user's data current
+type Syncer interface {
+	// Sync pulls everything from the user's checkpoint (less the overlap) up to now into the sink
+	Sync(ctx context.Context, userID, accessToken string) (*SyncResult, glitch.DataError)
+}
+
+type syncer struct {
+	c               Client
+	sink            Sink
+	checkpoints     CheckpointStore
+	overlap         time.Duration
+	initialLookback time.Duration
+	now             func() time.Time
+}
+
+// NewSyncer returns a Syncer.  Each sync re-fetches overlap before the saved checkpoint to pick up late uploads, and
+// users without a checkpoint are synced from initialLookback ago.
+func NewSyncer(c Client, sink Sink, checkpoints CheckpointStore, overlap, initialLookback time.Duration) Syncer {
+	return &syncer{
+		c:               c,
+		sink:            sink,
+		checkpoints:     checkpoints,
+		overlap:         overlap,
+		initialLookback: initialLookback,
+		now:             time.Now,
+	}
+}
+
+func (s *syncer) Sync(ctx context.Context, userID, accessToken string) (*SyncResult, glitch.DataError) {
+	ctx = WithUserID(ctx, userID)
+	checkpoint, err := s.checkpoints.GetCheckpoint(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	end := s.now().UTC()
+	start := end.Add(-s.initialLookback)
+	if !checkpoint.IsZero() {
+		start = checkpoint.Add(-s.overlap)
+	}
+
+	result := &SyncResult{UserID: userID, Start: start, End: start}
+	for _, w := range splitRange(start, end, MaxRange) {
+		if err := s.syncWindow(ctx, userID, accessToken, w, result); err != nil {
+			return result, err
+		}
+		// only move the checkpoint once the window is safely in the sink
+		if err := s.checkpoints.SaveCheckpoint(ctx, userID, w.end); err != nil {
+			return result, err
+		}
+		result.End = w.end
+	}
+	return result, nil
+}
+
+func (s *syncer) syncWindow(ctx context.Context, userID, accessToken string, w timeWindow, result *SyncResult) glitch.DataError {
+	egvs, err := s.c.GetEGVs(ctx, accessToken, w.start, w.end)
+	if err != nil {
+		return err
+	}
+	events, err := s.c.GetEvents(ctx, accessToken, w.start, w.end)
+	if err != nil {
+		return err
+	}
+	devices, err := s.c.GetDevices(ctx, accessToken, w.start, w.end)
+	if err != nil {
+		return err
+	}
+	calibrations, err := GetCalibrations(ctx, s.c, accessToken, w.start, w.end)
+	if err != nil {
+		return err
+	}
+
+	if err := s.sink.UpsertEGVs(ctx, userID, egvsInMgDL(egvs)); err != nil {
+		return err
+	}
+	if err := s.sink.UpsertEvents(ctx, userID, events.Events); err != nil {
+		return err
+	}
+	if err := s.sink.UpsertDevices(ctx, userID, devices.Devices); err != nil {
+		return err
+	}
+	if err := s.sink.UpsertCalibrations(ctx, userID, calibrations.Calibrations); err != nil {
+		return err
+	}
+
+	result.EGVs += len(egvs.EGVs)
+	result.Events += len(events.Events)
+	result.Devices += len(devices.Devices)
+	result.Calibrations += len(calibrations.Calibrations)
+	for _, device := range devices.Devices {
+		if t, err := ParseTime(device.LastUploadDate); err == nil && t.After(result.LastUploadDate) {
+			result.LastUploadDate = t
+		}
+	}
+	return nil
+}
+
+type memoryCheckpointStore struct {
+	mu          sync.Mutex
+	checkpoints map[string]time.Time
+}
+
+// NewMemoryCheckpointStore returns a CheckpointStore that lives only as long as the process
+func NewMemoryCheckpointStore() CheckpointStore {
+	return &memoryCheckpointStore{checkpoints: make(map[string]time.Time)}
+}
+
+func (m *memoryCheckpointStore) GetCheckpoint(ctx context.Context, userID string) (time.Time, glitch.DataError) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.checkpoints[userID], nil
+}
+
+func (m *memoryCheckpointStore) SaveCheckpoint(ctx context.Context, userID string, checkpoint time.Time) glitch.DataError {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.checkpoints[userID] = checkpoint
+	return nil
+}
+
+// egvsInMgDL returns the response's egvs with values in mg/dL and trend rates in mg/dL/min
+func egvsInMgDL(resp *EGVResponse) []EGV {
+	if resp.Unit == "" || isMgDL(resp.Unit) {
+		return resp.EGVs
+	}
+	rateUnit := resp.RateUnit
+	if rateUnit == "" {
+		rateUnit = resp.Unit + "/min"
+	}
+	ret := make([]EGV, len(resp.EGVs))
+	for i, egv := range resp.EGVs {
+		egv.Value = round(ConvertGlucose(egv.Value, resp.Unit, UnitMgDL), 1)
+		if egv.TrendRate != nil {
+			rate := round(ConvertGlucose(*egv.TrendRate, rateUnit, UnitMgDLPerMin), 2)
+			egv.TrendRate = &rate
+		}
+		ret[i] = egv
+	}
+	return ret
+}
@@ -0,0 +1,155 @@
+package dexcom
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/healthimation/go-glitch/glitch"
+)
+
+type testSink struct {
+	egvs         []EGV
+	events       []Event
+	devices      []Device
+	calibrations []Calibration
+	err          glitch.DataError
+}
+
+func (s *testSink) UpsertEGVs(ctx context.Context, userID string, egvs []EGV) glitch.DataError {
+	s.egvs = append(s.egvs, egvs...)
+	return s.err
+}
+
+func (s *testSink) UpsertEvents(ctx context.Context, userID string, events []Event) glitch.DataError {
+	s.events = append(s.events, events...)
+	return s.err
+}
+
+func (s *testSink) UpsertDevices(ctx context.Context, userID string, devices []Device) glitch.DataError {
+	s.devices = append(s.devices, devices...)
+	return s.err
+}
+
+func (s *testSink) UpsertCalibrations(ctx context.Context, userID string, calibrations []Calibration) glitch.DataError {
+	s.calibrations = append(s.calibrations, calibrations...)
+	return s.err
+}
+
+func (s *testSink) UpsertStatistics(ctx context.Context, userID string, startDate, endDate time.Time, stats *Statistics) glitch.DataError {
+	return s.err
+}
+
+func syncHandler(w http.ResponseWriter, r *http.Request) {
+	switch r.URL.Path {
+	case "/v1/users/self/egvs":
+		fmt.Fprint(w, `{"unit": "mg/dL","rateUnit": "mg/dL/min","egvs": [{"systemTime": "2017-06-16T15:40:00","displayTime": "2017-06-16T07:40:00","value": 119}]}`)
+	case "/v1/users/self/events":
+		fmt.Fprint(w, `{"events": [{"systemTime": "2017-06-16T19:45:00","displayTime": "2017-06-16T11:45:00","eventType": "exercise","eventSubType": "medium","value": 42,"unit": "minutes"}]}`)
+	case "/v1/users/self/devices":
+		fmt.Fprint(w, `{"devices": [{"model": "G5 Mobile App","lastUploadDate": "2017-06-16T20:00:00"}]}`)
+	case "/v1/users/self/calibrations":
+		fmt.Fprint(w, `{"calibrations": []}`)
+	default:
+		w.WriteHeader(http.StatusNotFound)
+	}
+}
+
+func TestUnit_Sync(t *testing.T) {
+	now := time.Date(2017, 6, 17, 0, 0, 0, 0, time.UTC)
+
+	type testcase struct {
+		name               string
+		checkpoint         time.Time
+		sinkErr            glitch.DataError
+		expectedErrCode    string
+		expectedStart      time.Time
+		expectedCheckpoint time.Time
+		expectedEGVs       int
+	}
+
+	testcases := []testcase{
+		{
+			name:               "base path",
+			checkpoint:         now.Add(-6 * time.Hour),
+			expectedStart:      now.Add(-7 * time.Hour),
+			expectedCheckpoint: now,
+			expectedEGVs:       1,
+		},
+		{
+			name:               "first sync is split into windows",
+			expectedStart:      now.Add(-100 * 24 * time.Hour),
+			expectedCheckpoint: now,
+			expectedEGVs:       2,
+		},
+		{
+			name:               "exceptional path - sink failure keeps checkpoint",
+			checkpoint:         now.Add(-6 * time.Hour),
+			sinkErr:            glitch.NewDataError(nil, "SINK", "sink failed"),
+			expectedErrCode:    "SINK",
+			expectedStart:      now.Add(-7 * time.Hour),
+			expectedCheckpoint: now.Add(-6 * time.Hour),
+		},
+	}
+
+	for _, tc := range testcases {
+		t.Run(tc.name, func(t *testing.T) {
+			c, ts := testClient(http.HandlerFunc(syncHandler), 5*time.Second)
+			defer ts.Close()
+			sink := &testSink{err: tc.sinkErr}
+			checkpoints := NewMemoryCheckpointStore()
+			if !tc.checkpoint.IsZero() {
+				checkpoints.SaveCheckpoint(context.Background(), "user", tc.checkpoint)
+			}
+			s := NewSyncer(c, sink, checkpoints, time.Hour, 100*24*time.Hour).(*syncer)
+			s.now = func() time.Time { return now }
+
+			ret, err := s.Sync(context.Background(), "user", "token")
+			if tc.expectedErrCode != "" || err != nil {
+				if tc.expectedErrCode == "" {
+					t.Fatalf("Unexpected error occurred (%#v)", err)
+				}
+				if err == nil {
+					t.Fatalf("Expected error did not occur")
+				}
+				if err.Code() != tc.expectedErrCode {
+					t.Fatalf("Actual error (%#v) did not match expected (%#v)", err.Code(), tc.expectedErrCode)
+				}
+			}
+			if !ret.Start.Equal(tc.expectedStart) {
+				t.Fatalf("Actual start (%s) did not match expected (%s)", ret.Start, tc.expectedStart)
+			}
+			if ret.EGVs != tc.expectedEGVs {
+				t.Fatalf("Actual egv count (%d) did not match expected (%d)", ret.EGVs, tc.expectedEGVs)
+			}
+			checkpoint, _ := checkpoints.GetCheckpoint(context.Background(), "user")
+			if !checkpoint.Equal(tc.expectedCheckpoint) {
+				t.Fatalf("Actual checkpoint (%s) did not match expected (%s)", checkpoint, tc.expectedCheckpoint)
+			}
+		})
+	}
+}
+
+func TestUnit_SyncConvertsToMgDL(t *testing.T) {
+	now := time.Date(2017, 6, 17, 0, 0, 0, 0, time.UTC)
+	c, ts := testClient(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/v1/users/self/egvs" {
+			fmt.Fprint(w, `{"unit": "mmol/L","rateUnit": "mmol/L/min","egvs": [{"systemTime": "2017-06-16T15:40:00","value": 5.5,"trendRate": 0.1}]}`)
+			return
+		}
+		syncHandler(w, r)
+	}), 5*time.Second)
+	defer ts.Close()
+	sink := &testSink{}
+	s := NewSyncer(c, sink, NewMemoryCheckpointStore(), time.Hour, 24*time.Hour).(*syncer)
+	s.now = func() time.Time { return now }
+
+	if _, err := s.Sync(context.Background(), "user", "token"); err != nil {
+		t.Fatalf("Unexpected error occurred (%#v)", err)
+	}
+	if len(sink.egvs) != 1 || sink.egvs[0].Value != 99.1 || *sink.egvs[0].TrendRate != 1.8 {
+		t.Fatalf("Actual egvs (%#v) were not converted to mg/dL", sink.egvs)
+	}
+}
@@ -0,0 +1,237 @@
+// Package tidepool converts dexcom data to Tidepool's data model.
+package tidepool
+
+import (
+	"strings"
+	"time"
+
+	"github.com/healthimation/go-dexcom/dexcom"
+	"github.com/healthimation/go-glitch/glitch"
+)
+
+// Tidepool data types
+const (
+	TypeCBG              = "cbg"
+	TypeFood             = "food"
+	TypeBolus            = "bolus"
+	TypePhysicalActivity = "physicalActivity"
+	TypeDeviceEvent      = "deviceEvent"
+	TypeReportedState    = "reportedState"
+)
+
+const (
+	subTypeNormal      = "normal"
+	subTypeCalibration = "calibration"
+	insulinFastActing  = "fastActing"
+	timeFormat         = "2006-01-02T15:04:05.000Z"
+	deviceTimeFormat   = "2006-01-02T15:04:05"
+)
+
+// intensities maps dexcom exercise subtypes to tidepool reported intensities
+var intensities = map[string]string{
+	"light":  "low",
+	"medium": "medium",
+	"heavy":  "high",
+}
+
+// states maps dexcom health subtypes to tidepool reported states
+var states = map[string]string{
+	"illness":      "illness",
+	"stress":       "stress",
+	"highSymptoms": "hyperglycemiaSymptoms",
+	"lowSymptoms":  "hypoglycemiaSymptoms",
+	"cycle":        "cycle",
+	"alcohol":      "alcohol",
+}
+
+// Datum is one record in Tidepool's data model.  Only the fields of the type are set.
+type Datum struct {
+	Type    string `json:"type"`
+	SubType string `json:"subType,omitempty"`
+	// Time is UTC, DeviceTime is the device's local clock and TimezoneOffset the difference in minutes
+	Time           string  `json:"time"`
+	DeviceTime     string  `json:"deviceTime,omitempty"`
+	TimezoneOffset int     `json:"timezoneOffset"`
+	DeviceID       string  `json:"deviceId"`
+	Origin         *Origin `json:"origin,omitempty"`
+
+	Units             string     `json:"units,omitempty"`
+	Value             *float64   `json:"value,omitempty"`
+	Normal            *float64   `json:"normal,omitempty"`
+	Nutrition         *Nutrition `json:"nutrition,omitempty"`
+	Duration          *Quantity  `json:"duration,omitempty"`
+	ReportedIntensity string     `json:"reportedIntensity,omitempty"`
+	States            []State    `json:"states,omitempty"`
+}
+
+// Origin identifies the source record
+type Origin struct {
+	ID string `json:"id"`
+}
+
+// Nutrition is the content of a food record
+type Nutrition struct {
+	Carbohydrate Carbohydrate `json:"carbohydrate"`
+}
+
+// Carbohydrate is an amount of carbs
+type Carbohydrate struct {
+	Net   float64 `json:"net"`
+	Units string  `json:"units"`
+}
+
+// Quantity is a value with units
+type Quantity struct {
+	Value float64 `json:"value"`
+	Units string  `json:"units"`
+}
+
+// State is a reported state, e.g. illness
+type State struct {
+	State string `json:"state"`
+}
+
+// DeviceID returns the tidepool device id for a dexcom device
+func DeviceID(d dexcom.Device) string {
+	return "Dexcom_" + strings.ReplaceAll(strings.TrimSpace(d.Model), " ", "_")
+}
+
+// Convert converts everything fetched for a user to tidepool data, attributed to the first device
+func Convert(devices *dexcom.DeviceResponse, egvs *dexcom.EGVResponse, events *dexcom.EventResponse, calibrations *dexcom.CalibrationResponse) ([]Datum, glitch.DataError) {
+	device := dexcom.Device{}
+	if devices != nil && len(devices.Devices) > 0 {
+		device = devices.Devices[0]
+	}
+	deviceID := DeviceID(device)
+
+	ret, err := CBGs(egvs, deviceID)
+	if err != nil {
+		return nil, err
+	}
+	data, err := Events(events, deviceID)
+	if err != nil {
+		return nil, err
+	}
+	ret = append(ret, data...)
+	data, err = Calibrations(calibrations, deviceID)
+	if err != nil {
+		return nil, err
+	}
+	return append(ret, data...), nil
+}
+
+// CBGs converts egvs to cbg records in the unit they were fetched in
+func CBGs(resp *dexcom.EGVResponse, deviceID string) ([]Datum, glitch.DataError) {
+	if resp == nil {
+		return nil, nil
+	}
+	unit := resp.Unit
+	if unit == "" {
+		unit = dexcom.UnitMgDL
+	}
+	ret := make([]Datum, 0, len(resp.EGVs))
+	for _, e := range resp.EGVs {
+		d, err := datum(TypeCBG, e.RecordID, e.SystemTime, e.DisplayTime, deviceID)
+		if err != nil {
+			return nil, err
+		}
+		d.Units = unit
+		d.Value = float64Ptr(e.Value)
+		ret = append(ret, d)
+	}
+	return ret, nil
+}
+
+// Events converts carbs to food, fast-acting insulin to bolus, exercise to physicalActivity and health events to
+// reportedState.  Long-acting insulin is left out since a bolus would count it towards insulin on board.
+func Events(resp *dexcom.EventResponse, deviceID string) ([]Datum, glitch.DataError) {
+	if resp == nil {
+		return nil, nil
+	}
+	ret := make([]Datum, 0, len(resp.Events))
+	for _, e := range resp.Events {
+		d, err := datum("", e.RecordID, e.SystemTime, e.DisplayTime, deviceID)
+		if err != nil {
+			return nil, err
+		}
+		switch e.EventType {
+		case "carbs":
+			d.Type = TypeFood
+			d.Nutrition = &Nutrition{Carbohydrate: Carbohydrate{Net: e.Value, Units: "grams"}}
+		case "insulin":
+			if e.EventSubType != insulinFastActing {
+				continue
+			}
+			d.Type = TypeBolus
+			d.SubType = subTypeNormal
+			d.Normal = float64Ptr(e.Value)
+		case "exercise":
+			d.Type = TypePhysicalActivity
+			d.Duration = &Quantity{Value: e.Value, Units: "minutes"}
+			d.ReportedIntensity = intensities[e.EventSubType]
+		case "health":
+			state, ok := states[e.EventSubType]
+			if !ok {
+				state = "other"
+			}
+			d.Type = TypeReportedState
+			d.States = []State{State{State: state}}
+		default:
+			continue
+		}
+		ret = append(ret, d)
+	}
+	return ret, nil
+}
+
+// Calibrations converts meter calibrations to calibration device events
+func Calibrations(resp *dexcom.CalibrationResponse, deviceID string) ([]Datum, glitch.DataError) {
+	if resp == nil {
+		return nil, nil
+	}
+	ret := make([]Datum, 0, len(resp.Calibrations))
+	for _, c := range resp.Calibrations {
+		d, err := datum(TypeDeviceEvent, c.RecordID, c.SystemTime, c.DisplayTime, deviceID)
+		if err != nil {
+			return nil, err
+		}
+		d.SubType = subTypeCalibration
+		d.Units = c.Unit
+		if d.Units == "" {
+			d.Units = dexcom.UnitMgDL
+		}
+		d.Value = float64Ptr(c.Value)
+		ret = append(ret, d)
+	}
+	return ret, nil
+}
+
+func datum(dataType, recordID, systemTime, displayTime, deviceID string) (Datum, glitch.DataError) {
+	t, err := dexcom.ParseTime(systemTime)
+	if err != nil {
+		return Datum{}, err
+	}
+	d := Datum{
+		Type:     dataType,
+		Time:     t.UTC().Format(timeFormat),
+		DeviceID: deviceID,
+	}
+	if display, err := dexcom.ParseTime(displayTime); err == nil {
+		d.DeviceTime = display.Format(deviceTimeFormat)
+		d.TimezoneOffset = TimezoneOffset(t, display)
+	}
+	if recordID != "" {
+		d.Origin = &Origin{ID: recordID}
+	}
+	return d, nil
+}
+
+// TimezoneOffset returns the offset of the device clock from UTC in minutes.  It is rounded to the nearest quarter hour
+// since device clocks drift.
+func TimezoneOffset(systemTime, displayTime time.Time) int {
+	return int(displayTime.Sub(systemTime).Round(15*time.Minute) / time.Minute)
+}
+
+func float64Ptr(f float64) *float64 {
+	return &f
+}
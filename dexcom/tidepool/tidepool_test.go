@@ -0,0 +1,72 @@
+package tidepool
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/healthimation/go-dexcom/dexcom"
+)
+
+func TestUnit_Convert(t *testing.T) {
+	devices := &dexcom.DeviceResponse{Devices: []dexcom.Device{dexcom.Device{Model: "G6 Mobile App"}}}
+
+	type testcase struct {
+		name            string
+		egvs            *dexcom.EGVResponse
+		events          *dexcom.EventResponse
+		calibrations    *dexcom.CalibrationResponse
+		expectedErrCode string
+		expected        string
+	}
+
+	testcases := []testcase{
+		{
+			name:     "egvs",
+			egvs:     &dexcom.EGVResponse{Unit: "mg/dL", EGVs: []dexcom.EGV{dexcom.EGV{RecordID: "abc", SystemTime: "2017-06-16T15:40:00", DisplayTime: "2017-06-16T08:40:03", Value: 119}}},
+			expected: `[{"type":"cbg","time":"2017-06-16T15:40:00.000Z","deviceTime":"2017-06-16T08:40:03","timezoneOffset":-420,"deviceId":"Dexcom_G6_Mobile_App","origin":{"id":"abc"},"units":"mg/dL","value":119}]`,
+		},
+		{
+			name: "events",
+			events: &dexcom.EventResponse{Events: []dexcom.Event{
+				dexcom.Event{SystemTime: "2017-06-16T19:45:00", DisplayTime: "2017-06-16T21:45:00", EventType: "carbs", Value: 45, Unit: "grams"},
+				dexcom.Event{SystemTime: "2017-06-16T19:50:00", EventType: "insulin", EventSubType: "fastActing", Value: 4.5, Unit: "units"},
+				dexcom.Event{SystemTime: "2017-06-16T19:55:00", EventType: "insulin", EventSubType: "longActing", Value: 20, Unit: "units"},
+				dexcom.Event{SystemTime: "2017-06-16T20:00:00", EventType: "exercise", EventSubType: "heavy", Value: 30, Unit: "minutes"},
+				dexcom.Event{SystemTime: "2017-06-16T21:00:00", EventType: "health", EventSubType: "lowSymptoms"},
+			}},
+			calibrations: &dexcom.CalibrationResponse{Calibrations: []dexcom.Calibration{dexcom.Calibration{SystemTime: "2017-06-16T22:00:00", Value: 121, Unit: "mg/dL"}}},
+			expected: `[{"type":"food","time":"2017-06-16T19:45:00.000Z","deviceTime":"2017-06-16T21:45:00","timezoneOffset":120,"deviceId":"Dexcom_G6_Mobile_App","nutrition":{"carbohydrate":{"net":45,"units":"grams"}}},` +
+				`{"type":"bolus","subType":"normal","time":"2017-06-16T19:50:00.000Z","timezoneOffset":0,"deviceId":"Dexcom_G6_Mobile_App","normal":4.5},` +
+				`{"type":"physicalActivity","time":"2017-06-16T20:00:00.000Z","timezoneOffset":0,"deviceId":"Dexcom_G6_Mobile_App","duration":{"value":30,"units":"minutes"},"reportedIntensity":"high"},` +
+				`{"type":"reportedState","time":"2017-06-16T21:00:00.000Z","timezoneOffset":0,"deviceId":"Dexcom_G6_Mobile_App","states":[{"state":"hypoglycemiaSymptoms"}]},` +
+				`{"type":"deviceEvent","subType":"calibration","time":"2017-06-16T22:00:00.000Z","timezoneOffset":0,"deviceId":"Dexcom_G6_Mobile_App","units":"mg/dL","value":121}]`,
+		},
+		{
+			name:            "exceptional path - bad time",
+			events:          &dexcom.EventResponse{Events: []dexcom.Event{dexcom.Event{SystemTime: "yesterday", EventType: "carbs"}}},
+			expectedErrCode: dexcom.ErrorTime,
+		},
+	}
+
+	for _, tc := range testcases {
+		t.Run(tc.name, func(t *testing.T) {
+			data, err := Convert(devices, tc.egvs, tc.events, tc.calibrations)
+			if tc.expectedErrCode != "" || err != nil {
+				if tc.expectedErrCode == "" {
+					t.Fatalf("Unexpected error occurred (%#v)", err)
+				}
+				if err == nil {
+					t.Fatalf("Expected error did not occur")
+				}
+				if err.Code() != tc.expectedErrCode {
+					t.Fatalf("Actual error (%#v) did not match expected (%#v)", err.Code(), tc.expectedErrCode)
+				}
+				return
+			}
+			by, _ := json.Marshal(data)
+			if string(by) != tc.expected {
+				t.Fatalf("Actual (%s) did not match expected (%s)", by, tc.expected)
+			}
+		})
+	}
+}
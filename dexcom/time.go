@@ -0,0 +1,69 @@
+package dexcom
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/healthimation/go-glitch/glitch"
+)
+
+// timeLayouts are the layouts dexcom has been seen to use for systemTime and displayTime
+var timeLayouts = []string{
+	timeformat,
+	time.RFC3339Nano,
+	"2006-01-02T15:04:05.999999999",
+}
+
+// ParseTime parses a systemTime or displayTime value as returned by the api.  Values without an offset are treated as UTC.
+func ParseTime(value string) (time.Time, glitch.DataError) {
+	for _, layout := range timeLayouts {
+		t, err := time.Parse(layout, value)
+		if err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, glitch.NewDataError(fmt.Errorf("unrecognized time %q", value), ErrorTime, "Could not parse time")
+}
+
+// FormatTime formats t the way the api formats systemTime
+func FormatTime(t time.Time) string {
+	return t.UTC().Format(timeformat)
+}
+
+// compareTimes orders two api time strings, falling back to a string comparison when either cannot be parsed
+func compareTimes(a, b string) int {
+	at, aerr := ParseTime(a)
+	bt, berr := ParseTime(b)
+	if aerr != nil || berr != nil {
+		switch {
+		case a < b:
+			return -1
+		case a > b:
+			return 1
+		}
+		return 0
+	}
+	return at.Compare(bt)
+}
+
+// MaxRange is the longest date range the api will serve in a single request
+const MaxRange = 90 * 24 * time.Hour
+
+type timeWindow struct {
+	start time.Time
+	end   time.Time
+}
+
+// splitRange breaks [start, end) into consecutive windows no longer than max
+func splitRange(start, end time.Time, max time.Duration) []timeWindow {
+	var windows []timeWindow
+	for start.Before(end) {
+		next := start.Add(max)
+		if next.After(end) {
+			next = end
+		}
+		windows = append(windows, timeWindow{start: start, end: next})
+		start = next
+	}
+	return windows
+}
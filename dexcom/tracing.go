@@ -0,0 +1,165 @@
+package dexcom
+
+import (
+	"context"
+	"time"
+
+	"github.com/healthimation/go-glitch/glitch"
+)
+
+// Span attribute keys.  Attributes never hold tokens, codes, user ids or glucose values.
+const (
+	AttributeEndpoint   = "dexcom.endpoint"
+	AttributeStartDate  = "dexcom.start_date"
+	AttributeEndDate    = "dexcom.end_date"
+	AttributeRecords    = "dexcom.records"
+	AttributeStatus     = "dexcom.status"
+	AttributeHTTPStatus = "http.response.status_code"
+
+	statusOK = "ok"
+)
+
+// Tracer starts spans, e.g. an OpenTelemetry trace.Tracer adapted by oteltrace.NewTracer.  The returned context carries
+// the span so that spans started from it become its children.
+type Tracer interface {
+	Start(ctx context.Context, name string) (context.Context, Span)
+}
+
+// Span is one traced operation
+type Span interface {
+	SetAttributes(attributes ...Attribute)
+	// SetError marks the span as failed with a glitch error code.  Error messages are not passed on since they can hold
+	// response bodies.
+	SetError(code string)
+	End()
+}
+
+// Attribute is a span attribute, Value is a string, int64 or bool
+type Attribute struct {
+	Key   string
+	Value interface{}
+}
+
+type tracingClient struct {
+	c      Client
+	tracer Tracer
+}
+
+// NewTracingClient wraps c so every call runs in a span named dexcom.<method> with the endpoint, date range, record
+// count and status as attributes.  Requests made inside the span add their http status.
+func NewTracingClient(c Client, tracer Tracer) Client {
+	return &tracingClient{c: c, tracer: tracer}
+}
+
+func (t *tracingClient) start(ctx context.Context, endpoint string, startDate, endDate time.Time) (context.Context, Span) {
+	ctx, span := t.tracer.Start(ctx, "dexcom."+endpoint)
+	span.SetAttributes(Attribute{Key: AttributeEndpoint, Value: endpoint})
+	if !startDate.IsZero() {
+		span.SetAttributes(
+			Attribute{Key: AttributeStartDate, Value: FormatTime(startDate)},
+			Attribute{Key: AttributeEndDate, Value: FormatTime(endDate)},
+		)
+	}
+	return context.WithValue(ctx, contextKeySpan, span), span
+}
+
+// endSpan records the outcome of a call and ends its span
+func endSpan(span Span, records int, err glitch.DataError) {
+	if err != nil {
+		span.SetAttributes(Attribute{Key: AttributeStatus, Value: err.Code()})
+		span.SetError(err.Code())
+	} else {
+		span.SetAttributes(Attribute{Key: AttributeStatus, Value: statusOK}, Attribute{Key: AttributeRecords, Value: int64(records)})
+	}
+	span.End()
+}
+
+func (t *tracingClient) GetUser(ctx context.Context, authorizationCode, redirectURI string) (*UserToken, glitch.DataError) {
+	ctx, span := t.start(ctx, EndpointGetUser, time.Time{}, time.Time{})
+	ret, err := t.c.GetUser(ctx, authorizationCode, redirectURI)
+	endSpan(span, 1, err)
+	return ret, err
+}
+
+func (t *tracingClient) RefreshUser(ctx context.Context, refreshToken, redirectURI string) (*UserToken, glitch.DataError) {
+	ctx, span := t.start(ctx, EndpointRefreshUser, time.Time{}, time.Time{})
+	ret, err := t.c.RefreshUser(ctx, refreshToken, redirectURI)
+	endSpan(span, 1, err)
+	return ret, err
+}
+
+func (t *tracingClient) GetDevices(ctx context.Context, accessToken string, startDate, endDate time.Time) (*DeviceResponse, glitch.DataError) {
+	ctx, span := t.start(ctx, EndpointGetDevices, startDate, endDate)
+	ret, err := t.c.GetDevices(ctx, accessToken, startDate, endDate)
+	records := 0
+	if ret != nil {
+		records = len(ret.Devices)
+	}
+	endSpan(span, records, err)
+	return ret, err
+}
+
+func (t *tracingClient) GetEGVs(ctx context.Context, accessToken string, startDate, endDate time.Time) (*EGVResponse, glitch.DataError) {
+	ctx, span := t.start(ctx, EndpointGetEGVs, startDate, endDate)
+	ret, err := t.c.GetEGVs(ctx, accessToken, startDate, endDate)
+	records := 0
+	if ret != nil {
+		records = len(ret.EGVs)
+	}
+	endSpan(span, records, err)
+	return ret, err
+}
+
+// StreamEGVs runs the stream in a dexcom.GetEGVs span that counts the egvs passed to fn
+func (t *tracingClient) StreamEGVs(ctx context.Context, accessToken string, startDate, endDate time.Time, fn func(EGV) error) glitch.DataError {
+	ctx, span := t.start(ctx, EndpointGetEGVs, startDate, endDate)
+	records := 0
+	err := StreamEGVs(ctx, t.c, accessToken, startDate, endDate, func(egv EGV) error {
+		records++
+		return fn(egv)
+	})
+	endSpan(span, records, err)
+	return err
+}
+
+func (t *tracingClient) GetEvents(ctx context.Context, accessToken string, startDate, endDate time.Time) (*EventResponse, glitch.DataError) {
+	ctx, span := t.start(ctx, EndpointGetEvents, startDate, endDate)
+	ret, err := t.c.GetEvents(ctx, accessToken, startDate, endDate)
+	records := 0
+	if ret != nil {
+		records = len(ret.Events)
+	}
+	endSpan(span, records, err)
+	return ret, err
+}
+
+func (t *tracingClient) GetCalibrations(ctx context.Context, accessToken string, startDate, endDate time.Time) (*CalibrationResponse, glitch.DataError) {
+	ctx, span := t.start(ctx, EndpointGetCalibrations, startDate, endDate)
+	ret, err := GetCalibrations(ctx, t.c, accessToken, startDate, endDate)
+	records := 0
+	if ret != nil {
+		records = len(ret.Calibrations)
+	}
+	endSpan(span, records, err)
+	return ret, err
+}
+
+func (t *tracingClient) GetStatistics(ctx context.Context, accessToken string, startDate, endDate time.Time, stats map[string][]StatRequest) (*Statistics, glitch.DataError) {
+	ctx, span := t.start(ctx, EndpointGetStatistics, startDate, endDate)
+	ret, err := t.c.GetStatistics(ctx, accessToken, startDate, endDate, stats)
+	records := 0
+	if ret != nil {
+		records = int(ret.NValues)
+	}
+	endSpan(span, records, err)
+	return ret, err
+}
+
+// spanFromContext returns the span started by a tracing client further up the call
+func spanFromContext(ctx context.Context) (Span, bool) {
+	if ctx == nil {
+		return nil, false
+	}
+	span, ok := ctx.Value(contextKeySpan).(Span)
+	return span, ok
+}
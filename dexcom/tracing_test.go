@@ -0,0 +1,136 @@
+package dexcom
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+type testSpan struct {
+	name       string
+	parent     *testSpan
+	attributes map[string]interface{}
+	errorCode  string
+	ended      bool
+}
+
+func (s *testSpan) SetAttributes(attributes ...Attribute) {
+	for _, a := range attributes {
+		s.attributes[a.Key] = a.Value
+	}
+}
+
+func (s *testSpan) SetError(code string) {
+	s.errorCode = code
+}
+
+func (s *testSpan) End() {
+	s.ended = true
+}
+
+type testTracerKey struct{}
+
+// testTracer records spans, parenting them through the context like an OpenTelemetry tracer
+type testTracer struct {
+	mu    sync.Mutex
+	spans []*testSpan
+}
+
+func (t *testTracer) Start(ctx context.Context, name string) (context.Context, Span) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	parent, _ := ctx.Value(testTracerKey{}).(*testSpan)
+	span := &testSpan{name: name, parent: parent, attributes: map[string]interface{}{}}
+	t.spans = append(t.spans, span)
+	return context.WithValue(ctx, testTracerKey{}, span), span
+}
+
+func TestUnit_TracingClient(t *testing.T) {
+	c, ts := testClient(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasSuffix(r.URL.Path, "events") {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		fmt.Fprint(w, `{"unit": "mg/dL", "egvs": [{"systemTime": "2017-06-16T15:40:00", "value": 119}, {"systemTime": "2017-06-16T15:45:00", "value": 121}]}`)
+	}), 5*time.Second)
+	defer ts.Close()
+	tracer := &testTracer{}
+	tc := NewTracingClient(c, tracer)
+	start := time.Date(2017, 6, 16, 0, 0, 0, 0, time.UTC)
+
+	type testcase struct {
+		name               string
+		call               func(ctx context.Context)
+		expectedName       string
+		expectedAttributes map[string]interface{}
+		expectedErrCode    string
+	}
+
+	testcases := []testcase{
+		{
+			name:         "egvs",
+			call:         func(ctx context.Context) { tc.GetEGVs(ctx, "secret-token", start, start.Add(time.Hour)) },
+			expectedName: "dexcom.GetEGVs",
+			expectedAttributes: map[string]interface{}{
+				AttributeEndpoint:   EndpointGetEGVs,
+				AttributeStartDate:  "2017-06-16T00:00:00",
+				AttributeEndDate:    "2017-06-16T01:00:00",
+				AttributeStatus:     "ok",
+				AttributeRecords:    int64(2),
+				AttributeHTTPStatus: int64(200),
+			},
+		},
+		{
+			name: "stream",
+			call: func(ctx context.Context) {
+				StreamEGVs(ctx, tc, "secret-token", start, start.Add(time.Hour), func(EGV) error { return nil })
+			},
+			expectedName: "dexcom.GetEGVs",
+			expectedAttributes: map[string]interface{}{
+				AttributeEndpoint:   EndpointGetEGVs,
+				AttributeStartDate:  "2017-06-16T00:00:00",
+				AttributeEndDate:    "2017-06-16T01:00:00",
+				AttributeStatus:     "ok",
+				AttributeRecords:    int64(2),
+				AttributeHTTPStatus: int64(200),
+			},
+		},
+		{
+			name:         "error",
+			call:         func(ctx context.Context) { tc.GetEvents(ctx, "secret-token", start, start.Add(time.Hour)) },
+			expectedName: "dexcom.GetEvents",
+			expectedAttributes: map[string]interface{}{
+				AttributeEndpoint:   EndpointGetEvents,
+				AttributeStartDate:  "2017-06-16T00:00:00",
+				AttributeEndDate:    "2017-06-16T01:00:00",
+				AttributeStatus:     ErrorUnauthorized,
+				AttributeHTTPStatus: int64(401),
+			},
+			expectedErrCode: ErrorUnauthorized,
+		},
+	}
+
+	for _, test := range testcases {
+		tracer.spans = nil
+		parentCtx, parent := tracer.Start(context.Background(), "sync")
+		test.call(parentCtx)
+		if len(tracer.spans) != 2 {
+			t.Fatalf("[%s] Actual spans (%d) did not match expected (2)", test.name, len(tracer.spans))
+		}
+		span := tracer.spans[1]
+		if span.name != test.expectedName || span.parent != parent || !span.ended {
+			t.Fatalf("[%s] Actual span (%s, parent %v, ended %t) did not match expected (%s)", test.name, span.name, span.parent, span.ended, test.expectedName)
+		}
+		if !reflect.DeepEqual(span.attributes, test.expectedAttributes) {
+			t.Fatalf("[%s] Actual attributes (%v) did not match expected (%v)", test.name, span.attributes, test.expectedAttributes)
+		}
+		if span.errorCode != test.expectedErrCode {
+			t.Fatalf("[%s] Actual error code (%s) did not match expected (%s)", test.name, span.errorCode, test.expectedErrCode)
+		}
+	}
+}
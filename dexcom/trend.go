@@ -0,0 +1,42 @@
+package dexcom
+
+// Trend values used in EGV.Trend
+const (
+	TrendNone           = "none"
+	TrendDoubleUp       = "doubleUp"
+	TrendSingleUp       = "singleUp"
+	TrendFortyFiveUp    = "fortyFiveUp"
+	TrendFlat           = "flat"
+	TrendFortyFiveDown  = "fortyFiveDown"
+	TrendSingleDown     = "singleDown"
+	TrendDoubleDown     = "doubleDown"
+	TrendNotComputable  = "notComputable"
+	TrendRateOutOfRange = "rateOutOfRange"
+)
+
+// EGV.Status values for readings outside the sensor's range
+const (
+	StatusLow  = "low"
+	StatusHigh = "high"
+)
+
+// TrendForRate returns the trend arrow dexcom shows for a rate of change in mg/dL/min
+func TrendForRate(rate float64) string {
+	switch {
+	case rate > 8 || rate < -8:
+		return TrendRateOutOfRange
+	case rate > 3:
+		return TrendDoubleUp
+	case rate > 2:
+		return TrendSingleUp
+	case rate > 1:
+		return TrendFortyFiveUp
+	case rate >= -1:
+		return TrendFlat
+	case rate >= -2:
+		return TrendFortyFiveDown
+	case rate >= -3:
+		return TrendSingleDown
+	}
+	return TrendDoubleDown
+}
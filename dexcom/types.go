@@ -35,6 +35,7 @@ type EGVResponse struct {
 
 // EGV estimated glucose value
 type EGV struct {
+	RecordID    string   `json:"recordId"`
 	SystemTime  string   `json:"systemTime"`
 	DisplayTime string   `json:"displayTime"`
 	Value       float64  `json:"value"`
@@ -50,6 +51,7 @@ type EventResponse struct {
 
 // Event is a user's event record
 type Event struct {
+	RecordID     string  `json:"recordId"`
 	SystemTime   string  `json:"systemTime"`
 	DisplayTime  string  `json:"displayTime"`
 	EventType    string  `json:"eventType"`
@@ -58,6 +60,20 @@ type Event struct {
 	Unit         string  `json:"unit"`
 }
 
+// CalibrationResponse holds the response to GET /calibrations
+type CalibrationResponse struct {
+	Calibrations []Calibration `json:"calibrations"`
+}
+
+// Calibration is a meter value entered to calibrate the sensor
+type Calibration struct {
+	RecordID    string  `json:"recordId"`
+	SystemTime  string  `json:"systemTime"`
+	DisplayTime string  `json:"displayTime"`
+	Value       float64 `json:"value"`
+	Unit        string  `json:"unit"`
+}
+
 // StatRequest is used to fetch statistics
 type StatRequest struct {
 	Name      string    `json:"name"`
@@ -105,3 +121,9 @@ type UserToken struct {
 	TokenType    string     `json:"token_type"`
 	ExpireTime   *time.Time `json:"expire_time"`
 }
+
+// oauthError is the body returned when a token request fails
+type oauthError struct {
+	Error            string `json:"error"`
+	ErrorDescription string `json:"error_description"`
+}
@@ -0,0 +1,45 @@
+package dexcom
+
+import (
+	"math"
+	"strings"
+)
+
+// Glucose units used by the api
+const (
+	UnitMgDL        = "mg/dL"
+	UnitMmolL       = "mmol/L"
+	UnitMgDLPerMin  = "mg/dL/min"
+	UnitMmolLPerMin = "mmol/L/min"
+)
+
+// MgDLPerMmolL converts between mg/dL and mmol/L of glucose
+const MgDLPerMmolL = 18.0182
+
+// ConvertGlucose converts value from one glucose unit (or rate unit) to another.  Unknown units are left unconverted.
+func ConvertGlucose(value float64, from, to string) float64 {
+	switch {
+	case isMgDL(from) && isMmolL(to):
+		return value / MgDLPerMmolL
+	case isMmolL(from) && isMgDL(to):
+		return value * MgDLPerMmolL
+	}
+	return value
+}
+
+func isMgDL(unit string) bool {
+	return unit == UnitMgDL || unit == UnitMgDLPerMin || unit == "mg/dl" || unit == "mg/dl/min"
+}
+
+func isMmolL(unit string) bool {
+	return unit == UnitMmolL || unit == UnitMmolLPerMin || unit == "mmol/l" || unit == "mmol/l/min"
+}
+
+func isRate(unit string) bool {
+	return strings.HasSuffix(unit, "/min")
+}
+
+func round(value float64, places int) float64 {
+	p := math.Pow(10, float64(places))
+	return math.Round(value*p) / p
+}
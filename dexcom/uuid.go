@@ -0,0 +1,24 @@
+package dexcom
+
+import (
+	"crypto/sha1"
+	"fmt"
+)
+
+// RecordKey identifies a record by its recordId, or by its systemTime for records without one
+func RecordKey(recordID, systemTime string) string {
+	if recordID != "" {
+		return recordID
+	}
+	return systemTime
+}
+
+// RecordUUID returns a name based uuid for the record of kind with key in namespace, e.g. a user or a patient, so
+// converting the same record twice gives the same id
+func RecordUUID(namespace, kind, key string) string {
+	sum := sha1.Sum([]byte(namespace + "|" + kind + "|" + key))
+	// version 5 and variant bits, as in a name based uuid
+	sum[6] = sum[6]&0x0f | 0x50
+	sum[8] = sum[8]&0x3f | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", sum[0:4], sum[4:6], sum[6:8], sum[8:10], sum[10:16])
+}
@@ -0,0 +1,28 @@
+package dexcom
+
+import "testing"
+
+func TestUnit_RecordUUID(t *testing.T) {
+	type testcase struct {
+		name      string
+		namespace string
+		kind      string
+		recordID  string
+		key       string
+		expected  string
+	}
+
+	testcases := []testcase{
+		{name: "record id", namespace: "Patient/123", kind: "egv", recordID: "abc", key: "2017-06-16T15:40:00", expected: "d516b98a-2ff4-5840-9ce6-e62d9eceb413"},
+		{name: "system time", namespace: "dexcom", kind: "sgv", key: "2017-06-16T15:40:00", expected: "3a21af91-3340-512c-b739-f5244fd15eca"},
+	}
+
+	for _, tc := range testcases {
+		t.Run(tc.name, func(t *testing.T) {
+			actual := RecordUUID(tc.namespace, tc.kind, RecordKey(tc.recordID, tc.key))
+			if actual != tc.expected {
+				t.Fatalf("Actual (%v) did not match expected (%v)", actual, tc.expected)
+			}
+		})
+	}
+}
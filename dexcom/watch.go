@@ -0,0 +1,212 @@
+package dexcom
+
+import (
+	"context"
+	"sort"
+	"time"
+
+	"github.com/healthimation/go-glitch/glitch"
+)
+
+// SensorInterval is how often a dexcom sensor takes a reading
+const SensorInterval = 5 * time.Minute
+
+const (
+	// shortest wait between polls, used while a reading is late
+	minWatchPoll = 30 * time.Second
+	// longest wait after failed polls
+	maxWatchBackoff = 5 * time.Minute
+)
+
+// WatchOptions tunes a call to Watch
+type WatchOptions struct {
+	// Since is the time after which readings are passed on.  Zero means one SensorInterval before the watch starts, so
+	// the current reading comes through straight away.
+	Since time.Time
+	// OnError, if set, is called with each error the watcher recovers from, e.g. a failed poll
+	OnError func(err glitch.DataError)
+}
+
+// Watcher follows a user's readings as they are uploaded
+type Watcher interface {
+	// Watch polls the user's egvs and calls fn with each new reading, oldest first, until ctx is done or fn returns an
+	// error.  The user's token is read from the token store for every poll and refreshed when it expires or is
+	// rejected, so tokens refreshed elsewhere are picked up.  Failed polls are retried with backoff, except when the
+	// refresh token has been revoked (ErrorInvalidGrant) or the user has no token.
+	Watch(ctx context.Context, userID string, opts WatchOptions, fn func(EGV) error) glitch.DataError
+}
+
+type watcher struct {
+	c           Client
+	tokens      TokenStore
+	redirectURI string
+	now         func() time.Time
+	sleep       func(ctx context.Context, d time.Duration) bool
+}
+
+// NewWatcher returns a Watcher that polls with c.  Expired tokens are refreshed with c using redirectURI.
+func NewWatcher(c Client, tokens TokenStore, redirectURI string) Watcher {
+	return &watcher{
+		c:           c,
+		tokens:      tokens,
+		redirectURI: redirectURI,
+		now:         time.Now,
+		sleep:       sleep,
+	}
+}
+
+func (w *watcher) Watch(ctx context.Context, userID string, opts WatchOptions, fn func(EGV) error) glitch.DataError {
+	ctx = WithUserID(ctx, userID)
+	since := opts.Since
+	if since.IsZero() {
+		since = w.now().Add(-SensorInterval)
+	}
+
+	// errors from fn always end the watch, whatever their code
+	var fnErr glitch.DataError
+	emit := func(egv EGV) error {
+		if err := fn(egv); err != nil {
+			fnErr = callbackError(err)
+			return fnErr
+		}
+		return nil
+	}
+
+	var lag, wait time.Duration
+	failures := 0
+	for {
+		if !w.sleep(ctx, wait) {
+			return glitch.NewDataError(ctx.Err(), ErrorCanceled, "Watch was canceled")
+		}
+
+		newest, err := w.poll(ctx, userID, since, emit)
+		now := w.now()
+		if newest.After(since) {
+			since = newest
+			// how long the upload took, at most.  Aiming a little early means the odd poll misses and measures it again, so
+			// the estimate follows the upload lag down as well as up.
+			lag = now.Sub(newest) - minWatchPoll/2
+			if lag < 0 {
+				lag = 0
+			}
+			if lag > SensorInterval {
+				lag = SensorInterval
+			}
+		}
+		if fnErr != nil {
+			return fnErr
+		}
+		if err != nil {
+			if ctx.Err() != nil {
+				return glitch.NewDataError(ctx.Err(), ErrorCanceled, "Watch was canceled")
+			}
+			if err.Code() == ErrorInvalidGrant || err.Code() == ErrorMissingParam {
+				return err
+			}
+			if opts.OnError != nil {
+				opts.OnError(err)
+			}
+			failures++
+			wait = watchBackoff(failures)
+			continue
+		}
+		failures = 0
+		wait = nextPoll(now, since, lag)
+	}
+}
+
+// poll passes the readings after since to fn, oldest first, and returns the time of the newest
+func (w *watcher) poll(ctx context.Context, userID string, since time.Time, fn func(EGV) error) (time.Time, glitch.DataError) {
+	token, err := currentToken(ctx, w.c, w.tokens, userID, w.redirectURI, w.now())
+	if err != nil {
+		return since, err
+	}
+	readings, err := w.readings(ctx, token.AccessToken, since)
+	// a token revoked or replaced before it expired is refreshed once rather than retried until it expires
+	if unauthorized(err) {
+		token, err = refreshToken(ctx, w.c, w.tokens, userID, w.redirectURI, token.AccessToken)
+		if err != nil {
+			return since, err
+		}
+		MetricsFromContext(ctx).ObserveRetry(EndpointGetEGVs)
+		readings, err = w.readings(ctx, token.AccessToken, since)
+	}
+	if err != nil {
+		return since, err
+	}
+
+	newest := since
+	for _, r := range readings {
+		if err := fn(r.egv); err != nil {
+			return newest, callbackError(err)
+		}
+		newest = r.at
+	}
+	return newest, nil
+}
+
+type reading struct {
+	egv EGV
+	at  time.Time
+}
+
+// readings returns the readings after since, oldest first
+func (w *watcher) readings(ctx context.Context, accessToken string, since time.Time) ([]reading, glitch.DataError) {
+	var ret []reading
+	// the api works in whole seconds, so start one second in to skip the reading at since
+	for egv, err := range EGVsSeq(ctx, w.c, accessToken, since.Add(time.Second), w.now()) {
+		if err != nil {
+			return nil, err.(glitch.DataError)
+		}
+		at, terr := ParseTime(egv.SystemTime)
+		if terr != nil || !at.After(since) {
+			continue
+		}
+		ret = append(ret, reading{egv: egv, at: at})
+	}
+	sort.Slice(ret, func(i, j int) bool { return ret[i].at.Before(ret[j].at) })
+	return ret, nil
+}
+
+// nextPoll returns how long to wait for the reading after the one at last, given the upload lag seen so far.  Late
+// readings are polled for every minWatchPoll, and after a few missed readings, e.g. while the sensor warms up, once
+// per SensorInterval.
+func nextPoll(now, last time.Time, lag time.Duration) time.Duration {
+	if now.Sub(last) > 3*SensorInterval {
+		return SensorInterval
+	}
+	wait := last.Add(SensorInterval + lag).Sub(now)
+	if wait < minWatchPoll {
+		return minWatchPoll
+	}
+	if wait > SensorInterval {
+		return SensorInterval
+	}
+	return wait
+}
+
+func watchBackoff(failures int) time.Duration {
+	backoff := minWatchPoll
+	for i := 1; i < failures && backoff < maxWatchBackoff; i++ {
+		backoff *= 2
+	}
+	if backoff > maxWatchBackoff {
+		backoff = maxWatchBackoff
+	}
+	return backoff
+}
+
+// sleep waits for d, returning false if ctx is done first
+func sleep(ctx context.Context, d time.Duration) bool {
+	if d <= 0 {
+		return ctx.Err() == nil
+	}
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-t.C:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
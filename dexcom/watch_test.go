@@ -0,0 +1,189 @@
+package dexcom
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/healthimation/go-glitch/glitch"
+)
+
+func TestUnit_Watch(t *testing.T) {
+	base := time.Date(2017, 6, 16, 12, 0, 0, 0, time.UTC)
+	uploadLag := 2 * time.Minute
+
+	var mu sync.Mutex
+	now := base
+	egvRequests := 0
+	clock := func() time.Time {
+		mu.Lock()
+		defer mu.Unlock()
+		return now
+	}
+
+	c, ts := testClient(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		if strings.HasSuffix(r.URL.Path, "token") {
+			r.ParseForm()
+			if r.PostForm.Get(paramRefreshToken) != "refresh" {
+				w.WriteHeader(http.StatusBadRequest)
+				fmt.Fprint(w, `{"error": "invalid_grant"}`)
+				return
+			}
+			fmt.Fprint(w, `{"access_token": "fresh", "refresh_token": "rotated", "expires_in": 7200}`)
+			return
+		}
+		if r.Header.Get("authorization") != "Bearer fresh" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		egvRequests++
+		if egvRequests == 3 {
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+		start, _ := ParseTime(r.URL.Query().Get(paramStartDate))
+		end, _ := ParseTime(r.URL.Query().Get(paramEndDate))
+		var egvs []string
+		// newest first, like the api, and only once uploaded
+		for at := base.Add(time.Hour); !at.Before(base); at = at.Add(-SensorInterval) {
+			if !at.Before(start) && !at.After(end) && !now.Before(at.Add(uploadLag)) {
+				egvs = append(egvs, fmt.Sprintf(`{"systemTime": "%s", "value": %d}`, FormatTime(at), int(at.Sub(base)/SensorInterval)))
+			}
+		}
+		fmt.Fprintf(w, `{"unit": "mg/dL", "egvs": [%s]}`, strings.Join(egvs, ","))
+	}), 5*time.Second)
+	defer ts.Close()
+
+	type testcase struct {
+		name            string
+		start           time.Time
+		refreshToken    string
+		expiresIn       time.Duration
+		stopAfter       int
+		expectedRetries int
+		expectedValues  []int
+		expectedErrs    int
+		expectedErrCode string
+	}
+
+	testcases := []testcase{
+		{
+			name:            "follows uploads",
+			start:           base.Add(3 * time.Minute),
+			refreshToken:    "refresh",
+			stopAfter:       8,
+			expectedValues:  []int{0, 1, 2, 3, 4, 5, 6, 7},
+			expectedErrs:    1,
+			expectedErrCode: ErrorCallback,
+		},
+		{
+			name:            "rejected before it expires",
+			start:           base.Add(3 * time.Minute),
+			refreshToken:    "refresh",
+			expiresIn:       time.Hour,
+			stopAfter:       8,
+			expectedRetries: 1,
+			expectedValues:  []int{0, 1, 2, 3, 4, 5, 6, 7},
+			expectedErrs:    1,
+			expectedErrCode: ErrorCallback,
+		},
+		{
+			name:            "revoked",
+			start:           base.Add(3 * time.Minute),
+			refreshToken:    "revoked",
+			expectedErrCode: ErrorInvalidGrant,
+		},
+	}
+
+	for _, test := range testcases {
+		now = test.start
+		egvRequests = 0
+		expires := test.start.Add(-time.Minute)
+		if test.expiresIn != 0 {
+			expires = test.start.Add(test.expiresIn)
+		}
+		tokens := NewMemoryTokenStore(map[string]*UserToken{"patient": {AccessToken: "stale", RefreshToken: test.refreshToken, ExpireTime: &expires}})
+		w := NewWatcher(c, tokens, "uri").(*watcher)
+		w.now = clock
+		var waits []time.Duration
+		w.sleep = func(ctx context.Context, d time.Duration) bool {
+			mu.Lock()
+			defer mu.Unlock()
+			waits = append(waits, d)
+			now = now.Add(d)
+			return true
+		}
+
+		var values []int
+		errs := 0
+		opts := WatchOptions{OnError: func(glitch.DataError) { errs++ }}
+		m := &testMetrics{}
+		err := w.Watch(WithMetrics(context.Background(), m), "patient", opts, func(egv EGV) error {
+			values = append(values, int(egv.Value))
+			if len(values) == test.stopAfter {
+				return errors.New("done")
+			}
+			return nil
+		})
+		if err == nil || err.Code() != test.expectedErrCode {
+			t.Fatalf("[%s] Actual error (%v) did not match expected (%s)", test.name, err, test.expectedErrCode)
+		}
+		if !reflect.DeepEqual(values, test.expectedValues) {
+			t.Fatalf("[%s] Actual values (%v) did not match expected (%v)", test.name, values, test.expectedValues)
+		}
+		if errs != test.expectedErrs {
+			t.Fatalf("[%s] Actual recovered errors (%d) did not match expected (%d)", test.name, errs, test.expectedErrs)
+		}
+		if retries := m.count("retry " + EndpointGetEGVs); retries != test.expectedRetries {
+			t.Fatalf("[%s] Actual retries (%d) did not match expected (%d)", test.name, retries, test.expectedRetries)
+		}
+		if test.expectedErrCode != ErrorCallback {
+			continue
+		}
+		token, _ := tokens.GetToken(context.Background(), "patient")
+		if token.AccessToken != "fresh" || token.RefreshToken != "rotated" {
+			t.Fatalf("[%s] Actual token (%s) was not refreshed and saved", test.name, token.AccessToken)
+		}
+		// once the lag is learned polls land within a poll interval of each upload
+		for i, d := range waits[len(waits)-4:] {
+			if d > SensorInterval || d < minWatchPoll {
+				t.Fatalf("[%s] Actual wait %d (%s) was out of bounds | %v", test.name, i, d, waits)
+			}
+		}
+		if polls := len(waits); polls > 2*len(values)+2 {
+			t.Fatalf("[%s] Actual polls (%d) were too many for %d readings | %v", test.name, polls, len(values), waits)
+		}
+	}
+}
+
+func TestUnit_NextPoll(t *testing.T) {
+	last := time.Date(2017, 6, 16, 12, 0, 0, 0, time.UTC)
+
+	type testcase struct {
+		name     string
+		now      time.Time
+		lag      time.Duration
+		expected time.Duration
+	}
+
+	testcases := []testcase{
+		{name: "next reading", now: last.Add(2 * time.Minute), lag: time.Minute, expected: 4 * time.Minute},
+		{name: "late reading", now: last.Add(7 * time.Minute), lag: time.Minute, expected: minWatchPoll},
+		{name: "never longer than a reading", now: last, lag: 3 * time.Minute, expected: SensorInterval},
+		{name: "sensor gap", now: last.Add(20 * time.Minute), expected: SensorInterval},
+	}
+
+	for _, test := range testcases {
+		if actual := nextPoll(test.now, last, test.lag); actual != test.expected {
+			t.Fatalf("[%s] Actual wait (%s) did not match expected (%s)", test.name, actual, test.expected)
+		}
+	}
+}